@@ -1,49 +1,114 @@
 package backtest
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"path"
+	"sort"
 	"time"
 
+	"github.com/MitchK/autorobin/cmd/autorobin/output"
 	"github.com/MitchK/autorobin/lib/autopilot"
 	"github.com/MitchK/autorobin/lib/broker/fake"
 	"github.com/MitchK/autorobin/lib/data/tiingo"
 	"github.com/MitchK/autorobin/lib/model"
+	"github.com/MitchK/autorobin/lib/tax"
 	"gonum.org/v1/plot"
 	"gonum.org/v1/plot/plotter"
 	"gonum.org/v1/plot/plotutil"
 	"gonum.org/v1/plot/vg"
 )
 
+// Deposits Cash that is deposited periodically during a backtest
+type Deposits struct {
+	Amount float64
+
+	// Interval Number of periods between two deposits
+	Interval int
+}
+
 // Run Backtest rebalancing strategy
-func Run(desiredWeights model.Weights, assets []model.Asset, tiingoToken string, output string) error {
+func Run(desiredWeights model.Weights, assets []model.Asset, tiingoToken string, outputDir string, options autopilot.Options, deposits Deposits, printer *output.Printer) error {
+	if deposits.Amount < 0 {
+		return errors.New("deposit must not be negative")
+	}
+	if deposits.Amount > 0 && deposits.Interval < 1 {
+		return errors.New("deposit interval must be at least 1 period")
+	}
+
 	p, err := plot.New()
 	if err != nil {
 		return err
 	}
 
 	// get quotes
-	fmt.Println("Fetching quote data from last year from Tiingo...")
+	printer.Printf("Fetching quote data from last year from Tiingo...\n")
 	adapter := tiingo.NewAdapter(tiingoToken)
 	now := time.Now()
-	data, err := adapter.GetDailyAsc(now.AddDate(-1, 0, 0), now, assets...)
+	start := now.AddDate(-1, 0, 0)
+	dataAssets := options.Harvest.WithSubstitutes(assets)
+	from := start
+	if options.Weighting.IsEnabled() {
+		// the weighting strategy needs the quotes of the lookback window before the first simulated day
+		from = start.AddDate(0, 0, -options.Weighting.Lookback)
+	}
+	history, err := adapter.GetDailyAsc(from, now, dataAssets...)
 	if err != nil {
 		return err
 	}
+	data := make([][]model.Quote, len(history))
+	for i, quotes := range history {
+		first := sort.Search(len(quotes), func(j int) bool {
+			return !quotes[j].Date.Before(start)
+		})
+		data[i] = quotes[first:]
+	}
+	if options.Weighting.IsEnabled() {
+		options.Weighting.History = newHistory(dataAssets, history)
+	}
 
 	chartData := []interface{}{}
 
-	fmt.Println("Simulating...")
+	printer.Printf("Simulating...\n")
 
 	// Simulating HOLD strategy...
-	portfolioQuotes, err := simulate(desiredWeights, data, assets, false)
+	hold, err := simulate(desiredWeights, data, dataAssets, assets, false, options, deposits)
+	if err != nil {
+		return err
+	}
 	chartData = append(chartData, "HOLD Portfolio + cash")
-	chartData = append(chartData, toXYs(portfolioQuotes))
+	chartData = append(chartData, toXYs(hold))
 
-	// Simulating REBALANCE strategy
-	portfolioQuotes, err = simulate(desiredWeights, data, assets, true)
+	// Simulating REBALANCE strategy, cash-flow rebalancing is compared to full rebalancing
+	fullOptions := options
+	fullOptions.Mode = autopilot.ModeFull
+	rebalance, err := simulate(desiredWeights, data, dataAssets, assets, true, fullOptions, deposits)
+	if err != nil {
+		return err
+	}
 	chartData = append(chartData, "REBALANCE Portfolio + cash")
-	chartData = append(chartData, toXYs(portfolioQuotes))
+	chartData = append(chartData, toXYs(rebalance))
+
+	var cashFlow simulation
+	if options.Mode == autopilot.ModeCashFlow {
+		cashFlow, err = simulate(desiredWeights, data, dataAssets, assets, true, options, deposits)
+		if err != nil {
+			return err
+		}
+		chartData = append(chartData, "CASHFLOW Portfolio + cash")
+		chartData = append(chartData, toXYs(cashFlow))
+	}
+
+	document := output.Backtest{
+		Strategies: []output.Strategy{
+			hold.strategy("HOLD"),
+			rebalance.strategy("REBALANCE"),
+		},
+	}
+	if options.Mode == autopilot.ModeCashFlow {
+		document.Strategies = append(document.Strategies, cashFlow.strategy("CASHFLOW"))
+	}
 
 	p.Title.Text = "Backtest"
 	p.X.Label.Text = "Period"
@@ -54,23 +119,23 @@ func Run(desiredWeights model.Weights, assets []model.Asset, tiingoToken string,
 	}
 
 	// Save the plot to a PNG file.
-	fullPath := path.Join(output, "points.png")
-	fmt.Printf("Saving outcome as %v...", fullPath)
-	if err := p.Save(40*vg.Centimeter, 20*vg.Centimeter, fullPath); err != nil {
+	document.Chart = path.Join(outputDir, "points.png")
+	if err := p.Save(40*vg.Centimeter, 20*vg.Centimeter, document.Chart); err != nil {
 		return err
 	}
-	return nil
+	return printer.Print(document)
 }
 
-// randomPoints returns some random x, y points.
-func toXYs(quotes []model.Quote) plotter.XYs {
+// toXYs Returns the growth of the portfolio value per period, deposits are not counted as growth
+func toXYs(simulation simulation) plotter.XYs {
+	quotes := simulation.portfolioQuotes
 	pts := make(plotter.XYs, len(quotes))
 	var value float64
 	for i := range quotes {
 		if i == 0 {
 			value = 1.0
 		} else {
-			curr := quotes[i].Price
+			curr := quotes[i].Price - simulation.deposits[i]
 			prev := quotes[i-1].Price
 			value *= (1.0 + (curr-prev)/prev)
 		}
@@ -80,15 +145,120 @@ func toXYs(quotes []model.Quote) plotter.XYs {
 	return pts
 }
 
-func simulate(desiredWeights model.Weights, data [][]model.Quote, assets []model.Asset, rebalance bool) ([]model.Quote, error) {
-	numAssets := len(assets)
+// history Serves the fetched quotes to the weighting strategy of a backtest, the simulated date is the end of every
+// request, so the strategy never sees later quotes
+type history struct {
+	quotes map[model.Asset][]model.Quote
+}
+
+func newHistory(assets []model.Asset, quotes [][]model.Quote) *history {
+	history := &history{
+		quotes: map[model.Asset][]model.Quote{},
+	}
+	for i, asset := range assets {
+		history.quotes[asset] = quotes[i]
+	}
+	return history
+}
+
+// GetDailyAsc GetDailyAsc
+func (history *history) GetDailyAsc(from, to time.Time, assets ...model.Asset) ([][]model.Quote, error) {
+	quotes := make([][]model.Quote, len(assets))
+	for i, asset := range assets {
+		all, ok := history.quotes[asset]
+		if !ok {
+			return nil, fmt.Errorf("no quotes of %s", asset.Symbol)
+		}
+		quotes[i] = []model.Quote{}
+		for _, quote := range all {
+			if !quote.Date.Before(from) && !quote.Date.After(to) {
+				quotes[i] = append(quotes[i], quote)
+			}
+		}
+	}
+	return quotes, nil
+}
+
+// simulation Outcome of a simulated strategy
+type simulation struct {
+	portfolioQuotes []model.Quote
+	deposits        []float64
+	orders          int
+	volume          float64
+	dropped         int
+	droppedValue    float64
+	gains           tax.Summary
+	gainsByYear     map[int]tax.Summary
+
+	// drift of the portfolio from the desired weights after every period
+	drifts []float64
+}
+
+// strategy Returns the metrics of the simulation
+func (simulation simulation) strategy(name string) output.Strategy {
+	last := simulation.portfolioQuotes[len(simulation.portfolioQuotes)-1]
+	var averageDrift, maxDrift float64
+	for _, drift := range simulation.drifts {
+		averageDrift += drift / float64(len(simulation.drifts))
+		maxDrift = math.Max(maxDrift, drift)
+	}
+	strategy := output.Strategy{
+		Name:          name,
+		FinalValue:    last.Price,
+		Orders:        simulation.orders,
+		Volume:        simulation.volume,
+		DroppedOrders: simulation.dropped,
+		DroppedValue:  simulation.droppedValue,
+		AverageDrift:  averageDrift,
+		MaxDrift:      maxDrift,
+		RealizedGains: output.NewGains(simulation.gains),
+		Years:         []output.Year{},
+	}
+	years := []int{}
+	for year := range simulation.gainsByYear {
+		years = append(years, year)
+	}
+	sort.Ints(years)
+	for _, year := range years {
+		gains := simulation.gainsByYear[year]
+		strategy.Years = append(strategy.Years, output.Year{
+			Year:      year,
+			Losses:    gains.Losses,
+			ShortTerm: gains.ShortTerm,
+			LongTerm:  gains.LongTerm,
+		})
+	}
+	return strategy
+}
+
+// fold Adds the weights of substitutes that are not desired themselves to the weights of the assets they substitute
+func fold(weights model.Weights, desiredWeights model.Weights, substitutes map[model.Asset]model.Asset) model.Weights {
+	folded := model.Weights{}
+	for asset, weight := range weights {
+		folded[asset] += weight
+	}
+	for asset, substitute := range substitutes {
+		if _, desired := desiredWeights[substitute]; desired {
+			continue
+		}
+		if weight, ok := folded[substitute]; ok {
+			folded[asset] += weight
+			delete(folded, substitute)
+		}
+	}
+	return folded
+}
+
+// simulate Simulates a strategy, the data contains the quotes of the assets and the substitutes of harvested assets
+func simulate(desiredWeights model.Weights, data [][]model.Quote, dataAssets []model.Asset, assets []model.Asset, rebalance bool, options autopilot.Options, deposits Deposits) (simulation, error) {
+	numAssets := len(dataAssets)
 	periods := len(data[0])
 
 	// Transpose data
 	dataT := make([][]model.Quote, periods)
 	for period := 0; period < periods; period++ {
 		dataT[period] = make([]model.Quote, numAssets)
-		for i := range assets {
+		for i := range dataAssets {
 			tmp := data[i]
 			quote := tmp[period]
 			dataT[period][i] = quote
@@ -97,45 +267,83 @@ func simulate(desiredWeights model.Weights, data [][]model.Quote, assets []model
 
 	// Run back testing
 	broker := fake.NewBroker(10000.0)
+	broker.SetLogger(options.Logger)
 	pilot, err := autopilot.NewAutopilot(broker)
 	if err != nil {
-		return nil, err
+		return simulation{}, err
+	}
+	var date time.Time
+	options.Now = func() time.Time {
+		return date
+	}
+	err = pilot.SetOptions(options)
+	if err != nil {
+		return simulation{}, err
+	}
+	result := simulation{
+		portfolioQuotes: make([]model.Quote, periods),
+		deposits:        make([]float64, periods),
+		drifts:          make([]float64, periods),
 	}
-	portfolioQuotes := make([]model.Quote, periods)
 	for period := 0; period < periods; period++ {
 		broker.SetQuotes(dataT[period]...)
+		date = dataT[period][0].Date
+		if deposits.Amount > 0 && period > 0 && period%deposits.Interval == 0 {
+			broker.Deposit(deposits.Amount)
+			result.deposits[period] = deposits.Amount
+		}
 		cash, err := broker.GetAvailableCash()
 		if err != nil {
-			return nil, err
+			return simulation{}, err
 		}
-		currentPortfolio, err := broker.GetPortfolio(assets...)
+		currentPortfolio, err := broker.GetPortfolio(dataAssets...)
 		if err != nil {
-			return nil, err
+			return simulation{}, err
 		}
 
 		if period == 0 || rebalance {
-			orders, err := pilot.Rebalance(desiredWeights, false, assets...)
+			plan, err := pilot.Plan(desiredWeights, false, assets...)
 			if err != nil {
-				return nil, err
+				return simulation{}, err
+			}
+			orders := plan.Orders
+			result.dropped += len(plan.Dropped)
+			result.droppedValue += plan.DroppedValue()
+			for _, order := range orders {
+				result.orders++
+				result.volume += order.Value()
 			}
 			if len(orders) > 0 {
 				errs := broker.Execute(orders...)
 				if len(errs) > 0 {
 					for _, err := range errs {
-						return nil, err
+						return simulation{}, err
 					}
 				}
 				cash, err = broker.GetAvailableCash()
 				if err != nil {
-					return nil, err
+					return simulation{}, err
 				}
-				currentPortfolio, err = broker.GetPortfolio(assets...)
+				currentPortfolio, err = broker.GetPortfolio(dataAssets...)
 				if err != nil {
-					return nil, err
+					return simulation{}, err
 				}
 			}
 		}
-		portfolioQuotes[period] = model.Quote{Price: currentPortfolio.TotalValue + cash}
+		result.portfolioQuotes[period] = model.Quote{Price: currentPortfolio.TotalValue + cash}
+		targetWeights := desiredWeights
+		if options.Schedule != nil {
+			targetWeights = options.Schedule.Weights(date)
+		}
+		if options.Weighting.IsEnabled() {
+			targetWeights, err = options.Weighting.Weights(date, assets)
+			if err != nil {
+				return simulation{}, err
+			}
+		}
+		result.drifts[period] = targetWeights.Drift(fold(currentPortfolio.Weights, targetWeights, options.Harvest.Substitutes))
 	}
-	return portfolioQuotes, nil
+	result.gains = tax.Summarize(broker.GetRealizedGains()...)
+	result.gainsByYear = tax.SummarizeByYear(broker.GetRealizedGains()...)
+	return result, nil
 }
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/MitchK/autorobin/cmd/autorobin/output"
+	"github.com/MitchK/autorobin/lib/broker"
+	"github.com/MitchK/autorobin/lib/broker/paper"
+	"github.com/urfave/cli"
+	yaml "gopkg.in/yaml.v2"
+
+	// registered brokers
+	_ "github.com/MitchK/autorobin/lib/broker/alpaca"
+	_ "github.com/MitchK/autorobin/lib/broker/ibkr"
+	_ "github.com/MitchK/autorobin/lib/broker/robinhood"
+)
+
+// envReplacer Turns flag names into environment variable names, e.g. alpaca.key-id into ALPACA_KEY_ID
+var envReplacer = strings.NewReplacer(".", "_", "-", "_")
+
+// brokerFlags Returns the flags to select a broker and a flag BROKER.SETTING for every setting of the registered brokers
+func brokerFlags() []cli.Flag {
+	names := []string{}
+	for _, registration := range broker.Registrations() {
+		names = append(names, registration.Name)
+	}
+	flags := []cli.Flag{
+		cli.StringFlag{
+			Name:   "broker",
+			EnvVar: "BROKER",
+			Value:  "robinhood",
+			Usage:  "Trade with broker `NAME`: " + strings.Join(names, ", "),
+		},
+		brokerConfigFlag,
+	}
+	for _, registration := range broker.Registrations() {
+		flags = append(flags, brokerSettingFlags(registration)...)
+	}
+	return flags
+}
+
+var brokerConfigFlag = cli.StringFlag{
+	Name:   "broker.config",
+	EnvVar: "BROKER_CONFIG",
+	Usage:  "Load the settings of the brokers from the YAML `FILE` (see README), flags and environment variables take precedence",
+}
+
+// brokerSettingFlags Returns a flag BROKER.SETTING for every setting of a broker, e.g. --robinhood.username
+func brokerSettingFlags(registration broker.Registration) []cli.Flag {
+	flags := []cli.Flag{}
+	for _, setting := range registration.Settings {
+		name := brokerFlagName(registration.Name, setting.Name)
+		if setting.Alias != "" {
+			name += ", " + setting.Alias
+		}
+		flags = append(flags, cli.StringFlag{
+			Name:   name,
+			EnvVar: strings.ToUpper(envReplacer.Replace(brokerFlagName(registration.Name, setting.Name))),
+			Value:  setting.Default,
+			Usage:  setting.Usage,
+		})
+	}
+	return flags
+}
+
+func brokerFlagName(name string, setting string) string {
+	return name + "." + setting
+}
+
+// brokerConfigs Returns the config of every registered broker. Values of the --broker.config file are overridden by
+// flags and environment variables.
+func brokerConfigs(c *cli.Context) (map[string]broker.Config, error) {
+	configs := map[string]broker.Config{}
+	if path := c.String("broker.config"); path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.UnmarshalStrict(data, &configs); err != nil {
+			return nil, fmt.Errorf("invalid broker config file %s: %v", path, err)
+		}
+		for name := range configs {
+			if _, err := broker.Lookup(name); err != nil {
+				return nil, fmt.Errorf("invalid broker config file %s: %v", path, err)
+			}
+		}
+	}
+	for _, registration := range broker.Registrations() {
+		config := configs[registration.Name]
+		if config == nil {
+			config = broker.Config{}
+		}
+		for _, setting := range registration.Settings {
+			name := brokerFlagName(registration.Name, setting.Name)
+			if c.IsSet(name) {
+				config[setting.Name] = c.String(name)
+			}
+		}
+		configs[registration.Name] = config
+	}
+	return configs, nil
+}
+
+// paperFlags Returns the flags of the paper broker
+func paperFlags() []cli.Flag {
+	registration, err := broker.Lookup("paper")
+	if err != nil {
+		panic(err)
+	}
+	return append([]cli.Flag{brokerConfigFlag}, brokerSettingFlags(registration)...)
+}
+
+// openPaper Opens the account of the paper broker
+func openPaper(c *cli.Context, logger *slog.Logger) (*paper.Broker, error) {
+	configs, err := brokerConfigs(c)
+	if err != nil {
+		return nil, err
+	}
+	account, err := broker.New("paper", configs["paper"], logger)
+	if err != nil {
+		return nil, err
+	}
+	return account.(*paper.Broker), nil
+}
+
+// parseAmount Parses the AMOUNT argument of a command
+func parseAmount(c *cli.Context) (float64, error) {
+	if c.NArg() != 1 {
+		return 0, errors.New("expected one argument AMOUNT")
+	}
+	amount, err := strconv.ParseFloat(c.Args().First(), 64)
+	if err != nil || amount <= 0 {
+		return 0, fmt.Errorf("invalid amount: %s", c.Args().First())
+	}
+	return amount, nil
+}
+
+func printCash(account broker.Broker, printer *output.Printer) error {
+	cash, err := account.GetAvailableCash()
+	if err != nil {
+		return err
+	}
+	return printer.Print(output.Cash{Cash: cash})
+}
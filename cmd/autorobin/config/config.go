@@ -0,0 +1,171 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// FileName Name of the config file in the XDG config directories
+const FileName = "autorobin/config.yaml"
+
+// Value Value of a setting and the file it is configured in. Settings of flags that can be repeated may have several values.
+type Value struct {
+	Values []string
+	Source string
+}
+
+// Config Settings of config files by flag name, e.g.
+//
+//   pv.csvfile: portfolio.csv
+//   robinhood.username: me@example.com
+//   mode: cashflow
+//   trade.asset-min-value: [AAPL=100, VTI=50]
+//   profiles:
+//     ira:
+//       robinhood.account: 5RY67890
+//       mode: full
+type Config struct {
+	settings map[string]Value
+	profiles map[string]map[string]Value
+}
+
+// Paths Returns the config files of the XDG base directories that exist, the system wide ones first
+func Paths() []string {
+	dirs := []string{}
+	configDirs := os.Getenv("XDG_CONFIG_DIRS")
+	if configDirs == "" {
+		configDirs = "/etc/xdg"
+	}
+	system := filepath.SplitList(configDirs)
+	for i := len(system) - 1; i >= 0; i-- {
+		dirs = append(dirs, system[i])
+	}
+	home := os.Getenv("XDG_CONFIG_HOME")
+	if home == "" {
+		if userHome, err := os.UserHomeDir(); err == nil {
+			home = filepath.Join(userHome, ".config")
+		}
+	}
+	if home != "" {
+		dirs = append(dirs, home)
+	}
+
+	paths := []string{}
+	for _, dir := range dirs {
+		path := filepath.Join(dir, FileName)
+		if _, err := os.Stat(path); err == nil {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// Load Loads config files, settings of later files override the ones of earlier files
+func Load(paths ...string) (Config, error) {
+	config := Config{
+		settings: map[string]Value{},
+		profiles: map[string]map[string]Value{},
+	}
+	for _, path := range paths {
+		buf, err := ioutil.ReadFile(path)
+		if err != nil {
+			return Config{}, err
+		}
+		file := map[string]interface{}{}
+		if err := yaml.Unmarshal(buf, &file); err != nil {
+			return Config{}, fmt.Errorf("invalid config file %s: %v", path, err)
+		}
+		for name, value := range file {
+			if name != "profiles" {
+				if err := config.set(config.settings, path, name, value); err != nil {
+					return Config{}, err
+				}
+				continue
+			}
+			profiles, ok := value.(map[interface{}]interface{})
+			if !ok {
+				return Config{}, fmt.Errorf("invalid config file %s: profiles must be a map of profile names to settings", path)
+			}
+			for profile, settings := range profiles {
+				profileName := fmt.Sprint(profile)
+				entries, ok := settings.(map[interface{}]interface{})
+				if !ok {
+					return Config{}, fmt.Errorf("invalid config file %s: profile %s must be a map of settings", path, profileName)
+				}
+				if config.profiles[profileName] == nil {
+					config.profiles[profileName] = map[string]Value{}
+				}
+				for name, value := range entries {
+					if err := config.set(config.profiles[profileName], path, fmt.Sprint(name), value); err != nil {
+						return Config{}, err
+					}
+				}
+			}
+		}
+	}
+	return config, nil
+}
+
+func (config Config) set(settings map[string]Value, path string, name string, value interface{}) error {
+	values := []string{}
+	switch value := value.(type) {
+	case []interface{}:
+		for _, item := range value {
+			values = append(values, fmt.Sprint(item))
+		}
+	case map[interface{}]interface{}:
+		return fmt.Errorf("invalid config file %s: %s must be a value or a list of values", path, name)
+	case nil:
+	default:
+		values = append(values, fmt.Sprint(value))
+	}
+	settings[name] = Value{
+		Values: values,
+		Source: path,
+	}
+	return nil
+}
+
+// Resolve Returns the settings with the ones of a profile applied, no profile if it is empty
+func (config Config) Resolve(profile string) (map[string]Value, error) {
+	settings := map[string]Value{}
+	for name, value := range config.settings {
+		settings[name] = value
+	}
+	if profile == "" {
+		return settings, nil
+	}
+	profileSettings, exists := config.profiles[profile]
+	if !exists {
+		return nil, fmt.Errorf("unknown profile: %s", profile)
+	}
+	for name, value := range profileSettings {
+		value.Source = fmt.Sprintf("%s (profile %s)", value.Source, profile)
+		settings[name] = value
+	}
+	return settings, nil
+}
+
+// Profiles Returns the names of the profiles, sorted
+func (config Config) Profiles() []string {
+	profiles := []string{}
+	for profile := range config.profiles {
+		profiles = append(profiles, profile)
+	}
+	sort.Strings(profiles)
+	return profiles
+}
+
+// Redact Hides a secret value, only whether it is set remains visible
+func Redact(value string) string {
+	if value == "" {
+		return ""
+	}
+	return strings.Repeat("*", 8)
+}
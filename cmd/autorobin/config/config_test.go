@@ -0,0 +1,99 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MitchK/autorobin/cmd/autorobin/config"
+	"github.com/onsi/gomega"
+)
+
+// write Writes a config file to dir and returns its path
+func write(t *testing.T, dir string, content string) string {
+	path := filepath.Join(dir, config.FileName)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	system := write(t, t.TempDir(), `
+pv.csvfile: system.csv
+mode: full
+trade.min-value: 5
+profiles:
+  ira:
+    robinhood.account: 5RY67890
+`)
+	user := write(t, t.TempDir(), `
+mode: cashflow
+trade.asset-min-value: [AAPL=100, VTI=50]
+profiles:
+  ira:
+    mode: full
+  roth: {}
+`)
+	file, err := config.Load(system, user)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(file.Profiles()).To(gomega.Equal([]string{"ira", "roth"}))
+
+	// should override settings of earlier files
+	settings, err := file.Resolve("")
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(settings).To(gomega.Equal(map[string]config.Value{
+		"pv.csvfile":            {Values: []string{"system.csv"}, Source: system},
+		"mode":                  {Values: []string{"cashflow"}, Source: user},
+		"trade.min-value":       {Values: []string{"5"}, Source: system},
+		"trade.asset-min-value": {Values: []string{"AAPL=100", "VTI=50"}, Source: user},
+	}))
+
+	// should apply the settings of the profile of all files
+	settings, err = file.Resolve("ira")
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(settings["mode"]).To(gomega.Equal(config.Value{Values: []string{"full"}, Source: user + " (profile ira)"}))
+	g.Expect(settings["robinhood.account"]).To(gomega.Equal(config.Value{Values: []string{"5RY67890"}, Source: system + " (profile ira)"}))
+	g.Expect(settings["pv.csvfile"].Values).To(gomega.Equal([]string{"system.csv"}))
+
+	_, err = file.Resolve("hsa")
+	g.Expect(err).To(gomega.MatchError("unknown profile: hsa"))
+
+	// should reject maps as values
+	invalid := write(t, t.TempDir(), "robinhood:\n  username: me@example.com\n")
+	_, err = config.Load(invalid)
+	g.Expect(err).NotTo(gomega.BeNil())
+	invalid = write(t, t.TempDir(), "profiles: [ira]\n")
+	_, err = config.Load(invalid)
+	g.Expect(err).NotTo(gomega.BeNil())
+	_, err = config.Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	g.Expect(err).NotTo(gomega.BeNil())
+}
+
+func TestPaths(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	first, second, home := t.TempDir(), t.TempDir(), t.TempDir()
+	t.Setenv("XDG_CONFIG_DIRS", first+string(filepath.ListSeparator)+second)
+	t.Setenv("XDG_CONFIG_HOME", home)
+
+	// should have no files before they exist
+	g.Expect(config.Paths()).To(gomega.BeEmpty())
+
+	// should list the system wide files by increasing precedence, then the one of the user
+	paths := []string{write(t, second, ""), write(t, first, ""), write(t, home, "")}
+	g.Expect(config.Paths()).To(gomega.Equal(paths))
+}
+
+func TestRedact(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	g.Expect(config.Redact("hunter2")).To(gomega.Equal("********"))
+	g.Expect(config.Redact("")).To(gomega.Equal(""))
+}
@@ -2,18 +2,37 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
+	"io/ioutil"
 
+	"github.com/MitchK/autorobin/lib/portfolioparser/glidepath"
 	"github.com/MitchK/autorobin/lib/portfolioparser/portfoliovisualizer"
+	"github.com/MitchK/autorobin/lib/portfolioparser/tree"
 
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/MitchK/autorobin/cmd/autorobin/backtest"
+	"github.com/MitchK/autorobin/cmd/autorobin/optimize"
+	"github.com/MitchK/autorobin/cmd/autorobin/output"
 	"github.com/MitchK/autorobin/cmd/autorobin/rebalance"
+	"github.com/MitchK/autorobin/lib/autopilot"
+	"github.com/MitchK/autorobin/lib/credentials"
+	"github.com/MitchK/autorobin/lib/data/tiingo"
+	"github.com/MitchK/autorobin/lib/execution"
+	"github.com/MitchK/autorobin/lib/logging"
 	"github.com/MitchK/autorobin/lib/model"
+	"github.com/MitchK/autorobin/lib/optimizer"
+	"github.com/MitchK/autorobin/lib/weighting"
 
+	"github.com/google/uuid"
 	"github.com/urfave/cli"
+	yaml "gopkg.in/yaml.v2"
 )
 
 const (
@@ -30,37 +49,197 @@ func main() {
 	app.Name = "autorobin"
 	app.Usage = "Backtests and executes portfolio relancing"
 
-	// portfolio file
+	// portfolio file, output format and logging
 	var pvCSVfile string
-	app.Flags = []cli.Flag{
+	var outputFormat string
+	var logLevel string
+	var logFormat string
+	printer, _ := output.NewPrinter(output.FormatText, os.Stdout, os.Stderr)
+	logger := logging.Discard()
+	app.Flags = append([]cli.Flag{
 		cli.StringFlag{
 			Name:        "pv.csvfile, f",
+			EnvVar:      "PV_CSVFILE",
 			Value:       "",
-			Usage:       "Load desired portfolio weights from `FILE` (currently, portfoliovisualizer.com only)",
+			Usage:       "Load desired portfolio weights from `FILE`, a portfoliovisualizer.com CSV export or a YAML tree of asset classes or glide path (.yaml, see README)",
 			Destination: &pvCSVfile,
 		},
+		cli.StringFlag{
+			Name:        "output-format",
+			EnvVar:      "OUTPUT_FORMAT",
+			Value:       output.FormatText,
+			Usage:       "Print results as `FORMAT`: text or json, one JSON document per line while messages and questions go to stderr",
+			Destination: &outputFormat,
+		},
+		cli.StringFlag{
+			Name:        "log-level",
+			EnvVar:      "LOG_LEVEL",
+			Value:       "warn",
+			Usage:       "Log records of at least `LEVEL` to stderr: debug, info, warn, error or off",
+			Destination: &logLevel,
+		},
+		cli.StringFlag{
+			Name:        "log-format",
+			EnvVar:      "LOG_FORMAT",
+			Value:       logging.FormatText,
+			Usage:       "Log records as `FORMAT`: text or json, one JSON object per record",
+			Destination: &logFormat,
+		},
+	}, configFlags...)
+	app.Before = func(c *cli.Context) error {
+		if err := applySettings(c, app.Flags); err != nil {
+			return err
+		}
+		formatPrinter, err := output.NewPrinter(outputFormat, os.Stdout, os.Stderr)
+		if err != nil {
+			return err
+		}
+		printer = formatPrinter
+		runLogger, err := logging.New(os.Stderr, logLevel, logFormat)
+		if err != nil {
+			return err
+		}
+		logger = runLogger.With(logging.KeyRun, uuid.New().String())
+		return nil
 	}
 
-	// backtest command
+	// autopilot options shared by backtest and rebalance
+	var autopilotOptions autopilot.Options
+	var allocator string
+	var mode string
+	var lotMethod string
 	var tiingoToken string
-	var output string
+	var weightingStrategy string
+	autopilotFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:        "tiingo.token, t",
+			Value:       "",
+			EnvVar:      "TIINGO_TOKEN",
+			Usage:       "Tiingo token required to fetch historic data for backtesting and weighting strategies",
+			Destination: &tiingoToken,
+		},
+		cli.StringFlag{
+			Name:        "weighting",
+			EnvVar:      "WEIGHTING",
+			Value:       "static",
+			Usage:       "Weighting `STRATEGY`: static uses the weights of the portfolio file, equal, inverse-volatility, risk-parity or min-variance compute them from the trailing quotes of its assets at every rebalance",
+			Destination: &weightingStrategy,
+		},
+		cli.IntFlag{
+			Name:        "weighting.lookback",
+			EnvVar:      "WEIGHTING_LOOKBACK",
+			Value:       90,
+			Usage:       "Compute the weights of the weighting strategy from the quotes of the last `DAYS` calendar days",
+			Destination: &autopilotOptions.Weighting.Lookback,
+		},
+		cli.StringFlag{
+			Name:        "mode",
+			EnvVar:      "MODE",
+			Value:       "full",
+			Usage:       "Rebalance `MODE`: full buys and sells, cashflow only invests available cash into underweight assets and never sells to rebalance",
+			Destination: &mode,
+		},
+		cli.StringFlag{
+			Name:        "lots",
+			EnvVar:      "LOTS",
+			Usage:       "Tax lots to sell: fifo, lifo, highest-cost or min-gain to realize the lowest gains (default: broker default)",
+			Destination: &lotMethod,
+		},
+		cli.StringFlag{
+			Name:        "allocator",
+			EnvVar:      "ALLOCATOR",
+			Value:       "floor",
+			Usage:       "Whole-share allocation: floor rounds every asset down, optimal minimizes the tracking error to the weights globally",
+			Destination: &allocator,
+		},
+		cli.Float64Flag{
+			Name:        "cash.amount",
+			EnvVar:      "CASH_AMOUNT",
+			Usage:       "Keep a cash reserve of `AMOUNT` dollars out of the market",
+			Destination: &autopilotOptions.CashReserve.Amount,
+		},
+		cli.Float64Flag{
+			Name:        "cash.weight",
+			EnvVar:      "CASH_WEIGHT",
+			Usage:       "Keep a cash reserve of `WEIGHT` (e.g. 0.05) of the total portfolio value out of the market",
+			Destination: &autopilotOptions.CashReserve.Weight,
+		},
+		cli.Float64Flag{
+			Name:        "cash.band",
+			EnvVar:      "CASH_BAND",
+			Usage:       "Tolerate a cash reserve shortfall of `WEIGHT` of the total portfolio value before selling to refill it",
+			Destination: &autopilotOptions.CashReserve.Band,
+		},
+		cli.Float64Flag{
+			Name:        "trade.min-value",
+			EnvVar:      "TRADE_MIN_VALUE",
+			Usage:       "Drop orders with a value below `AMOUNT` dollars",
+			Destination: &autopilotOptions.TradeLimits.MinValue,
+		},
+		cli.Float64Flag{
+			Name:        "trade.min-quantity",
+			EnvVar:      "TRADE_MIN_QUANTITY",
+			Usage:       "Drop orders with less than `QUANTITY` shares",
+			Destination: &autopilotOptions.TradeLimits.MinQuantity,
+		},
+		cli.StringSliceFlag{
+			Name:  "trade.asset-min-value",
+			Usage: "Drop orders of an asset with a value below the given amount, e.g. AAPL=100 (overrides --trade.min-value and --trade.min-quantity for the asset)",
+		},
+		cli.StringSliceFlag{
+			Name:  "trade.asset-min-quantity",
+			Usage: "Drop orders of an asset with less than the given shares, e.g. AAPL=2 (overrides --trade.min-value and --trade.min-quantity for the asset)",
+		},
+		cli.StringSliceFlag{
+			Name:  "harvest.substitute",
+			Usage: "Harvest losses of an asset and buy the given substitute instead, e.g. VOO=VTI (enables tax-loss harvesting)",
+		},
+		cli.Float64Flag{
+			Name:        "harvest.min-loss",
+			EnvVar:      "HARVEST_MIN_LOSS",
+			Usage:       "Only harvest unrealized losses of at least `AMOUNT` dollars",
+			Destination: &autopilotOptions.Harvest.MinLoss,
+		},
+		cli.Float64Flag{
+			Name:        "harvest.min-loss-ratio",
+			EnvVar:      "HARVEST_MIN_LOSS_RATIO",
+			Usage:       "Only harvest unrealized losses of at least `RATIO` (e.g. 0.05) of the cost basis",
+			Destination: &autopilotOptions.Harvest.MinLossRatio,
+		},
+		cli.IntFlag{
+			Name:        "trade.max-orders",
+			EnvVar:      "TRADE_MAX_ORDERS",
+			Usage:       "Create at most `COUNT` orders per rebalance, keeping the ones with the highest value, 0 means unlimited",
+			Destination: &autopilotOptions.TradeLimits.MaxOrders,
+		},
+	}
+
+	// backtest command
+	var outputDir string
+	var deposits backtest.Deposits
 	backtest := cli.Command{
-		Flags: []cli.Flag{
-			cli.StringFlag{
-				Name:        "tiingo.token, t",
-				Value:       "",
-				EnvVar:      "TIINGO_TOKEN",
-				Usage:       "Tiingo token required to fetch historic data for backtesting",
-				Destination: &tiingoToken,
-			},
+		Flags: append([]cli.Flag{
 			cli.StringFlag{
 				Name:        "output, o",
 				EnvVar:      "OUTPUT",
 				Value:       "",
 				Usage:       "Backtest output directory `DIR` (default: current dir)",
-				Destination: &output,
+				Destination: &outputDir,
 			},
-		},
+			cli.Float64Flag{
+				Name:        "deposit",
+				EnvVar:      "DEPOSIT",
+				Usage:       "Deposit `AMOUNT` dollars periodically",
+				Destination: &deposits.Amount,
+			},
+			cli.IntFlag{
+				Name:        "deposit-interval",
+				EnvVar:      "DEPOSIT_INTERVAL",
+				Value:       21,
+				Usage:       "Deposit every `PERIODS` trading days",
+				Destination: &deposits.Interval,
+			},
+		}, autopilotFlags...),
 		Name:    "backtest",
 		Aliases: []string{"b"},
 		Usage:   "backtest portfolio weights",
@@ -71,33 +250,55 @@ func main() {
 			if tiingoToken == "" {
 				return errors.New("No Tiingo token provided")
 			}
-			weights, assets, err := parsePVFile(pvCSVfile)
+			portfolio, err := parsePortfolioFile(pvCSVfile)
 			if err != nil {
 				return nil
 			}
-			return backtest.Run(weights, assets, tiingoToken, output)
+			autopilotOptions.Allocation = portfolio.allocation
+			autopilotOptions.Schedule = portfolio.schedule
+			autopilotOptions.Weighting.Strategy, err = parseWeighting(weightingStrategy)
+			if err != nil {
+				return err
+			}
+			autopilotOptions.TradeLimits.Assets, err = parseAssetTradeLimits(c)
+			if err != nil {
+				return err
+			}
+			autopilotOptions.Allocator, err = parseAllocator(allocator)
+			if err != nil {
+				return err
+			}
+			autopilotOptions.Mode, err = parseMode(mode)
+			if err != nil {
+				return err
+			}
+			autopilotOptions.LotMethod, err = parseLotMethod(lotMethod)
+			if err != nil {
+				return err
+			}
+			autopilotOptions.Harvest.Substitutes, err = parseSubstitutes(c)
+			if err != nil {
+				return err
+			}
+			autopilotOptions.Logger = logger
+			return backtest.Run(portfolio.weights, portfolio.assets, tiingoToken, outputDir, autopilotOptions, deposits, printer)
 		},
 	}
 
 	// rebalance command
-	var robinhoodUsername string
-	var robinhoodPassword string
 	var proceed bool
+	var openOrdersPolicy string
+	var executionOptions execution.Options
+	var taxOptions rebalance.TaxOptions
+	var accountsPath string
+	var untargetedPolicy string
 	rebalance := cli.Command{
-		Flags: []cli.Flag{
-			cli.StringFlag{
-				Name:        "robinhood.username, u",
-				EnvVar:      "ROBINHOOD_USERNAME",
-				Value:       "",
-				Usage:       "Robinhood login username",
-				Destination: &robinhoodUsername,
-			},
+		Flags: append([]cli.Flag{
 			cli.StringFlag{
-				Name:        "robinhood.password, p",
-				EnvVar:      "ROBINHOOD_PASSWORD",
-				Value:       "",
-				Usage:       "Robinhood login username",
-				Destination: &robinhoodPassword,
+				Name:        "accounts",
+				EnvVar:      "ACCOUNTS",
+				Usage:       "Rebalance all accounts of the accounts `FILE` with one household allocation (see README)",
+				Destination: &accountsPath,
 			},
 			cli.BoolFlag{
 				Name:        "proceed, y",
@@ -105,7 +306,77 @@ func main() {
 				Usage:       "If set to true, it disables the order placement confirmation",
 				Destination: &proceed,
 			},
-		},
+			cli.StringFlag{
+				Name:        "open-orders",
+				EnvVar:      "OPEN_ORDERS",
+				Value:       rebalance.OpenOrdersAsk,
+				Usage:       "What to do with orders of previous runs that are still open: ask, cancel, net or abort",
+				Destination: &openOrdersPolicy,
+			},
+			cli.DurationFlag{
+				Name:        "execution.deadline",
+				EnvVar:      "EXECUTION_DEADLINE",
+				Usage:       "Watch and reprice orders for `DURATION` before unfilled ones are cancelled, 0 only submits them",
+				Destination: &executionOptions.Deadline,
+			},
+			cli.DurationFlag{
+				Name:        "execution.reprice-after",
+				EnvVar:      "EXECUTION_REPRICE_AFTER",
+				Value:       time.Minute,
+				Usage:       "Cancel and reprice orders that are unfilled after `DURATION`",
+				Destination: &executionOptions.RepriceAfter,
+			},
+			cli.Float64Flag{
+				Name:        "execution.max-slippage",
+				EnvVar:      "EXECUTION_MAX_SLIPPAGE",
+				Value:       0.01,
+				Usage:       "Maximum relative `SLIPPAGE` from the original limit price when repricing",
+				Destination: &executionOptions.MaxSlippage,
+			},
+			cli.StringFlag{
+				Name:        "untargeted",
+				EnvVar:      "UNTARGETED",
+				Value:       "ignore",
+				Usage:       "`POLICY` for holdings that are not part of the portfolio file: ignore them, include their value in the portfolio value without trading them, or liquidate them into the portfolio",
+				Destination: &untargetedPolicy,
+			},
+			cli.Float64Flag{
+				Name:        "untargeted.rate",
+				EnvVar:      "UNTARGETED_RATE",
+				Usage:       "Sell `RATE` (e.g. 0.25) of every untargeted holding per rebalance with --untargeted liquidate, all of it if not set",
+				Destination: &autopilotOptions.Untargeted.Rate,
+			},
+			cli.Float64Flag{
+				Name:        "withdraw",
+				EnvVar:      "WITHDRAW",
+				Usage:       "Raise `AMOUNT` dollars of cash for a withdrawal, selling stocks if the available cash does not cover it",
+				Destination: &autopilotOptions.Withdrawal,
+			},
+			cli.Float64Flag{
+				Name:        "tax.short-term-rate",
+				EnvVar:      "TAX_SHORT_TERM_RATE",
+				Usage:       "Federal tax `RATE` (e.g. 0.24) on short-term gains and gains of unknown term, to estimate the tax of a plan",
+				Destination: &taxOptions.Rates.ShortTerm,
+			},
+			cli.Float64Flag{
+				Name:        "tax.long-term-rate",
+				EnvVar:      "TAX_LONG_TERM_RATE",
+				Usage:       "Federal tax `RATE` (e.g. 0.15) on long-term gains, to estimate the tax of a plan",
+				Destination: &taxOptions.Rates.LongTerm,
+			},
+			cli.Float64Flag{
+				Name:        "tax.state-rate",
+				EnvVar:      "TAX_STATE_RATE",
+				Usage:       "State tax `RATE` on all gains, to estimate the tax of a plan",
+				Destination: &taxOptions.Rates.State,
+			},
+			cli.Float64Flag{
+				Name:        "tax.max-gain",
+				EnvVar:      "TAX_MAX_GAIN",
+				Usage:       "Do not execute plans with estimated realized gains above `AMOUNT` dollars, no limit if not set",
+				Destination: &taxOptions.MaxGain,
+			},
+		}, append(brokerFlags(), autopilotFlags...)...),
 		Name:    "rebalance",
 		Aliases: []string{"r"},
 		Usage:   "performs a rebalance of the portfolio on your account",
@@ -113,36 +384,512 @@ func main() {
 			if pvCSVfile == "" {
 				return errors.New("No PortfolioVisualizer csv file provided")
 			}
-			weights, assets, err := parsePVFile(pvCSVfile)
+			portfolio, err := parsePortfolioFile(pvCSVfile)
+			if err != nil {
+				return err
+			}
+			configs, err := brokerConfigs(c)
+			if err != nil {
+				return err
+			}
+			autopilotOptions.TradeLimits.Assets, err = parseAssetTradeLimits(c)
+			if err != nil {
+				return err
+			}
+			autopilotOptions.Allocator, err = parseAllocator(allocator)
+			if err != nil {
+				return err
+			}
+			autopilotOptions.Mode, err = parseMode(mode)
+			if err != nil {
+				return err
+			}
+			autopilotOptions.LotMethod, err = parseLotMethod(lotMethod)
+			if err != nil {
+				return err
+			}
+			autopilotOptions.Harvest.Substitutes, err = parseSubstitutes(c)
+			if err != nil {
+				return err
+			}
+			autopilotOptions.Untargeted.Policy, err = parseUntargetedPolicy(untargetedPolicy)
+			if err != nil {
+				return err
+			}
+			autopilotOptions.Weighting.Strategy, err = parseWeighting(weightingStrategy)
+			if err != nil {
+				return err
+			}
+			if autopilotOptions.Weighting.IsEnabled() && tiingoToken == "" {
+				return errors.New("No Tiingo token provided, weighting strategies require historic data")
+			}
+			autopilotOptions.Weighting.History = tiingo.NewAdapter(tiingoToken)
+			taxOptions.LimitGain = c.IsSet("tax.max-gain")
+			if accountsPath != "" {
+				// the household splits the flat weights of today among its accounts, bands are not applied
+				if autopilotOptions.Weighting.IsEnabled() {
+					if portfolio.schedule != nil {
+						return errors.New("a weighting strategy cannot be combined with a glide path")
+					}
+					portfolio.weights, err = autopilotOptions.Weighting.Weights(time.Now(), portfolio.assets)
+					if err != nil {
+						return err
+					}
+					autopilotOptions.Weighting = autopilot.Weighting{}
+				}
+				return rebalance.RunHousehold(portfolio.weights, portfolio.assets, accountsPath, configs, proceed, openOrdersPolicy, autopilotOptions, executionOptions, taxOptions, printer, logger)
+			}
+			autopilotOptions.Allocation = portfolio.allocation
+			autopilotOptions.Schedule = portfolio.schedule
+			return rebalance.Run(portfolio.weights, portfolio.assets, c.String("broker"), configs[c.String("broker")], proceed, openOrdersPolicy, autopilotOptions, executionOptions, taxOptions, printer, logger)
+		},
+	}
+
+	// status command
+	status := cli.Command{
+		Name:    "status",
+		Aliases: []string{"s"},
+		Usage:   "shows the holdings of your account compared to the target portfolio",
+		Flags:   brokerFlags(),
+		Action: func(c *cli.Context) error {
+			if pvCSVfile == "" {
+				return errors.New("No PortfolioVisualizer csv file provided")
+			}
+			portfolio, err := parsePortfolioFile(pvCSVfile)
 			if err != nil {
 				return err
 			}
-			if robinhoodUsername == "" {
-				return errors.New("No Robinhood username provided")
+			configs, err := brokerConfigs(c)
+			if err != nil {
+				return err
+			}
+			return showStatus(portfolio.weights, portfolio.assets, portfolio.allocation, c.String("broker"), configs[c.String("broker")], printer, logger)
+		},
+	}
+
+	// optimize command
+	var optimizerOptions optimizer.Options
+	var from string
+	var to string
+	optimize := cli.Command{
+		Name:      "optimize",
+		Aliases:   []string{"o"},
+		Usage:     "computes the efficient frontier of tickers and saves the max-Sharpe and min-variance portfolios as portfolio files",
+		ArgsUsage: "[TICKER...] (default: the assets of the portfolio file)",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:        "tiingo.token, t",
+				Value:       "",
+				EnvVar:      "TIINGO_TOKEN",
+				Usage:       "Tiingo token required to fetch historic data",
+				Destination: &tiingoToken,
+			},
+			cli.StringFlag{
+				Name:        "output, o",
+				EnvVar:      "OUTPUT",
+				Value:       "",
+				Usage:       "Output directory `DIR` of the portfolio files and the chart (default: current dir)",
+				Destination: &outputDir,
+			},
+			cli.StringFlag{
+				Name:        "from",
+				EnvVar:      "FROM",
+				Usage:       "Estimate returns and covariances from the quotes since `DATE`, e.g. 2015-01-01 (default: 5 years ago)",
+				Destination: &from,
+			},
+			cli.StringFlag{
+				Name:        "to",
+				EnvVar:      "TO",
+				Usage:       "Estimate returns and covariances from the quotes until `DATE` (default: today)",
+				Destination: &to,
+			},
+			cli.Float64Flag{
+				Name:        "min-weight",
+				EnvVar:      "MIN_WEIGHT",
+				Usage:       "Give every ticker a weight of at least `WEIGHT`, e.g. 0.05",
+				Destination: &optimizerOptions.MinWeight,
+			},
+			cli.Float64Flag{
+				Name:        "max-weight",
+				EnvVar:      "MAX_WEIGHT",
+				Value:       1,
+				Usage:       "Give every ticker a weight of at most `WEIGHT`, e.g. 0.4",
+				Destination: &optimizerOptions.MaxWeight,
+			},
+			cli.Float64Flag{
+				Name:        "risk-free",
+				EnvVar:      "RISK_FREE",
+				Usage:       "Annual risk-free `RATE` of the Sharpe ratio, e.g. 0.02",
+				Destination: &optimizerOptions.RiskFree,
+			},
+			cli.IntFlag{
+				Name:        "points",
+				EnvVar:      "POINTS",
+				Value:       50,
+				Usage:       "Plot `COUNT` portfolios of the efficient frontier",
+				Destination: &optimizerOptions.Points,
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if tiingoToken == "" {
+				return errors.New("No Tiingo token provided")
+			}
+			assets := []model.Asset{}
+			for _, ticker := range c.Args() {
+				assets = append(assets, model.Asset{Symbol: strings.ToUpper(strings.TrimSpace(ticker))})
 			}
-			if robinhoodPassword == "" {
-				return errors.New("No Robinhood password provided")
+			if len(assets) == 0 && pvCSVfile != "" {
+				portfolio, err := parsePortfolioFile(pvCSVfile)
+				if err != nil {
+					return err
+				}
+				assets = portfolio.assets
 			}
-			return rebalance.Run(weights, assets, robinhoodUsername, robinhoodPassword, proceed)
+			end, err := parseDate(to, time.Now())
+			if err != nil {
+				return err
+			}
+			start, err := parseDate(from, end.AddDate(-5, 0, 0))
+			if err != nil {
+				return err
+			}
+			return optimize.Run(assets, start, end, tiingoToken, outputDir, optimizerOptions, printer)
 		},
 	}
 
-	app.Commands = []cli.Command{
+	// paper command
+	paper := cli.Command{
+		Name:  "paper",
+		Usage: "manages the simulated account of --broker paper",
+		Subcommands: []cli.Command{
+			{
+				Name:      "deposit",
+				Usage:     "deposits cash into the account",
+				ArgsUsage: "AMOUNT",
+				Flags:     paperFlags(),
+				Action: func(c *cli.Context) error {
+					amount, err := parseAmount(c)
+					if err != nil {
+						return err
+					}
+					account, err := openPaper(c, logger)
+					if err != nil {
+						return err
+					}
+					if err := account.Deposit(amount); err != nil {
+						return err
+					}
+					return printCash(account, printer)
+				},
+			},
+			{
+				Name:      "withdraw",
+				Usage:     "withdraws cash from the account",
+				ArgsUsage: "AMOUNT",
+				Flags:     paperFlags(),
+				Action: func(c *cli.Context) error {
+					amount, err := parseAmount(c)
+					if err != nil {
+						return err
+					}
+					account, err := openPaper(c, logger)
+					if err != nil {
+						return err
+					}
+					if err := account.Withdraw(amount); err != nil {
+						return err
+					}
+					return printCash(account, printer)
+				},
+			},
+			{
+				Name:  "reset",
+				Usage: "replaces the account by a new one with --paper.cash, prices are kept",
+				Flags: paperFlags(),
+				Action: func(c *cli.Context) error {
+					account, err := openPaper(c, logger)
+					if err != nil {
+						return err
+					}
+					if err := account.Reset(); err != nil {
+						return err
+					}
+					return printCash(account, printer)
+				},
+			},
+		},
+	}
+
+	// credentials command
+	var credentialFile string
+	var credentialPassphrase string
+	credentialsCommand := cli.Command{
+		Name:  "credentials",
+		Usage: "stores broker passwords in the OS keyring or an encrypted file",
+		Subcommands: []cli.Command{
+			{
+				Name:      "store",
+				Usage:     "asks for the password of a broker login and stores it, e.g. autorobin credentials store robinhood me@example.com",
+				ArgsUsage: "BROKER USERNAME",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:        "file",
+						EnvVar:      "CREDENTIAL_FILE",
+						Usage:       "Store the password in the encrypted `FILE` instead of the OS keyring",
+						Destination: &credentialFile,
+					},
+					cli.StringFlag{
+						Name:        "passphrase",
+						EnvVar:      "CREDENTIAL_PASSPHRASE",
+						Usage:       "Passphrase of the encrypted file, asked for if not set",
+						Destination: &credentialPassphrase,
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 2 {
+						return errors.New("expected the arguments BROKER USERNAME")
+					}
+					service, username := c.Args().Get(0), c.Args().Get(1)
+					var store credentials.Store = credentials.NewKeyring()
+					if credentialFile != "" {
+						store = credentials.NewFile(credentialFile, credentials.Passphrase(credentialPassphrase, "Passphrase of "+credentialFile))
+					}
+					password, err := credentials.Prompt(fmt.Sprintf("Password of %s at %s", username, service))
+					if err != nil {
+						return err
+					}
+					if password == "" {
+						return errors.New("no password provided")
+					}
+					if err := store.Set(service, username, password); err != nil {
+						return err
+					}
+					printer.Printf("Stored the password of %s at %s\n", username, service)
+					return nil
+				},
+			},
+		},
+	}
+
+	// config command
+	configCommand := cli.Command{
+		Name:  "config",
+		Usage: "shows the settings of the config file",
+		Subcommands: []cli.Command{
+			{
+				Name:      "show",
+				Usage:     "prints the effective settings of a command with secrets redacted, e.g. autorobin --profile ira config show rebalance",
+				ArgsUsage: "[COMMAND [SUBCOMMAND]]",
+				Action: func(c *cli.Context) error {
+					settings, err := loadSettings(c)
+					if err != nil {
+						return err
+					}
+					flags := append([]cli.Flag{}, app.Flags...)
+					commands := app.Commands
+					for _, name := range c.Args() {
+						var command *cli.Command
+						for i := range commands {
+							if commands[i].HasName(name) {
+								command = &commands[i]
+							}
+						}
+						if command == nil {
+							return fmt.Errorf("unknown command: %s", name)
+						}
+						flags = append(flags, command.Flags...)
+						commands = command.Subcommands
+					}
+					return printer.Print(showSettings(flags, settings))
+				},
+			},
+		},
+	}
+
+	app.Commands = withSettings([]cli.Command{
 		backtest,
 		rebalance,
-	}
+		status,
+		optimize,
+		paper,
+		credentialsCommand,
+		configCommand,
+	})
 	err := app.Run(os.Args)
 	if err != nil {
-		fmt.Println(err)
+		logger.Error("command failed", "error", err)
+		printer.Print(output.Error{Error: err.Error()})
 		os.Exit(1)
 	}
 }
 
-func parsePVFile(path string) (model.Weights, []model.Asset, error) {
-	csvFile, err := os.Open(path)
+// portfolioFile Target portfolio of a portfolio file
+type portfolioFile struct {
+	weights model.Weights
+	assets  []model.Asset
+
+	// allocation Tree of asset classes, only set for YAML trees
+	allocation *model.Allocation
+
+	// schedule Target weights that change over time, only set for YAML glide paths. The weights are the ones of today.
+	schedule model.Schedule
+}
+
+// parsePortfolioFile Parses a portfoliovisualizer.com CSV export, a YAML tree of asset classes or a YAML glide path
+func parsePortfolioFile(path string) (portfolioFile, error) {
+	file, err := os.Open(path)
 	if err != nil {
-		return model.Weights{}, []model.Asset{}, err
+		return portfolioFile{}, err
+	}
+	defer file.Close()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		data, err := ioutil.ReadAll(file)
+		if err != nil {
+			return portfolioFile{}, err
+		}
+		var keys map[string]interface{}
+		if err := yaml.Unmarshal(data, &keys); err != nil {
+			return portfolioFile{}, fmt.Errorf("yaml parser: %v", err)
+		}
+		_, waypoints := keys["waypoints"]
+		_, age := keys["age"]
+		if waypoints || age {
+			schedule, err := glidepath.NewParser().ParseSchedule(bytes.NewReader(data))
+			if err != nil {
+				return portfolioFile{}, err
+			}
+			return portfolioFile{weights: schedule.Weights(time.Now()), assets: schedule.Assets(), schedule: schedule}, nil
+		}
+		allocation, err := tree.NewParser().ParseAllocation(bytes.NewReader(data))
+		if err != nil {
+			return portfolioFile{}, err
+		}
+		return portfolioFile{weights: allocation.Weights(), assets: allocation.Members(), allocation: &allocation}, nil
 	}
 	parser := portfoliovisualizer.NewParser()
-	return parser.Parse(bufio.NewReader(csvFile))
+	weights, assets, err := parser.Parse(bufio.NewReader(file))
+	return portfolioFile{weights: weights, assets: assets}, err
+}
+
+// parseAssetTradeLimits Parses the per asset trade limits of the form SYMBOL=VALUE
+func parseAssetTradeLimits(c *cli.Context) (map[model.Asset]autopilot.TradeLimit, error) {
+	limits := map[model.Asset]autopilot.TradeLimit{}
+	for _, flag := range []string{"trade.asset-min-value", "trade.asset-min-quantity"} {
+		for _, str := range c.StringSlice(flag) {
+			parts := strings.SplitN(str, "=", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("invalid value %q for --%s, expected SYMBOL=VALUE", str, flag)
+			}
+			value, err := strconv.ParseFloat(parts[1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q for --%s: %s", str, flag, err)
+			}
+			asset := model.Asset{
+				Symbol: strings.TrimSpace(parts[0]),
+			}
+			limit := limits[asset]
+			if flag == "trade.asset-min-value" {
+				limit.MinValue = value
+			} else {
+				limit.MinQuantity = value
+			}
+			limits[asset] = limit
+		}
+	}
+	return limits, nil
+}
+
+func parseSubstitutes(c *cli.Context) (map[model.Asset]model.Asset, error) {
+	substitutes := map[model.Asset]model.Asset{}
+	for _, str := range c.StringSlice("harvest.substitute") {
+		parts := strings.SplitN(str, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid value %q for --harvest.substitute, expected SYMBOL=SUBSTITUTE", str)
+		}
+		asset := model.Asset{
+			Symbol: strings.TrimSpace(parts[0]),
+		}
+		substitutes[asset] = model.Asset{
+			Symbol: strings.TrimSpace(parts[1]),
+		}
+	}
+	return substitutes, nil
+}
+
+func parseAllocator(name string) (autopilot.Allocator, error) {
+	switch name {
+	case "floor":
+		return nil, nil
+	case "optimal":
+		return autopilot.NewOptimalAllocator(), nil
+	}
+	return nil, fmt.Errorf("invalid allocator: %s", name)
+}
+
+// parseWeighting Returns the weighting strategy of the name, nil for the static weights of the portfolio file
+func parseWeighting(name string) (weighting.Strategy, error) {
+	switch name {
+	case "static":
+		return nil, nil
+	case "equal":
+		return weighting.NewEqualWeight(), nil
+	case "inverse-volatility":
+		return weighting.NewInverseVolatility(), nil
+	case "risk-parity":
+		return weighting.NewRiskParity(), nil
+	case "min-variance":
+		return weighting.NewMinimumVariance(), nil
+	}
+	return nil, fmt.Errorf("invalid weighting strategy: %s", name)
+}
+
+// parseDate Parses a date of the form 2006-01-02, the default is returned for an empty string
+func parseDate(str string, defaultDate time.Time) (time.Time, error) {
+	if str == "" {
+		return defaultDate, nil
+	}
+	date, err := time.Parse("2006-01-02", str)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", str)
+	}
+	return date, nil
+}
+
+func parseMode(name string) (autopilot.Mode, error) {
+	switch name {
+	case "full":
+		return autopilot.ModeFull, nil
+	case "cashflow":
+		return autopilot.ModeCashFlow, nil
+	}
+	return 0, fmt.Errorf("invalid mode: %s", name)
+}
+
+func parseUntargetedPolicy(name string) (autopilot.UntargetedPolicy, error) {
+	switch name {
+	case "ignore":
+		return autopilot.UntargetedIgnore, nil
+	case "include":
+		return autopilot.UntargetedInclude, nil
+	case "liquidate":
+		return autopilot.UntargetedLiquidate, nil
+	}
+	return 0, fmt.Errorf("invalid untargeted policy: %s", name)
+}
+
+func parseLotMethod(name string) (model.LotMethod, error) {
+	switch name {
+	case "":
+		return 0, nil
+	case "fifo":
+		return model.LotMethodFIFO, nil
+	case "lifo":
+		return model.LotMethodLIFO, nil
+	case "highest-cost":
+		return model.LotMethodHighestCost, nil
+	case "min-gain":
+		return model.LotMethodMinimumGain, nil
+	}
+	return 0, fmt.Errorf("invalid lot method: %s", name)
 }
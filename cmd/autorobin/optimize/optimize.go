@@ -0,0 +1,179 @@
+package optimize
+
+import (
+	"errors"
+	"io/ioutil"
+	"math"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/MitchK/autorobin/cmd/autorobin/output"
+	"github.com/MitchK/autorobin/lib/data/tiingo"
+	"github.com/MitchK/autorobin/lib/model"
+	"github.com/MitchK/autorobin/lib/optimizer"
+	"github.com/MitchK/autorobin/lib/portfolioparser/tree"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+)
+
+// Run Computes the efficient frontier of the assets from their quotes between the dates, saves the maximum Sharpe ratio
+// and minimum variance portfolios as portfolio files and plots the frontier
+func Run(assets []model.Asset, from time.Time, to time.Time, tiingoToken string, outputDir string, options optimizer.Options, printer *output.Printer) error {
+	if len(assets) < 2 {
+		return errors.New("at least 2 tickers are required")
+	}
+	if !from.Before(to) {
+		return errors.New("start date must be before the end date")
+	}
+
+	printer.Printf("Fetching quote data from Tiingo...\n")
+	adapter := tiingo.NewAdapter(tiingoToken)
+	history, err := adapter.GetDailyAsc(from, to, assets...)
+	if err != nil {
+		return err
+	}
+	estimates, err := optimizer.Estimate(assets, history)
+	if err != nil {
+		return err
+	}
+
+	printer.Printf("Optimizing...\n")
+	frontier, err := optimizer.Optimize(estimates, options)
+	if err != nil {
+		return err
+	}
+
+	document := output.Optimization{
+		From:  from.Format(tiingo.DateFormat),
+		To:    to.Format(tiingo.DateFormat),
+		Chart: path.Join(outputDir, "frontier.png"),
+	}
+	for _, named := range []struct {
+		name      string
+		file      string
+		portfolio optimizer.Portfolio
+	}{
+		{"MAX-SHARPE", "max-sharpe.yaml", frontier.MaxSharpe},
+		{"MIN-VARIANCE", "min-variance.yaml", frontier.MinVariance},
+	} {
+		portfolio, err := save(named.portfolio, assets, path.Join(outputDir, named.file))
+		if err != nil {
+			return err
+		}
+		portfolio.Name = named.name
+		document.Portfolios = append(document.Portfolios, portfolio)
+	}
+
+	if err := plotFrontier(frontier, estimates, document.Chart); err != nil {
+		return err
+	}
+	return printer.Print(document)
+}
+
+// save Writes the weights of the portfolio as a YAML file with one class per asset, the weights are rounded to 0.01%
+// and assets without weight are left out
+func save(portfolio optimizer.Portfolio, assets []model.Asset, file string) (output.OptimizedPortfolio, error) {
+	optimized := output.OptimizedPortfolio{
+		Return:     portfolio.Return,
+		Volatility: portfolio.Volatility,
+		Sharpe:     portfolio.Sharpe,
+		Weights:    []output.AssetWeight{},
+		File:       file,
+	}
+	rounded := model.Weights{}
+	var largest model.Asset
+	var sum float64
+	for _, asset := range assets {
+		rounded[asset] = math.Round(portfolio.Weights[asset]*1e4) / 1e4
+		sum += rounded[asset]
+		if rounded[asset] > rounded[largest] {
+			largest = asset
+		}
+	}
+	// the rounding error goes to the largest weight, so the weights add up to 1
+	rounded[largest] = math.Round((rounded[largest]+1-sum)*1e4) / 1e4
+
+	allocation := model.Allocation{Weight: 1}
+	for _, asset := range assets {
+		if rounded[asset] <= 0 {
+			continue
+		}
+		allocation.Classes = append(allocation.Classes, model.Allocation{
+			Name:   asset.Symbol,
+			Weight: rounded[asset],
+			Assets: []model.Asset{asset},
+		})
+		optimized.Weights = append(optimized.Weights, output.AssetWeight{Symbol: asset.Symbol, Weight: rounded[asset]})
+	}
+	sort.SliceStable(optimized.Weights, func(i, j int) bool {
+		return optimized.Weights[i].Weight > optimized.Weights[j].Weight
+	})
+	data, err := tree.Marshal(allocation)
+	if err != nil {
+		return output.OptimizedPortfolio{}, err
+	}
+	return optimized, ioutil.WriteFile(file, data, 0644)
+}
+
+// plotFrontier Plots the expected return over the volatility of the frontier, the single assets and the two portfolios
+func plotFrontier(frontier optimizer.Frontier, estimates optimizer.Estimates, file string) error {
+	p, err := plot.New()
+	if err != nil {
+		return err
+	}
+	p.Title.Text = "Efficient frontier"
+	p.X.Label.Text = "Volatility"
+	p.Y.Label.Text = "Expected return"
+
+	points := make(plotter.XYs, len(frontier.Portfolios))
+	for i, portfolio := range frontier.Portfolios {
+		points[i].X = portfolio.Volatility
+		points[i].Y = portfolio.Return
+	}
+	line, err := plotter.NewLine(points)
+	if err != nil {
+		return err
+	}
+	p.Add(line)
+	p.Legend.Add("Frontier", line)
+
+	assetPoints := make(plotter.XYs, len(estimates.Assets))
+	labels := make([]string, len(estimates.Assets))
+	for i, asset := range estimates.Assets {
+		assetPoints[i].X = math.Sqrt(estimates.Covariance.At(i, i))
+		assetPoints[i].Y = estimates.Returns.AtVec(i)
+		labels[i] = asset.Symbol
+	}
+	assetLabels, err := plotter.NewLabels(plotter.XYLabels{XYs: assetPoints, Labels: labels})
+	if err != nil {
+		return err
+	}
+	assetScatter, err := plotter.NewScatter(assetPoints)
+	if err != nil {
+		return err
+	}
+	p.Add(assetScatter, assetLabels)
+	p.Legend.Add("Assets", assetScatter)
+
+	for _, named := range []struct {
+		name      string
+		shape     draw.GlyphDrawer
+		portfolio optimizer.Portfolio
+	}{
+		{"Max Sharpe", draw.TriangleGlyph{}, frontier.MaxSharpe},
+		{"Min variance", draw.SquareGlyph{}, frontier.MinVariance},
+	} {
+		scatter, err := plotter.NewScatter(plotter.XYs{{X: named.portfolio.Volatility, Y: named.portfolio.Return}})
+		if err != nil {
+			return err
+		}
+		scatter.GlyphStyle.Shape = named.shape
+		scatter.GlyphStyle.Radius = vg.Points(4)
+		p.Add(scatter)
+		p.Legend.Add(named.name, scatter)
+	}
+	return p.Save(20*vg.Centimeter, 15*vg.Centimeter, file)
+}
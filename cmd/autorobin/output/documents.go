@@ -0,0 +1,794 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/MitchK/autorobin/lib/execution"
+	"github.com/MitchK/autorobin/lib/model"
+	"github.com/MitchK/autorobin/lib/tax"
+)
+
+// Order Order of a document
+type Order struct {
+	ID          string  `json:"id,omitempty"`
+	Side        string  `json:"side"`
+	Symbol      string  `json:"symbol"`
+	Quantity    float64 `json:"quantity"`
+	Price       float64 `json:"price"`
+	Description string  `json:"description,omitempty"`
+
+	// FilledQuantity Quantity of an open order that was filled already
+	FilledQuantity float64 `json:"filled_quantity,omitempty"`
+
+	// EstimatedGain Estimated realized gain of a sale
+	EstimatedGain *Gains `json:"estimated_gain,omitempty"`
+}
+
+// NewOrder NewOrder
+func NewOrder(order model.Order) Order {
+	side := "buy"
+	if order.Type == model.OrderTypeSell {
+		side = "sell"
+	}
+	return Order{
+		ID:             order.ID,
+		Side:           side,
+		Symbol:         order.Asset.Symbol,
+		Quantity:       order.Quantity,
+		Price:          order.Price,
+		Description:    order.Description,
+		FilledQuantity: order.FilledQuantity,
+	}
+}
+
+func newOrders(orders []model.Order) []Order {
+	result := make([]Order, len(orders))
+	for i, order := range orders {
+		result[i] = NewOrder(order)
+	}
+	return result
+}
+
+// note Returns the estimated gain of the order as text, empty if there is none
+func (order Order) note() string {
+	gain := order.EstimatedGain
+	switch {
+	case gain == nil:
+		return ""
+	case gain.UnknownTerm != 0:
+		return fmt.Sprintf("estimated gain %.2f, term unknown", gain.UnknownTerm)
+	case gain.ShortTerm != 0 && gain.LongTerm != 0:
+		return fmt.Sprintf("estimated gain %.2f short-term and %.2f long-term", gain.ShortTerm, gain.LongTerm)
+	case gain.LongTerm != 0:
+		return fmt.Sprintf("estimated gain %.2f long-term", gain.LongTerm)
+	}
+	return fmt.Sprintf("estimated gain %.2f short-term", gain.ShortTerm)
+}
+
+// writeOrders Writes the orders with their remaining quantity, followed by the estimated gain of the order
+func writeOrders(w io.Writer, orders []Order) {
+	for i, order := range orders {
+		note := ""
+		if str := order.note(); str != "" {
+			note = " (" + str + ")"
+		}
+		fmt.Fprintf(w, "[%d]: %s %v x %s @ %v%s\n", i, strings.ToUpper(order.Side), order.Quantity-order.FilledQuantity, order.Symbol, order.Price, note)
+	}
+}
+
+// DroppedOrder Order that was dropped from a plan and the reason why
+type DroppedOrder struct {
+	Order
+	Reason string `json:"reason"`
+}
+
+func newDroppedOrders(dropped []model.DroppedOrder) []DroppedOrder {
+	result := make([]DroppedOrder, len(dropped))
+	for i, order := range dropped {
+		result[i] = DroppedOrder{
+			Order:  NewOrder(order.Order),
+			Reason: order.Reason,
+		}
+	}
+	return result
+}
+
+// Gains Realized gains by term
+type Gains struct {
+	ShortTerm   float64 `json:"short_term"`
+	LongTerm    float64 `json:"long_term"`
+	UnknownTerm float64 `json:"unknown_term"`
+	Losses      float64 `json:"losses"`
+	Total       float64 `json:"total"`
+}
+
+// NewGains NewGains
+func NewGains(summary tax.Summary) Gains {
+	return Gains{
+		ShortTerm:   summary.ShortTerm,
+		LongTerm:    summary.LongTerm,
+		UnknownTerm: summary.UnknownTerm,
+		Losses:      summary.Losses,
+		Total:       summary.Total(),
+	}
+}
+
+func (gains Gains) summary() tax.Summary {
+	return tax.Summary{
+		ShortTerm:   gains.ShortTerm,
+		LongTerm:    gains.LongTerm,
+		UnknownTerm: gains.UnknownTerm,
+		Losses:      gains.Losses,
+	}
+}
+
+// OpenOrders Orders of previous runs that are still open
+type OpenOrders struct {
+	Account string  `json:"account,omitempty"`
+	Orders  []Order `json:"orders"`
+}
+
+// NewOpenOrders NewOpenOrders
+func NewOpenOrders(account string, orders []model.Order) OpenOrders {
+	return OpenOrders{
+		Account: account,
+		Orders:  newOrders(orders),
+	}
+}
+
+// Type Type
+func (openOrders OpenOrders) Type() string {
+	return "open_orders"
+}
+
+// WriteText WriteText
+func (openOrders OpenOrders) WriteText(w io.Writer) {
+	fmt.Fprintln(w, "Found the following open orders:")
+	writeOrders(w, openOrders.Orders)
+}
+
+// Plan Plan of a rebalance with the estimated gains of its sales
+type Plan struct {
+	Assets         []string       `json:"assets"`
+	Cash           float64        `json:"cash"`
+	PortfolioValue float64        `json:"portfolio_value"`
+	Untargeted     float64        `json:"untargeted_value"`
+	OpenOrders     int            `json:"open_orders"`
+	NettedValue    float64        `json:"netted_value"`
+	Reserve        float64        `json:"cash_reserve"`
+	Withdrawal     float64        `json:"withdrawal"`
+	Investable     float64        `json:"investable_cash"`
+	Orders         []Order        `json:"orders"`
+	Dropped        []DroppedOrder `json:"dropped"`
+	DroppedValue   float64        `json:"dropped_value"`
+	EstimatedGains Gains          `json:"estimated_gains"`
+	EstimatedTax   float64        `json:"estimated_tax"`
+}
+
+// NewPlan Creates the document of a plan, estimates has the estimated gain of every order
+func NewPlan(plan model.Plan, assets []model.Asset, estimates []tax.Summary, rates tax.Rates) Plan {
+	symbols := make([]string, len(assets))
+	for i, asset := range assets {
+		symbols[i] = asset.Symbol
+	}
+	orders, gains := newEstimatedOrders(plan.Orders, estimates)
+	return Plan{
+		Assets:         symbols,
+		Cash:           plan.Cash,
+		PortfolioValue: plan.PortfolioValue,
+		Untargeted:     plan.UntargetedValue,
+		OpenOrders:     plan.OpenOrders,
+		NettedValue:    plan.NettedValue,
+		Reserve:        plan.Reserve,
+		Withdrawal:     plan.Withdrawal,
+		Investable:     plan.Investable,
+		Orders:         orders,
+		Dropped:        newDroppedOrders(plan.Dropped),
+		DroppedValue:   plan.DroppedValue(),
+		EstimatedGains: NewGains(gains),
+		EstimatedTax:   rates.Tax(gains),
+	}
+}
+
+// newEstimatedOrders Annotates the sales with their estimated gains and returns the sum of the gains
+func newEstimatedOrders(modelOrders []model.Order, estimates []tax.Summary) ([]Order, tax.Summary) {
+	orders := newOrders(modelOrders)
+	var gains tax.Summary
+	for i, order := range modelOrders {
+		if order.Type != model.OrderTypeSell || i >= len(estimates) {
+			continue
+		}
+		gain := NewGains(estimates[i])
+		orders[i].EstimatedGain = &gain
+		gains = gains.Add(estimates[i])
+	}
+	return orders, gains
+}
+
+// Type Type
+func (plan Plan) Type() string {
+	return "plan"
+}
+
+// WriteText WriteText
+func (plan Plan) WriteText(w io.Writer) {
+	fmt.Fprintln(w, "Unallocated cash:", plan.Cash)
+	fmt.Fprintf(w, "Current portfolio value for assets %v: %v\n", plan.Assets, plan.PortfolioValue)
+	if plan.Untargeted > 0 {
+		fmt.Fprintf(w, "Value of holdings not in the target portfolio, included in the portfolio value: %v\n", plan.Untargeted)
+	}
+	if plan.OpenOrders > 0 {
+		fmt.Fprintf(w, "Portfolio value including %d open orders: %v\n", plan.OpenOrders, plan.NettedValue)
+	}
+	if plan.Reserve > 0 {
+		fmt.Fprintf(w, "Cash reserve: %v\n", plan.Reserve)
+	}
+	if plan.Withdrawal > 0 {
+		fmt.Fprintf(w, "Withdrawal: %v\n", plan.Withdrawal)
+	}
+	if plan.Reserve > 0 || plan.Withdrawal > 0 {
+		fmt.Fprintf(w, "Cash available for purchases: %v\n", plan.Investable)
+	}
+
+	if len(plan.Dropped) > 0 {
+		fmt.Fprintf(w, "Dropped the following orders worth %v in total:\n", plan.DroppedValue)
+		for i, dropped := range plan.Dropped {
+			fmt.Fprintf(w, "[%d]: %s %v x %s @ %v (%s)\n", i, strings.ToUpper(dropped.Side), dropped.Quantity, dropped.Symbol, dropped.Price, dropped.Reason)
+		}
+	}
+
+	if len(plan.Orders) == 0 {
+		fmt.Fprintln(w, "No orders created.")
+		return
+	}
+	fmt.Fprintln(w, "Created the following orders:")
+	writeOrders(w, plan.Orders)
+	writeEstimate(w, plan.EstimatedGains, plan.EstimatedTax)
+}
+
+func writeEstimate(w io.Writer, gains Gains, tax float64) {
+	fmt.Fprintf(
+		w,
+		"Estimated realized gains: %.2f (%.2f short-term, %.2f long-term, %.2f unknown term), estimated tax: %.2f\n",
+		gains.Total,
+		gains.ShortTerm,
+		gains.LongTerm,
+		gains.UnknownTerm,
+		tax,
+	)
+}
+
+// Target Target weight of an asset
+type Target struct {
+	Symbol string  `json:"symbol"`
+	Weight float64 `json:"weight"`
+}
+
+// AccountPlan Plan of one account of a household with the estimated gains of its sales
+type AccountPlan struct {
+	Account        string         `json:"account"`
+	Targets        []Target       `json:"targets"`
+	Orders         []Order        `json:"orders"`
+	Dropped        []DroppedOrder `json:"dropped"`
+	EstimatedGains Gains          `json:"estimated_gains"`
+}
+
+// HouseholdPlan Plans of all accounts of a household with the estimated gains and tax of all sales
+type HouseholdPlan struct {
+	Accounts       []AccountPlan `json:"accounts"`
+	EstimatedGains Gains         `json:"estimated_gains"`
+	EstimatedTax   float64       `json:"estimated_tax"`
+}
+
+// NewAccountPlan Creates the plan of an account with the target weights of the assets, estimates has the estimated gain of every order
+func NewAccountPlan(account string, weights model.Weights, plan model.Plan, assets []model.Asset, estimates []tax.Summary) AccountPlan {
+	targets := make([]Target, len(assets))
+	for i, asset := range assets {
+		targets[i] = Target{
+			Symbol: asset.Symbol,
+			Weight: weights[asset],
+		}
+	}
+	orders, gains := newEstimatedOrders(plan.Orders, estimates)
+	return AccountPlan{
+		Account:        account,
+		Targets:        targets,
+		Orders:         orders,
+		Dropped:        newDroppedOrders(plan.Dropped),
+		EstimatedGains: NewGains(gains),
+	}
+}
+
+// NewHouseholdPlan Creates the plan of a household, the gains of all accounts are taxed together
+func NewHouseholdPlan(accounts []AccountPlan, rates tax.Rates) HouseholdPlan {
+	var gains tax.Summary
+	for _, account := range accounts {
+		gains = gains.Add(account.EstimatedGains.summary())
+	}
+	return HouseholdPlan{
+		Accounts:       accounts,
+		EstimatedGains: NewGains(gains),
+		EstimatedTax:   rates.Tax(gains),
+	}
+}
+
+// Type Type
+func (plan HouseholdPlan) Type() string {
+	return "household_plan"
+}
+
+// WriteText WriteText
+func (plan HouseholdPlan) WriteText(w io.Writer) {
+	fmt.Fprintln(w, "Created the following plan:")
+	var count int
+	for _, account := range plan.Accounts {
+		fmt.Fprintf(w, "Account %s:\n", account.Account)
+		for _, target := range account.Targets {
+			fmt.Fprintf(w, "  target %s: %.2f%%\n", target.Symbol, target.Weight*100)
+		}
+		for _, dropped := range account.Dropped {
+			fmt.Fprintf(w, "  dropped %v x %s @ %v (%s)\n", dropped.Quantity, dropped.Symbol, dropped.Price, dropped.Reason)
+		}
+		writeOrders(w, account.Orders)
+		count += len(account.Orders)
+	}
+	if count == 0 {
+		fmt.Fprintln(w, "No orders created.")
+		return
+	}
+	writeEstimate(w, plan.EstimatedGains, plan.EstimatedTax)
+}
+
+// Execution Orders that were submitted and the errors of the ones that failed
+type Execution struct {
+	Account string   `json:"account,omitempty"`
+	Orders  []Order  `json:"orders"`
+	Errors  []string `json:"errors"`
+}
+
+// NewExecution NewExecution
+func NewExecution(account string, orders []model.Order, errs []error) Execution {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return Execution{
+		Account: account,
+		Orders:  newOrders(orders),
+		Errors:  messages,
+	}
+}
+
+// Type Type
+func (execution Execution) Type() string {
+	return "execution"
+}
+
+// WriteText WriteText
+func (execution Execution) WriteText(w io.Writer) {
+	for _, err := range execution.Errors {
+		fmt.Fprintln(w, err)
+	}
+}
+
+// Result Outcome of a watched order
+type Result struct {
+	Order          Order   `json:"order"`
+	Status         string  `json:"status"`
+	FilledQuantity float64 `json:"filled_quantity"`
+	FilledPrice    float64 `json:"filled_price"`
+	Attempts       int     `json:"attempts"`
+	Error          string  `json:"error,omitempty"`
+}
+
+// ExecutionReport Outcome of the orders that were watched until the deadline
+type ExecutionReport struct {
+	Account string   `json:"account,omitempty"`
+	Results []Result `json:"results"`
+}
+
+// NewExecutionReport NewExecutionReport
+func NewExecutionReport(account string, report execution.Report) ExecutionReport {
+	results := make([]Result, len(report.Results))
+	for i, result := range report.Results {
+		status := "unfilled"
+		if result.IsFilled() {
+			status = "filled"
+		} else if result.FilledQuantity > 0 {
+			status = "partially_filled"
+		}
+		results[i] = Result{
+			Order:          NewOrder(result.Order),
+			Status:         status,
+			FilledQuantity: result.FilledQuantity,
+			FilledPrice:    result.FilledPrice,
+			Attempts:       result.Attempts,
+		}
+		if result.Err != nil {
+			results[i].Error = result.Err.Error()
+		}
+	}
+	return ExecutionReport{
+		Account: account,
+		Results: results,
+	}
+}
+
+// Type Type
+func (report ExecutionReport) Type() string {
+	return "execution_report"
+}
+
+// WriteText WriteText
+func (report ExecutionReport) WriteText(w io.Writer) {
+	fmt.Fprintln(w, "Execution report:")
+	for i, result := range report.Results {
+		fmt.Fprintf(
+			w,
+			"[%d]: %s %v/%v x %s @ %v (%d attempts)\n",
+			i,
+			strings.ToUpper(strings.Replace(result.Status, "_", " ", -1)),
+			result.FilledQuantity,
+			result.Order.Quantity,
+			result.Order.Symbol,
+			result.FilledPrice,
+			result.Attempts,
+		)
+		if result.Error != "" {
+			fmt.Fprintln(w, "     ", result.Error)
+		}
+	}
+}
+
+// Year Realized gains of a year
+type Year struct {
+	Year      int     `json:"year"`
+	Losses    float64 `json:"losses"`
+	ShortTerm float64 `json:"short_term"`
+	LongTerm  float64 `json:"long_term"`
+}
+
+// Strategy Metrics of a simulated strategy
+type Strategy struct {
+	Name          string  `json:"name"`
+	FinalValue    float64 `json:"final_value"`
+	Orders        int     `json:"orders"`
+	Volume        float64 `json:"volume"`
+	DroppedOrders int     `json:"dropped_orders"`
+	DroppedValue  float64 `json:"dropped_value"`
+	AverageDrift  float64 `json:"average_drift"`
+	MaxDrift      float64 `json:"max_drift"`
+	RealizedGains Gains   `json:"realized_gains"`
+	Years         []Year  `json:"years"`
+}
+
+// Backtest Metrics of the strategies of a backtest and the chart of their growth
+type Backtest struct {
+	Strategies []Strategy `json:"strategies"`
+	Chart      string     `json:"chart"`
+}
+
+// Type Type
+func (backtest Backtest) Type() string {
+	return "backtest"
+}
+
+// WriteText WriteText
+func (backtest Backtest) WriteText(w io.Writer) {
+	for _, strategy := range backtest.Strategies {
+		fmt.Fprintf(
+			w,
+			"%s: final value %.2f, %d orders with a volume of %.2f, %d orders with a volume of %.2f dropped, average drift %.2f%%, max drift %.2f%%, realized gains %.2f short-term and %.2f long-term\n",
+			strategy.Name,
+			strategy.FinalValue,
+			strategy.Orders,
+			strategy.Volume,
+			strategy.DroppedOrders,
+			strategy.DroppedValue,
+			strategy.AverageDrift*100,
+			strategy.MaxDrift*100,
+			strategy.RealizedGains.ShortTerm,
+			strategy.RealizedGains.LongTerm,
+		)
+		for _, year := range strategy.Years {
+			fmt.Fprintf(w, "  %d: realized losses %.2f, net gains %.2f short-term and %.2f long-term\n", year.Year, year.Losses, year.ShortTerm, year.LongTerm)
+		}
+	}
+	fmt.Fprintf(w, "Saved outcome as %v\n", backtest.Chart)
+}
+
+// AssetWeight Weight of an asset
+type AssetWeight struct {
+	Symbol string  `json:"symbol"`
+	Weight float64 `json:"weight"`
+}
+
+// OptimizedPortfolio Portfolio of the efficient frontier with its annualized expected return and volatility
+type OptimizedPortfolio struct {
+	Name       string        `json:"name"`
+	Return     float64       `json:"return"`
+	Volatility float64       `json:"volatility"`
+	Sharpe     float64       `json:"sharpe"`
+	Weights    []AssetWeight `json:"weights"`
+
+	// File Portfolio file the weights are saved as
+	File string `json:"file"`
+}
+
+// Optimization Optimized portfolios of a universe of assets and the chart of their efficient frontier
+type Optimization struct {
+	From       string               `json:"from"`
+	To         string               `json:"to"`
+	Portfolios []OptimizedPortfolio `json:"portfolios"`
+	Chart      string               `json:"chart"`
+}
+
+// Type Type
+func (optimization Optimization) Type() string {
+	return "optimization"
+}
+
+// WriteText WriteText
+func (optimization Optimization) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "Estimated from the quotes of %s to %s\n", optimization.From, optimization.To)
+	for _, portfolio := range optimization.Portfolios {
+		fmt.Fprintf(
+			w,
+			"%s: expected return %.2f%%, volatility %.2f%%, Sharpe ratio %.2f, saved as %v\n",
+			portfolio.Name,
+			portfolio.Return*100,
+			portfolio.Volatility*100,
+			portfolio.Sharpe,
+			portfolio.File,
+		)
+		table := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+		for _, weight := range portfolio.Weights {
+			fmt.Fprintf(table, "  %s\t%.2f%%\t\n", weight.Symbol, weight.Weight*100)
+		}
+		table.Flush()
+	}
+	fmt.Fprintf(w, "Saved efficient frontier as %v\n", optimization.Chart)
+}
+
+// Holding Position of an asset compared to its target weight. Weights are relative to the value of all holdings.
+type Holding struct {
+	Symbol string `json:"symbol"`
+
+	// Class Asset class of the asset in the allocation, e.g. "equities/us", empty without allocation
+	Class    string  `json:"class,omitempty"`
+	Quantity float64 `json:"quantity"`
+	Price    float64 `json:"price"`
+	Value    float64 `json:"value"`
+	Weight   float64 `json:"weight"`
+	Target   float64 `json:"target"`
+
+	// Drift Weight minus target weight as a fraction, the text output shows it in percentage points
+	Drift float64 `json:"drift"`
+
+	// DriftValue Value above the target weight, negative if the asset is underweight
+	DriftValue float64 `json:"drift_value"`
+
+	// UnrealizedGain Gain since the purchase at the average buy price, 0 if the broker does not report it
+	UnrealizedGain float64 `json:"unrealized_gain"`
+}
+
+// ClassHolding Holdings of an asset class compared to its target weight
+type ClassHolding struct {
+	Class  string  `json:"class"`
+	Value  float64 `json:"value"`
+	Weight float64 `json:"weight"`
+	Target float64 `json:"target"`
+
+	// Drift Weight minus target weight as a fraction, the text output shows it in percentage points
+	Drift float64 `json:"drift"`
+
+	// DriftValue Value above the target weight, negative if the class is underweight
+	DriftValue float64 `json:"drift_value"`
+}
+
+// Status Cash and holdings of an account, including holdings that are not part of the target portfolio
+type Status struct {
+	Cash           float64        `json:"cash"`
+	HoldingsValue  float64        `json:"holdings_value"`
+	TotalValue     float64        `json:"total_value"`
+	UnrealizedGain float64        `json:"unrealized_gain"`
+	Holdings       []Holding      `json:"holdings"`
+	Untargeted     []Holding      `json:"untargeted"`
+	Classes        []ClassHolding `json:"classes,omitempty"`
+}
+
+// NewStatus Compares the positions at the prices of the quotes with the target weights. Holdings follow the order of the
+// assets of the target portfolio, assets that are not held have a quantity of 0. The drift is rolled up by the asset
+// classes of the allocation if there is one.
+func NewStatus(cash float64, positions []model.Position, quotes []model.Quote, weights model.Weights, assets []model.Asset, allocation *model.Allocation) Status {
+	prices := model.Prices{}
+	for _, quote := range quotes {
+		prices[quote.Asset] = quote.Price
+	}
+	byAsset := map[model.Asset]model.Position{}
+	for _, position := range positions {
+		byAsset[position.Asset] = position
+	}
+
+	status := Status{
+		Cash:       cash,
+		Holdings:   []Holding{},
+		Untargeted: []Holding{},
+	}
+	newHolding := func(asset model.Asset) Holding {
+		position := byAsset[asset]
+		holding := Holding{
+			Symbol:   asset.Symbol,
+			Quantity: position.Quantity,
+			Price:    prices[asset],
+			Value:    position.Quantity * prices[asset],
+			Target:   weights[asset],
+		}
+		if allocation != nil {
+			holding.Class = allocation.ClassOf(asset)
+		}
+		if position.AvgBuyPrice > 0 {
+			holding.UnrealizedGain = (holding.Price - position.AvgBuyPrice) * position.Quantity
+		}
+		status.HoldingsValue += holding.Value
+		status.UnrealizedGain += holding.UnrealizedGain
+		return holding
+	}
+	for _, asset := range assets {
+		status.Holdings = append(status.Holdings, newHolding(asset))
+	}
+	for _, position := range positions {
+		if _, ok := weights[position.Asset]; !ok {
+			status.Untargeted = append(status.Untargeted, newHolding(position.Asset))
+		}
+	}
+	status.TotalValue = status.HoldingsValue + cash
+
+	for _, holdings := range [][]Holding{status.Holdings, status.Untargeted} {
+		for i := range holdings {
+			holding := &holdings[i]
+			if status.HoldingsValue > 0 {
+				holding.Weight = holding.Value / status.HoldingsValue
+			}
+			holding.Drift = holding.Weight - holding.Target
+			holding.DriftValue = holding.Value - holding.Target*status.HoldingsValue
+		}
+	}
+
+	if allocation == nil {
+		return status
+	}
+	values := map[string]float64{}
+	for _, holding := range status.Holdings {
+		values[holding.Symbol] = holding.Value
+	}
+	for _, class := range allocation.Flatten() {
+		classHolding := ClassHolding{
+			Class:  class.Path,
+			Target: class.Weight,
+		}
+		for _, asset := range class.Assets {
+			classHolding.Value += values[asset.Symbol]
+		}
+		if status.HoldingsValue > 0 {
+			classHolding.Weight = classHolding.Value / status.HoldingsValue
+		}
+		classHolding.Drift = classHolding.Weight - classHolding.Target
+		classHolding.DriftValue = classHolding.Value - classHolding.Target*status.HoldingsValue
+		status.Classes = append(status.Classes, classHolding)
+	}
+	return status
+}
+
+// Type Type
+func (status Status) Type() string {
+	return "status"
+}
+
+// WriteText WriteText
+func (status Status) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "Available cash: %.2f\n", status.Cash)
+	fmt.Fprintf(w, "Holdings value: %.2f, total value: %.2f, unrealized P/L: %.2f\n", status.HoldingsValue, status.TotalValue, status.UnrealizedGain)
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(table, "SYMBOL\tQUANTITY\tPRICE\tVALUE\tWEIGHT\tTARGET\tDRIFT PP\tDRIFT $\tUNREALIZED P/L\t")
+	writeHoldings(table, status.Holdings)
+	if len(status.Untargeted) > 0 {
+		fmt.Fprintln(table, "Not in the target portfolio:")
+		writeHoldings(table, status.Untargeted)
+	}
+	table.Flush()
+
+	if len(status.Classes) == 0 {
+		return
+	}
+	table = tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(table, "CLASS\tVALUE\tWEIGHT\tTARGET\tDRIFT PP\tDRIFT $\t")
+	for _, class := range status.Classes {
+		fmt.Fprintf(
+			table,
+			"%s\t%.2f\t%.2f%%\t%.2f%%\t%+.2f\t%+.2f\t\n",
+			class.Class,
+			class.Value,
+			class.Weight*100,
+			class.Target*100,
+			class.Drift*100,
+			class.DriftValue,
+		)
+	}
+	table.Flush()
+}
+
+func writeHoldings(w io.Writer, holdings []Holding) {
+	for _, holding := range holdings {
+		fmt.Fprintf(
+			w,
+			"%s\t%v\t%.2f\t%.2f\t%.2f%%\t%.2f%%\t%+.2f\t%+.2f\t%+.2f\t\n",
+			holding.Symbol,
+			holding.Quantity,
+			holding.Price,
+			holding.Value,
+			holding.Weight*100,
+			holding.Target*100,
+			holding.Drift*100,
+			holding.DriftValue,
+			holding.UnrealizedGain,
+		)
+	}
+}
+
+// Cash Available cash of an account
+type Cash struct {
+	Cash float64 `json:"cash"`
+}
+
+// Type Type
+func (cash Cash) Type() string {
+	return "cash"
+}
+
+// WriteText WriteText
+func (cash Cash) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "Available cash: %.2f\n", cash.Cash)
+}
+
+// Setting Effective value of a setting and where it comes from
+type Setting struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// Settings Effective settings of a command
+type Settings struct {
+	Settings []Setting `json:"settings"`
+}
+
+// Type Type
+func (settings Settings) Type() string {
+	return "settings"
+}
+
+// WriteText WriteText
+func (settings Settings) WriteText(w io.Writer) {
+	for _, setting := range settings.Settings {
+		fmt.Fprintf(w, "%s = %s (%s)\n", setting.Name, setting.Value, setting.Source)
+	}
+}
+
+// Error Error a command failed with
+type Error struct {
+	Error string `json:"error"`
+}
+
+// Type Type
+func (err Error) Type() string {
+	return "error"
+}
+
+// WriteText WriteText
+func (err Error) WriteText(w io.Writer) {
+	fmt.Fprintln(w, err.Error)
+}
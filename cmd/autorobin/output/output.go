@@ -0,0 +1,81 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+const (
+	// FormatText Human readable text
+	FormatText = "text"
+
+	// FormatJSON One JSON document per line, e.g. {"type":"plan","data":{...}}
+	FormatJSON = "json"
+)
+
+// Document Result of a command that is printed as text or as JSON
+type Document interface {
+	// Type Type of the document in JSON output
+	Type() string
+
+	// WriteText Writes the document as text
+	WriteText(w io.Writer)
+}
+
+// envelope JSON document with its type
+type envelope struct {
+	Type string   `json:"type"`
+	Data Document `json:"data"`
+}
+
+// Printer Prints documents in an output format. Messages about the progress and questions go to the output with text
+// and to the messages writer with JSON, so the output only contains JSON documents.
+type Printer struct {
+	format   string
+	out      io.Writer
+	messages io.Writer
+}
+
+// NewPrinter NewPrinter
+func NewPrinter(format string, out io.Writer, messages io.Writer) (*Printer, error) {
+	switch format {
+	case FormatText:
+		messages = out
+	case FormatJSON:
+	default:
+		return nil, fmt.Errorf("invalid output format: %s", format)
+	}
+	return &Printer{
+		format:   format,
+		out:      out,
+		messages: messages,
+	}, nil
+}
+
+// Format Returns the output format
+func (printer *Printer) Format() string {
+	return printer.format
+}
+
+// Messages Returns the writer of messages and questions
+func (printer *Printer) Messages() io.Writer {
+	return printer.messages
+}
+
+// Printf Prints a message about the progress
+func (printer *Printer) Printf(format string, args ...interface{}) {
+	fmt.Fprintf(printer.messages, format, args...)
+}
+
+// Print Prints a document
+func (printer *Printer) Print(document Document) error {
+	if printer.format == FormatJSON {
+		return json.NewEncoder(printer.out).Encode(envelope{
+			Type: document.Type(),
+			Data: document,
+		})
+	}
+	document.WriteText(printer.out)
+	return nil
+}
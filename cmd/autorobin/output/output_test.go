@@ -0,0 +1,196 @@
+package output_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/MitchK/autorobin/cmd/autorobin/output"
+	"github.com/MitchK/autorobin/lib/model"
+	"github.com/MitchK/autorobin/lib/tax"
+	"github.com/onsi/gomega"
+)
+
+func TestPrinter(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	// should print text and messages to the output
+	var out, messages bytes.Buffer
+	printer, err := output.NewPrinter(output.FormatText, &out, &messages)
+	g.Expect(err).To(gomega.BeNil())
+	printer.Printf("Submitting orders...\n")
+	g.Expect(printer.Print(output.Cash{Cash: 12.5})).To(gomega.Succeed())
+	g.Expect(out.String()).To(gomega.Equal("Submitting orders...\nAvailable cash: 12.50\n"))
+	g.Expect(messages.String()).To(gomega.BeEmpty())
+
+	// should print one JSON document per line and keep messages apart
+	out.Reset()
+	printer, err = output.NewPrinter(output.FormatJSON, &out, &messages)
+	g.Expect(err).To(gomega.BeNil())
+	printer.Printf("Submitting orders...\n")
+	g.Expect(printer.Print(output.Cash{Cash: 12.5})).To(gomega.Succeed())
+	g.Expect(printer.Print(output.Error{Error: "failed"})).To(gomega.Succeed())
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	g.Expect(lines).To(gomega.HaveLen(2))
+	g.Expect(lines[0]).To(gomega.MatchJSON(`{"type": "cash", "data": {"cash": 12.5}}`))
+	g.Expect(lines[1]).To(gomega.MatchJSON(`{"type": "error", "data": {"error": "failed"}}`))
+	g.Expect(messages.String()).To(gomega.Equal("Submitting orders...\n"))
+
+	_, err = output.NewPrinter("xml", &out, &messages)
+	g.Expect(err).NotTo(gomega.BeNil())
+}
+
+func TestPlan(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	a := model.Asset{Symbol: "A"}
+	b := model.Asset{Symbol: "B"}
+	plan := model.Plan{
+		Orders: []model.Order{
+			{Type: model.OrderTypeBuy, Asset: a, Quantity: 2, Price: 10, Description: "Purchase"},
+			{Type: model.OrderTypeSell, Asset: b, Quantity: 1, Price: 20, Description: "Sale"},
+		},
+		Dropped: []model.DroppedOrder{
+			{Order: model.Order{Type: model.OrderTypeBuy, Asset: b, Quantity: 1, Price: 20}, Reason: "value below minimum of 50"},
+		},
+		Cash:           30,
+		PortfolioValue: 100,
+		NettedValue:    100,
+		Reserve:        10,
+		Investable:     20,
+	}
+	estimates := []tax.Summary{{}, {ShortTerm: 5}}
+	document := output.NewPlan(plan, []model.Asset{a, b}, estimates, tax.Rates{ShortTerm: 0.2})
+
+	// should estimate the gains of sales only
+	g.Expect(document.Orders[0].EstimatedGain).To(gomega.BeNil())
+	g.Expect(document.Orders[1].EstimatedGain.ShortTerm).To(gomega.Equal(5.0))
+	g.Expect(document.EstimatedGains.Total).To(gomega.Equal(5.0))
+	g.Expect(document.EstimatedTax).To(gomega.BeNumerically("~", 1))
+	g.Expect(document.DroppedValue).To(gomega.Equal(20.0))
+
+	var out bytes.Buffer
+	printer, err := output.NewPrinter(output.FormatText, &out, &out)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(printer.Print(document)).To(gomega.Succeed())
+	g.Expect(out.String()).To(gomega.Equal(`Unallocated cash: 30
+Current portfolio value for assets [A B]: 100
+Cash reserve: 10
+Cash available for purchases: 20
+Dropped the following orders worth 20 in total:
+[0]: BUY 1 x B @ 20 (value below minimum of 50)
+Created the following orders:
+[0]: BUY 2 x A @ 10
+[1]: SELL 1 x B @ 20 (estimated gain 5.00 short-term)
+Estimated realized gains: 5.00 (5.00 short-term, 0.00 long-term, 0.00 unknown term), estimated tax: 1.00
+`))
+
+	// should report the errors of an execution
+	execution := output.NewExecution("ira", plan.Orders, []error{errors.New("rejected")})
+	g.Expect(execution.Account).To(gomega.Equal("ira"))
+	g.Expect(execution.Orders).To(gomega.HaveLen(2))
+	g.Expect(execution.Errors).To(gomega.Equal([]string{"rejected"}))
+}
+
+func TestHouseholdPlan(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	a := model.Asset{Symbol: "A"}
+	b := model.Asset{Symbol: "B"}
+	taxable := model.Plan{
+		Orders: []model.Order{
+			{Type: model.OrderTypeSell, Asset: a, Quantity: 1, Price: 10},
+		},
+	}
+	ira := model.Plan{
+		Orders: []model.Order{
+			{Type: model.OrderTypeBuy, Asset: a, Quantity: 1, Price: 10},
+			{Type: model.OrderTypeSell, Asset: b, Quantity: 2, Price: 20},
+		},
+	}
+	weights := model.Weights{a: 0.5, b: 0.5}
+	document := output.NewHouseholdPlan([]output.AccountPlan{
+		output.NewAccountPlan("taxable", weights, taxable, []model.Asset{a, b}, []tax.Summary{{LongTerm: 4}}),
+		output.NewAccountPlan("ira", weights, ira, []model.Asset{a, b}, []tax.Summary{{}, {ShortTerm: 6}}),
+	}, tax.Rates{ShortTerm: 0.2, LongTerm: 0.1})
+
+	// should estimate the gains per account and sum them up
+	g.Expect(document.Accounts[0].EstimatedGains.Total).To(gomega.Equal(4.0))
+	g.Expect(document.Accounts[1].Orders[0].EstimatedGain).To(gomega.BeNil())
+	g.Expect(document.Accounts[1].EstimatedGains.Total).To(gomega.Equal(6.0))
+	g.Expect(document.EstimatedGains.Total).To(gomega.Equal(10.0))
+	g.Expect(document.EstimatedTax).To(gomega.BeNumerically("~", 1.6))
+}
+
+func TestStatus(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	a := model.Asset{Symbol: "A"}
+	b := model.Asset{Symbol: "B"}
+	x := model.Asset{Symbol: "X"}
+	positions := []model.Position{
+		{Asset: a, Quantity: 6, AvgBuyPrice: 8},
+		{Asset: x, Quantity: 1, AvgBuyPrice: 0},
+	}
+	quotes := []model.Quote{{Asset: a, Price: 10}, {Asset: b, Price: 20}, {Asset: x, Price: 20}}
+	status := output.NewStatus(50, positions, quotes, model.Weights{a: 0.5, b: 0.5}, []model.Asset{a, b}, nil)
+
+	// should compare the holdings with the targets relative to the value of all holdings
+	g.Expect(status.HoldingsValue).To(gomega.Equal(80.0))
+	g.Expect(status.TotalValue).To(gomega.Equal(130.0))
+	g.Expect(status.Holdings).To(gomega.Equal([]output.Holding{
+		{Symbol: "A", Quantity: 6, Price: 10, Value: 60, Weight: 0.75, Target: 0.5, Drift: 0.25, DriftValue: 20, UnrealizedGain: 12},
+		{Symbol: "B", Price: 20, Target: 0.5, Drift: -0.5, DriftValue: -40},
+	}))
+
+	// should list the holdings that are not part of the target portfolio, without gains if there is no average buy price
+	g.Expect(status.Untargeted).To(gomega.Equal([]output.Holding{
+		{Symbol: "X", Quantity: 1, Price: 20, Value: 20, Weight: 0.25, Drift: 0.25, DriftValue: 20},
+	}))
+	g.Expect(status.UnrealizedGain).To(gomega.Equal(12.0))
+
+	var out bytes.Buffer
+	printer, err := output.NewPrinter(output.FormatText, &out, &out)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(printer.Print(status)).To(gomega.Succeed())
+	g.Expect(out.String()).To(gomega.ContainSubstring("Not in the target portfolio:\n"))
+
+	// should show the drift in percentage points in the text output only
+	g.Expect(out.String()).To(gomega.MatchRegexp(`75\.00%\s+50\.00%\s+\+25\.00\s+\+20\.00`))
+}
+
+func TestStatusClasses(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	us := model.Asset{Symbol: "VTI"}
+	usAlt := model.Asset{Symbol: "ITOT"}
+	bonds := model.Asset{Symbol: "BND"}
+	allocation := model.Allocation{
+		Classes: []model.Allocation{
+			{Name: "equities", Weight: 0.5, Classes: []model.Allocation{
+				{Name: "us", Weight: 1, Assets: []model.Asset{us, usAlt}},
+			}},
+			{Name: "bonds", Weight: 0.5, Assets: []model.Asset{bonds}},
+		},
+	}
+	positions := []model.Position{
+		{Asset: us, Quantity: 2},
+		{Asset: usAlt, Quantity: 4},
+		{Asset: bonds, Quantity: 2},
+	}
+	quotes := []model.Quote{{Asset: us, Price: 10}, {Asset: usAlt, Price: 10}, {Asset: bonds, Price: 10}}
+	status := output.NewStatus(0, positions, quotes, allocation.Weights(), allocation.Members(), &allocation)
+
+	// should roll up the drift of the interchangeable assets of a sleeve
+	g.Expect(status.Classes).To(gomega.Equal([]output.ClassHolding{
+		{Class: "equities", Value: 60, Weight: 0.75, Target: 0.5, Drift: 0.25, DriftValue: 20},
+		{Class: "equities/us", Value: 60, Weight: 0.75, Target: 0.5, Drift: 0.25, DriftValue: 20},
+		{Class: "bonds", Value: 20, Weight: 0.25, Target: 0.5, Drift: -0.25, DriftValue: -20},
+	}))
+
+	// should classify the holdings by their sleeve
+	g.Expect(status.Holdings[1].Symbol).To(gomega.Equal("ITOT"))
+	g.Expect(status.Holdings[1].Class).To(gomega.Equal("equities/us"))
+	g.Expect(status.Holdings[2].Class).To(gomega.Equal("bonds"))
+}
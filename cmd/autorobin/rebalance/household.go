@@ -0,0 +1,251 @@
+package rebalance
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"strings"
+
+	"github.com/MitchK/autorobin/cmd/autorobin/output"
+	"github.com/MitchK/autorobin/lib/autopilot"
+	"github.com/MitchK/autorobin/lib/broker"
+	"github.com/MitchK/autorobin/lib/execution"
+	"github.com/MitchK/autorobin/lib/household"
+	"github.com/MitchK/autorobin/lib/logging"
+	"github.com/MitchK/autorobin/lib/model"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// accountsFile Accounts file, e.g.
+//
+//   accounts:
+//     - name: taxable
+//       type: taxable
+//       broker: robinhood
+//       username: me@example.com
+//       account: 5RY12345
+//       mode: cashflow
+//     - name: ira
+//       type: tax-deferred
+//       broker: robinhood
+//       username: me@example.com
+//       account: 5RY67890
+//     - name: alpaca
+//       type: tax-free
+//       broker: alpaca
+//       config:
+//         paper: "true"
+//   locations:
+//     - asset: BND
+//       accounts: [tax-deferred, tax-free, taxable]
+type accountsFile struct {
+	Accounts []struct {
+		Name   string            `yaml:"name"`
+		Type   string            `yaml:"type"`
+		Broker string            `yaml:"broker"`
+		Config map[string]string `yaml:"config"`
+		Mode   string            `yaml:"mode"`
+
+		// Username, Password and Account Shortcuts of the Robinhood settings
+		Username string `yaml:"username"`
+		Password string `yaml:"password"`
+		Account  string `yaml:"account"`
+	} `yaml:"accounts"`
+	Locations []struct {
+		Asset    string   `yaml:"asset"`
+		Accounts []string `yaml:"accounts"`
+	} `yaml:"locations"`
+}
+
+func parseAccountType(name string) (household.AccountType, error) {
+	switch name {
+	case "taxable":
+		return household.AccountTypeTaxable, nil
+	case "tax-deferred":
+		return household.AccountTypeTaxDeferred, nil
+	case "tax-free":
+		return household.AccountTypeTaxFree, nil
+	}
+	return 0, fmt.Errorf("invalid account type: %s", name)
+}
+
+// loadHousehold Loads the accounts file and connects to the brokers of its accounts. The options apply to all accounts,
+// the mode can be set per account. Settings an account does not configure default to the given configs by broker name.
+func loadHousehold(path string, brokerConfigs map[string]broker.Config, options autopilot.Options, printer *output.Printer, logger *slog.Logger) (*household.Household, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file := accountsFile{}
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid accounts file %s: %v", path, err)
+	}
+
+	accounts := []household.Account{}
+	for _, entry := range file.Accounts {
+		accountType, err := parseAccountType(entry.Type)
+		if err != nil {
+			return nil, fmt.Errorf("account %s: %v", entry.Name, err)
+		}
+		accountLogger := logger.With(logging.KeyAccount, entry.Name)
+		accountOptions := options
+		accountOptions.Logger = accountLogger
+		switch entry.Mode {
+		case "":
+		case "full":
+			accountOptions.Mode = autopilot.ModeFull
+		case "cashflow":
+			accountOptions.Mode = autopilot.ModeCashFlow
+		default:
+			return nil, fmt.Errorf("account %s: invalid mode: %s", entry.Name, entry.Mode)
+		}
+		config := broker.Config{}
+		for name, value := range brokerConfigs[entry.Broker] {
+			config[name] = value
+		}
+		for name, value := range entry.Config {
+			config[name] = value
+		}
+		if entry.Username != "" || entry.Password != "" || entry.Account != "" {
+			if entry.Broker != "robinhood" {
+				return nil, fmt.Errorf("account %s: username, password and account are robinhood settings, use config for %s", entry.Name, entry.Broker)
+			}
+			if entry.Username != "" {
+				config["username"] = entry.Username
+			}
+			if entry.Password != "" {
+				config["password"] = entry.Password
+			}
+			if entry.Account != "" {
+				config["account"] = entry.Account
+			}
+		}
+		accountBroker, err := broker.New(entry.Broker, config, accountLogger)
+		if err != nil {
+			return nil, fmt.Errorf("account %s: %v", entry.Name, err)
+		}
+		printer.Printf("Successfully connected to %s account %s\n", entry.Broker, entry.Name)
+		accounts = append(accounts, household.Account{
+			Name:    entry.Name,
+			Type:    accountType,
+			Broker:  accountBroker,
+			Options: accountOptions,
+		})
+	}
+
+	locations := []household.Location{}
+	for _, entry := range file.Locations {
+		location := household.Location{
+			Asset: model.Asset{Symbol: entry.Asset},
+		}
+		for _, name := range entry.Accounts {
+			accountType, err := parseAccountType(name)
+			if err != nil {
+				return nil, fmt.Errorf("location of %s: %v", entry.Asset, err)
+			}
+			location.AccountTypes = append(location.AccountTypes, accountType)
+		}
+		locations = append(locations, location)
+	}
+
+	house, err := household.NewHousehold(accounts...)
+	if err != nil {
+		return nil, err
+	}
+	house.SetLocations(locations...)
+	return house, nil
+}
+
+// RunHousehold Executes the rebalancing of all accounts of an accounts file with one target allocation
+func RunHousehold(desiredWeights model.Weights, assets []model.Asset, accountsPath string, brokerConfigs map[string]broker.Config, proceed bool, openOrdersPolicy string, autopilotOptions autopilot.Options, executionOptions execution.Options, taxOptions TaxOptions, printer *output.Printer, logger *slog.Logger) error {
+	switch openOrdersPolicy {
+	case OpenOrdersAsk, OpenOrdersCancel, OpenOrdersNet, OpenOrdersAbort:
+	default:
+		return fmt.Errorf("invalid open orders policy: %s", openOrdersPolicy)
+	}
+
+	house, err := loadHousehold(accountsPath, brokerConfigs, autopilotOptions, printer, logger)
+	if err != nil {
+		return err
+	}
+	for _, account := range house.GetAccounts() {
+		pilot, err := house.GetAutopilot(account.Name)
+		if err != nil {
+			return err
+		}
+		printer.Printf("Account %s:\n", account.Name)
+		if err := handleOpenOrders(account.Name, account.Broker, pilot, openOrdersPolicy, proceed, printer); err != nil {
+			return fmt.Errorf("account %s: %v", account.Name, err)
+		}
+	}
+
+	plan, err := house.Plan(desiredWeights, false, assets...)
+	if err != nil {
+		return err
+	}
+
+	// Estimate the gains of the sales with the lots of each account
+	accountDocuments := []output.AccountPlan{}
+	var count int
+	for _, accountPlan := range plan.Accounts {
+		account := accountPlan.Account
+		estimates, err := estimateSales(account.Broker, accountPlan.Plan.Orders, printer)
+		if err != nil {
+			return fmt.Errorf("account %s: %v", account.Name, err)
+		}
+		accountDocuments = append(accountDocuments, output.NewAccountPlan(account.Name, accountPlan.Weights, accountPlan.Plan, assets, estimates))
+		count += len(accountPlan.Plan.Orders)
+	}
+	document := output.NewHouseholdPlan(accountDocuments, taxOptions.Rates)
+	if err := printer.Print(document); err != nil {
+		return err
+	}
+	if count == 0 {
+		return nil
+	}
+	gains := document.EstimatedGains.Total
+	if taxOptions.LimitGain && gains > taxOptions.MaxGain {
+		return fmt.Errorf("blocked: estimated realized gains of %.2f in all accounts exceed the limit of %.2f", gains, taxOptions.MaxGain)
+	}
+
+	if !proceed {
+		proceed = askForConfirmation("Should I proceed?", printer)
+		if !proceed {
+			return nil
+		}
+	}
+
+	failed := []error{}
+	for _, accountPlan := range plan.Accounts {
+		account := accountPlan.Account
+		orders := accountPlan.Plan.Orders
+		if len(orders) == 0 {
+			continue
+		}
+		printer.Printf("Account %s:\n", account.Name)
+		if executionOptions.Deadline > 0 {
+			accountExecution := executionOptions
+			accountExecution.Logger = logger.With(logging.KeyAccount, account.Name)
+			if err := watch(account.Name, account.Broker, orders, accountExecution, printer); err != nil {
+				failed = append(failed, fmt.Errorf("account %s: %v", account.Name, err))
+			}
+			continue
+		}
+		printer.Printf("Submitting orders...\n")
+		errs := account.Broker.Execute(orders...)
+		if err := printer.Print(output.NewExecution(account.Name, orders, errs)); err != nil {
+			return err
+		}
+		if len(errs) > 0 {
+			failed = append(failed, fmt.Errorf("account %s: %d/%d orders failed", account.Name, len(errs), len(orders)))
+		}
+	}
+	if len(failed) > 0 {
+		messages := make([]string, len(failed))
+		for i, err := range failed {
+			messages[i] = err.Error()
+		}
+		return fmt.Errorf("rebalancing failed for some accounts: %s", strings.Join(messages, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package rebalance
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MitchK/autorobin/cmd/autorobin/output"
+	"github.com/MitchK/autorobin/lib/autopilot"
+	"github.com/MitchK/autorobin/lib/broker"
+	_ "github.com/MitchK/autorobin/lib/broker/paper"
+	"github.com/MitchK/autorobin/lib/household"
+	"github.com/MitchK/autorobin/lib/logging"
+	"github.com/onsi/gomega"
+)
+
+func TestLoadHousehold(t *testing.T) {
+	tests := []struct {
+		name     string
+		accounts string
+		err      string
+		check    func(g *gomega.GomegaWithT, house *household.Household)
+	}{
+		{
+			name: "account settings override the broker configs and the options",
+			accounts: `
+accounts:
+  - name: taxable
+    type: taxable
+    broker: paper
+    config:
+      state: {{dir}}/taxable.json
+  - name: ira
+    type: tax-deferred
+    broker: paper
+    mode: cashflow
+    config:
+      state: {{dir}}/ira.json
+      cash: "250"
+locations:
+  - asset: BND
+    accounts: [tax-deferred, taxable]
+`,
+			check: func(g *gomega.GomegaWithT, house *household.Household) {
+				accounts := house.GetAccounts()
+				g.Expect(accounts).To(gomega.HaveLen(2))
+
+				g.Expect(accounts[0].Name).To(gomega.Equal("taxable"))
+				g.Expect(accounts[0].Type).To(gomega.Equal(household.AccountTypeTaxable))
+				g.Expect(accounts[0].Options.Mode).To(gomega.Equal(autopilot.ModeFull))
+				cash, err := accounts[0].Broker.GetAvailableCash()
+				g.Expect(err).To(gomega.BeNil())
+				g.Expect(cash).To(gomega.Equal(100.0))
+
+				g.Expect(accounts[1].Type).To(gomega.Equal(household.AccountTypeTaxDeferred))
+				g.Expect(accounts[1].Options.Mode).To(gomega.Equal(autopilot.ModeCashFlow))
+				cash, err = accounts[1].Broker.GetAvailableCash()
+				g.Expect(err).To(gomega.BeNil())
+				g.Expect(cash).To(gomega.Equal(250.0))
+			},
+		},
+		{
+			name: "invalid account type",
+			accounts: `
+accounts:
+  - name: taxable
+    type: brokerage
+    broker: paper
+`,
+			err: "account taxable: invalid account type: brokerage",
+		},
+		{
+			name: "invalid mode",
+			accounts: `
+accounts:
+  - name: taxable
+    type: taxable
+    broker: paper
+    mode: yolo
+`,
+			err: "account taxable: invalid mode: yolo",
+		},
+		{
+			name: "robinhood shortcuts on another broker",
+			accounts: `
+accounts:
+  - name: taxable
+    type: taxable
+    broker: paper
+    username: me@example.com
+`,
+			err: "username, password and account are robinhood settings",
+		},
+		{
+			name: "unknown account type of a location",
+			accounts: `
+accounts:
+  - name: taxable
+    type: taxable
+    broker: paper
+    config:
+      state: {{dir}}/taxable.json
+locations:
+  - asset: BND
+    accounts: [roth]
+`,
+			err: "location of BND: invalid account type: roth",
+		},
+		{
+			name: "unknown field",
+			accounts: `
+accounts:
+  - name: taxable
+    type: taxable
+    brokers: paper
+`,
+			err: "invalid accounts file",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := gomega.NewGomegaWithT(t)
+
+			dir := t.TempDir()
+			path := filepath.Join(dir, "accounts.yaml")
+			data := strings.ReplaceAll(test.accounts, "{{dir}}", dir)
+			g.Expect(ioutil.WriteFile(path, []byte(data), 0600)).To(gomega.Succeed())
+
+			var messages bytes.Buffer
+			printer, err := output.NewPrinter(output.FormatText, &messages, &messages)
+			g.Expect(err).To(gomega.BeNil())
+			configs := map[string]broker.Config{
+				"paper": {"cash": "100", "state": filepath.Join(dir, "default.json")},
+			}
+
+			house, err := loadHousehold(path, configs, autopilot.Options{}, printer, logging.Discard())
+			if test.err != "" {
+				g.Expect(err).To(gomega.MatchError(gomega.ContainSubstring(test.err)))
+				return
+			}
+			g.Expect(err).To(gomega.BeNil())
+			test.check(g, house)
+		})
+	}
+}
@@ -2,85 +2,223 @@ package rebalance
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/MitchK/autorobin/cmd/autorobin/output"
 	"github.com/MitchK/autorobin/lib/autopilot"
-	robinhoodBroker "github.com/MitchK/autorobin/lib/broker/robinhood"
+	"github.com/MitchK/autorobin/lib/broker"
+	"github.com/MitchK/autorobin/lib/execution"
 	"github.com/MitchK/autorobin/lib/model"
+	"github.com/MitchK/autorobin/lib/tax"
 )
 
-// Run Executes rebalancing on robinhood account
-func Run(desiredWeights model.Weights, assets []model.Asset, username string, password string, proceed bool) error {
+const (
+	// OpenOrdersAsk Ask what to do with open orders
+	OpenOrdersAsk = "ask"
 
-	// Connect to Robinhood
-	broker, err := robinhoodBroker.NewBroker(username, password)
+	// OpenOrdersCancel Cancel open orders before rebalancing
+	OpenOrdersCancel = "cancel"
+
+	// OpenOrdersNet Treat open orders as if they were filled when rebalancing
+	OpenOrdersNet = "net"
+
+	// OpenOrdersAbort Do not rebalance while there are open orders
+	OpenOrdersAbort = "abort"
+)
+
+// TaxOptions Rates to estimate the tax on the gains of a plan and an optional limit of the gains
+type TaxOptions struct {
+	Rates tax.Rates
+
+	// MaxGain Plans with higher estimated gains are not executed if LimitGain is set
+	MaxGain   float64
+	LimitGain bool
+}
+
+// Run Executes rebalancing on the account of a registered broker. If executionOptions has a deadline, the orders are watched and repriced until then
+func Run(desiredWeights model.Weights, assets []model.Asset, brokerName string, brokerConfig broker.Config, proceed bool, openOrdersPolicy string, autopilotOptions autopilot.Options, executionOptions execution.Options, taxOptions TaxOptions, printer *output.Printer, logger *slog.Logger) error {
+	switch openOrdersPolicy {
+	case OpenOrdersAsk, OpenOrdersCancel, OpenOrdersNet, OpenOrdersAbort:
+	default:
+		return fmt.Errorf("invalid open orders policy: %s", openOrdersPolicy)
+	}
+
+	// Connect to the broker
+	broker, err := broker.New(brokerName, brokerConfig, logger)
 	if err != nil {
 		return err
 	}
-	fmt.Println("Successfully connected to Robinhood")
+	printer.Printf("Successfully connected to %s\n", brokerName)
 
 	// Create autopilot
+	autopilotOptions.Logger = logger
+	executionOptions.Logger = logger
 	autopilot, err := autopilot.NewAutopilot(broker)
 	if err != nil {
 		return err
 	}
+	err = autopilot.SetOptions(autopilotOptions)
+	if err != nil {
+		return err
+	}
+
+	err = handleOpenOrders("", broker, autopilot, openOrdersPolicy, proceed, printer)
+	if err != nil {
+		return err
+	}
 
-	orders, err := autopilot.Rebalance(desiredWeights, false, assets...)
+	plan, err := autopilot.Plan(desiredWeights, false, assets...)
 	if err != nil {
 		return err
 	}
+	orders := plan.Orders
 
+	// Estimate the gains of the sales
+	estimates, err := estimateSales(broker, orders, printer)
+	if err != nil {
+		return err
+	}
+	document := output.NewPlan(plan, assets, estimates, taxOptions.Rates)
+	if err := printer.Print(document); err != nil {
+		return err
+	}
 	if len(orders) == 0 {
-		fmt.Println("No orders created.")
 		return nil
 	}
-
-	fmt.Println("Created the following orders:")
-	for i, order := range orders {
-		if order.Type == model.OrderTypeBuy {
-			fmt.Printf(
-				"[%d]: BUY %v x %s @ %v\n",
-				i,
-				order.Quantity,
-				order.Asset.Symbol,
-				order.Price,
-			)
-		} else if order.Type == model.OrderTypeSell {
-			fmt.Printf(
-				"[%d]: SELL %v x %s @ %v\n",
-				i,
-				order.Quantity,
-				order.Asset.Symbol,
-				order.Price,
-			)
-		}
+	gains := document.EstimatedGains.Total
+	if taxOptions.LimitGain && gains > taxOptions.MaxGain {
+		return fmt.Errorf("blocked: estimated realized gains of %.2f exceed the limit of %.2f", gains, taxOptions.MaxGain)
 	}
 
 	if !proceed {
-		proceed = askForConfirmation("Should I proceed?")
+		proceed = askForConfirmation("Should I proceed?", printer)
 		if !proceed {
 			return nil
 		}
 	}
 
-	fmt.Println("Submitting orders...")
+	if executionOptions.Deadline > 0 {
+		return watch("", broker, orders, executionOptions, printer)
+	}
+
+	printer.Printf("Submitting orders...\n")
 	errs := broker.Execute(orders...)
+	if err := printer.Print(output.NewExecution("", orders, errs)); err != nil {
+		return err
+	}
 	if len(errs) > 0 {
-		for _, err := range errs {
-			fmt.Println(err)
-		}
 		return fmt.Errorf("%d/%d orders failed", len(errs), len(orders))
 	}
 	return nil
 }
 
-func askForConfirmation(s string) bool {
+// handleOpenOrders Handles the open orders of the account according to the policy, account is empty without household
+func handleOpenOrders(account string, broker broker.Broker, autopilot *autopilot.Autopilot, policy string, proceed bool, printer *output.Printer) error {
+	openOrders, err := broker.GetOpenOrders()
+	if err != nil {
+		return err
+	}
+	if len(openOrders) == 0 {
+		return nil
+	}
+
+	if err := printer.Print(output.NewOpenOrders(account, openOrders)); err != nil {
+		return err
+	}
+
+	if policy == OpenOrdersAsk {
+		if proceed {
+			return errors.New("there are open orders, choose how to handle them with --open-orders")
+		}
+		policy = askForChoice("Should I cancel them, net them into the plan or abort?", printer, OpenOrdersCancel, OpenOrdersNet, OpenOrdersAbort)
+	}
+
+	switch policy {
+	case OpenOrdersCancel:
+		printer.Printf("Cancelling open orders...\n")
+		for _, order := range openOrders {
+			if err := broker.CancelOrder(order.ID); err != nil {
+				return err
+			}
+		}
+	case OpenOrdersNet:
+		autopilot.SetOpenOrders(openOrders...)
+	case OpenOrdersAbort:
+		return fmt.Errorf("aborted because of %d open orders", len(openOrders))
+	}
+	return nil
+}
+
+// estimateSales Estimates the gains of the sell orders of a plan. Sales without lot method are estimated with the lot method
+// of the broker, FIFO is assumed if the broker does not report it.
+func estimateSales(broker broker.Broker, orders []model.Order, printer *output.Printer) ([]tax.Summary, error) {
+	sold := []model.Asset{}
+	assumed := false
+	for _, order := range orders {
+		if order.Type == model.OrderTypeSell {
+			sold = append(sold, order.Asset)
+			assumed = assumed || order.LotMethod == 0
+		}
+	}
+	if len(sold) == 0 {
+		return make([]tax.Summary, len(orders)), nil
+	}
+	positions, err := broker.GetPositions(sold...)
+	if err != nil {
+		return nil, err
+	}
+	method, known := lotMethod(broker)
+	if assumed && !known && hasLots(positions) {
+		printer.Printf("The estimated gains assume that the lots are sold FIFO, select the lots with --lots\n")
+	}
+	return tax.EstimateSales(positions, orders, method, time.Now())
+}
+
+// lotMethod Returns the lot method the broker sells with if an order does not select one, false if it does not report it
+func lotMethod(b broker.Broker) (model.LotMethod, bool) {
+	if tracker, ok := b.(broker.LotTracker); ok {
+		return tracker.GetLotMethod(), true
+	}
+	return model.LotMethodFIFO, false
+}
+
+func hasLots(positions []model.Position) bool {
+	for _, position := range positions {
+		if len(position.Lots) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func watch(account string, broker broker.Broker, orders []model.Order, executionOptions execution.Options, printer *output.Printer) error {
+	manager, err := execution.NewManager(broker, executionOptions)
+	if err != nil {
+		return err
+	}
+
+	printer.Printf("Submitting orders and watching them for %v...\n", executionOptions.Deadline)
+	report := manager.Run(orders...)
+	if err := printer.Print(output.NewExecutionReport(account, report)); err != nil {
+		return err
+	}
+	filled := len(report.Filled())
+	if filled < len(orders) {
+		return fmt.Errorf("%d/%d orders were not filled", len(orders)-filled, len(orders))
+	}
+	return nil
+}
+
+func askForConfirmation(s string, printer *output.Printer) bool {
 	reader := bufio.NewReader(os.Stdin)
 	for {
-		fmt.Printf("%s [y/n]: ", s)
+		printer.Printf("%s [y/n]: ", s)
 		response, err := reader.ReadString('\n')
 		if err != nil {
 			log.Fatal(err)
@@ -93,3 +231,20 @@ func askForConfirmation(s string) bool {
 		}
 	}
 }
+
+func askForChoice(s string, printer *output.Printer, choices ...string) string {
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		printer.Printf("%s [%s]: ", s, strings.Join(choices, "/"))
+		response, err := reader.ReadString('\n')
+		if err != nil {
+			log.Fatal(err)
+		}
+		response = strings.ToLower(strings.TrimSpace(response))
+		for _, choice := range choices {
+			if response == choice {
+				return choice
+			}
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/MitchK/autorobin/cmd/autorobin/config"
+	"github.com/MitchK/autorobin/cmd/autorobin/output"
+	"github.com/MitchK/autorobin/lib/broker"
+	"github.com/urfave/cli"
+)
+
+// configFlags Global flags that select the config file and profile
+var configFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:   "config",
+		EnvVar: "AUTOROBIN_CONFIG",
+		Usage:  "Load settings from the YAML `FILE` instead of autorobin/config.yaml in the XDG config dirs (see README)",
+	},
+	cli.StringFlag{
+		Name:   "profile",
+		EnvVar: "AUTOROBIN_PROFILE",
+		Usage:  "Apply the settings of profile `NAME` of the config file",
+	},
+}
+
+// secretFlags Returns the flags whose values must not be shown
+func secretFlags() map[string]bool {
+	secrets := map[string]bool{
+		"tiingo.token": true,
+		"passphrase":   true,
+	}
+	for _, registration := range broker.Registrations() {
+		for _, setting := range registration.Settings {
+			if setting.Secret {
+				secrets[brokerFlagName(registration.Name, setting.Name)] = true
+			}
+		}
+	}
+	return secrets
+}
+
+func flagName(flag cli.Flag) string {
+	return strings.TrimSpace(strings.Split(flag.GetName(), ",")[0])
+}
+
+// flagNames Returns the names of the flags of the app and all of its commands
+func flagNames(flags []cli.Flag, commands []cli.Command, names map[string]bool) map[string]bool {
+	for _, flag := range flags {
+		names[flagName(flag)] = true
+	}
+	for _, command := range commands {
+		flagNames(command.Flags, command.Subcommands, names)
+	}
+	return names
+}
+
+// loadSettings Loads the settings of the config file and the selected profile
+func loadSettings(c *cli.Context) (map[string]config.Value, error) {
+	paths := config.Paths()
+	if path := c.GlobalString("config"); path != "" {
+		paths = []string{path}
+	}
+	file, err := config.Load(paths...)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := file.Resolve(c.GlobalString("profile"))
+	if err != nil {
+		return nil, err
+	}
+	// subcommands run as apps of their own, only the root app has all flags
+	root := c
+	for root.Parent() != nil {
+		root = root.Parent()
+	}
+	known := flagNames(root.App.Flags, root.App.Commands, map[string]bool{})
+	for name, value := range settings {
+		if !known[name] || name == "config" || name == "profile" {
+			return nil, fmt.Errorf("unknown setting %s in %s", name, value.Source)
+		}
+	}
+	return settings, nil
+}
+
+// applySettings Sets the flags that are set neither on the command line nor by environment variable to the values of
+// the config file
+func applySettings(c *cli.Context, flags []cli.Flag) error {
+	settings, err := loadSettings(c)
+	if err != nil {
+		return err
+	}
+	for _, flag := range flags {
+		name := flagName(flag)
+		value, exists := settings[name]
+		if !exists || c.IsSet(name) {
+			continue
+		}
+		for _, str := range value.Values {
+			if err := c.Set(name, str); err != nil {
+				return fmt.Errorf("invalid value %q of %s in %s: %v", str, name, value.Source, err)
+			}
+		}
+	}
+	return nil
+}
+
+// withSettings Applies the config file to the flags of the commands and their subcommands
+func withSettings(commands []cli.Command) []cli.Command {
+	for i := range commands {
+		command := &commands[i]
+		if len(command.Subcommands) > 0 {
+			command.Subcommands = withSettings(command.Subcommands)
+			continue
+		}
+		flags := command.Flags
+		command.Before = func(c *cli.Context) error {
+			return applySettings(c, flags)
+		}
+	}
+	return commands
+}
+
+// flagSource Returns the environment variable and the default value of a flag
+func flagSource(flag cli.Flag) (string, string) {
+	switch flag := flag.(type) {
+	case cli.StringFlag:
+		return flag.EnvVar, flag.Value
+	case cli.BoolFlag:
+		return flag.EnvVar, "false"
+	case cli.IntFlag:
+		return flag.EnvVar, fmt.Sprint(flag.Value)
+	case cli.Float64Flag:
+		return flag.EnvVar, fmt.Sprint(flag.Value)
+	case cli.DurationFlag:
+		return flag.EnvVar, flag.Value.String()
+	case cli.StringSliceFlag:
+		if flag.Value == nil {
+			return flag.EnvVar, ""
+		}
+		return flag.EnvVar, strings.Join(flag.Value.Value(), ",")
+	}
+	return "", ""
+}
+
+// showSettings Returns the effective settings of flags, as they apply without command line flags. Secrets are redacted.
+func showSettings(flags []cli.Flag, settings map[string]config.Value) output.Settings {
+	secrets := secretFlags()
+	document := output.Settings{
+		Settings: []output.Setting{},
+	}
+	for _, flag := range flags {
+		name := flagName(flag)
+		if name == "help" {
+			continue
+		}
+		envVar, value := flagSource(flag)
+		source := "default"
+		if setting, exists := settings[name]; exists {
+			value = strings.Join(setting.Values, ",")
+			source = setting.Source
+		}
+		for _, env := range strings.Split(envVar, ",") {
+			env = strings.TrimSpace(env)
+			if env == "" {
+				continue
+			}
+			if str, exists := os.LookupEnv(env); exists {
+				value = str
+				source = "env " + env
+				break
+			}
+		}
+		if secrets[name] {
+			value = config.Redact(value)
+		}
+		document.Settings = append(document.Settings, output.Setting{
+			Name:   name,
+			Value:  value,
+			Source: source,
+		})
+	}
+	return document
+}
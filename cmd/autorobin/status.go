@@ -0,0 +1,39 @@
+package main
+
+import (
+	"log/slog"
+
+	"github.com/MitchK/autorobin/cmd/autorobin/output"
+	"github.com/MitchK/autorobin/lib/broker"
+	"github.com/MitchK/autorobin/lib/model"
+)
+
+// showStatus Prints the holdings of the account of a registered broker compared to the target weights, including the
+// holdings that are not part of the target portfolio and the drift of the asset classes of the allocation if there is one
+func showStatus(weights model.Weights, assets []model.Asset, allocation *model.Allocation, brokerName string, brokerConfig broker.Config, printer *output.Printer, logger *slog.Logger) error {
+	account, err := broker.New(brokerName, brokerConfig, logger)
+	if err != nil {
+		return err
+	}
+	cash, err := account.GetAvailableCash()
+	if err != nil {
+		return err
+	}
+	positions, err := account.GetAllPositions()
+	if err != nil {
+		return err
+	}
+
+	// quotes of the target assets and of the other holdings
+	quoted := append([]model.Asset{}, assets...)
+	for _, position := range positions {
+		if _, ok := weights[position.Asset]; !ok {
+			quoted = append(quoted, position.Asset)
+		}
+	}
+	quotes, err := account.GetQuotes(quoted...)
+	if err != nil {
+		return err
+	}
+	return printer.Print(output.NewStatus(cash, positions, quotes, weights, assets, allocation))
+}
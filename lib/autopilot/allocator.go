@@ -0,0 +1,172 @@
+package autopilot
+
+import (
+	"math"
+	"sort"
+
+	"github.com/MitchK/autorobin/lib/model"
+)
+
+// Allocation Input of an allocator
+type Allocation struct {
+	// Weights Desired weights
+	Weights model.Weights
+
+	// Prices Current prices
+	Prices model.Prices
+
+	// Quantities Currently held quantities
+	Quantities model.Quantities
+
+	// Total Value the desired weights refer to, i.e. value of the portfolio plus the cash that may be invested
+	Total float64
+
+	// Cash Cash available for purchases, proceeds of sales are not available in the same rebalance
+	Cash float64
+}
+
+// Allocator Computes the whole-share quantities a portfolio should hold after a rebalance
+type Allocator interface {
+	Allocate(allocation Allocation) model.Quantities
+}
+
+// OptimalAllocator Allocates whole shares globally, minimizing the tracking error to the desired weights.
+// It starts with a greedy allocation and improves it by swapping single shares between assets until no swap reduces the error any further.
+type OptimalAllocator struct{}
+
+// NewOptimalAllocator NewOptimalAllocator
+func NewOptimalAllocator() Allocator {
+	return &OptimalAllocator{}
+}
+
+// maxImprovements Upper bound for improvement rounds, every round strictly reduces the error
+const maxImprovements = 10000
+
+// allocationState Quantities of an allocation that is being optimized
+type allocationState struct {
+	allocation Allocation
+	assets     []model.Asset
+	quantities model.Quantities
+	cashUsed   float64
+}
+
+// deviation Difference between the value of an asset and its desired value if the quantity was changed by delta
+func (state *allocationState) deviation(asset model.Asset, delta float64) float64 {
+	return (state.quantities[asset]+delta)*state.allocation.Prices[asset] - state.allocation.Weights[asset]*state.allocation.Total
+}
+
+// gain Reduction of the squared error if the quantity of an asset was changed by delta
+func (state *allocationState) gain(asset model.Asset, delta float64) float64 {
+	before := state.deviation(asset, 0)
+	after := state.deviation(asset, delta)
+	return before*before - after*after
+}
+
+// cashDelta Cash that changing the quantity of an asset by delta uses, sales below the held quantity do not free any cash
+func (state *allocationState) cashDelta(asset model.Asset, delta float64) float64 {
+	held := state.allocation.Quantities[asset]
+	before := math.Max(0, state.quantities[asset]-held)
+	after := math.Max(0, state.quantities[asset]+delta-held)
+	return (after - before) * state.allocation.Prices[asset]
+}
+
+func (state *allocationState) isAffordable(cashDelta float64) bool {
+	return state.cashUsed+cashDelta <= state.allocation.Cash+1e-9
+}
+
+func (state *allocationState) change(asset model.Asset, delta float64) {
+	state.cashUsed += state.cashDelta(asset, delta)
+	state.quantities[asset] += delta
+}
+
+// buyBest Buys one share of the asset that reduces the error the most, returns false if no purchase reduces it
+func (state *allocationState) buyBest() bool {
+	var best model.Asset
+	var bestGain float64
+	for _, asset := range state.assets {
+		gain := state.gain(asset, 1)
+		if gain > bestGain && state.isAffordable(state.cashDelta(asset, 1)) {
+			best = asset
+			bestGain = gain
+		}
+	}
+	if bestGain <= 0 {
+		return false
+	}
+	state.change(best, 1)
+	return true
+}
+
+// swapBest Moves one share from one asset to another if that reduces the error, returns false if no swap reduces it
+func (state *allocationState) swapBest() bool {
+	var bestFrom, bestTo model.Asset
+	var bestGain float64
+	for _, from := range state.assets {
+		if state.quantities[from] < 1 {
+			continue
+		}
+		sellGain := state.gain(from, -1)
+		sellCash := state.cashDelta(from, -1)
+		for _, to := range state.assets {
+			if from == to {
+				continue
+			}
+			gain := sellGain + state.gain(to, 1)
+			if gain > bestGain && state.isAffordable(sellCash+state.cashDelta(to, 1)) {
+				bestFrom = from
+				bestTo = to
+				bestGain = gain
+			}
+		}
+	}
+	if bestGain <= 1e-9 {
+		return false
+	}
+	state.change(bestFrom, -1)
+	state.change(bestTo, 1)
+	return true
+}
+
+// Allocate Allocate
+func (allocator *OptimalAllocator) Allocate(allocation Allocation) model.Quantities {
+	state := &allocationState{
+		allocation: allocation,
+		quantities: model.Quantities{},
+	}
+	for asset, quantity := range allocation.Quantities {
+		state.quantities[asset] = quantity
+	}
+	for asset := range allocation.Weights {
+		if allocation.Prices[asset] <= 0 {
+			continue
+		}
+		state.assets = append(state.assets, asset)
+	}
+	// iterate in a deterministic order
+	sortAssets(state.assets)
+
+	// Sell overallocated shares as long as it reduces the error, sales do not need cash
+	for _, asset := range state.assets {
+		for state.quantities[asset] >= 1 && state.gain(asset, -1) > 0 {
+			state.change(asset, -1)
+		}
+	}
+
+	// Greedily buy the shares that reduce the error the most
+	for state.buyBest() {
+	}
+
+	// Improve by swapping shares, every swap may free cash for further purchases
+	for i := 0; i < maxImprovements && state.swapBest(); i++ {
+		for state.buyBest() {
+		}
+	}
+
+	return state.quantities
+}
+
+func sortAssets(assets []model.Asset) {
+	sort.Slice(assets, func(i, j int) bool {
+		return assets[i].Symbol < assets[j].Symbol
+	})
+}
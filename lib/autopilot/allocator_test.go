@@ -0,0 +1,104 @@
+package autopilot_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/MitchK/autorobin/lib/autopilot"
+	"github.com/MitchK/autorobin/lib/mocks"
+	"github.com/MitchK/autorobin/lib/model"
+	"github.com/golang/mock/gomock"
+	"github.com/onsi/gomega"
+)
+
+func TestOptimalAllocator(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	a := model.Asset{Symbol: "A"}
+	b := model.Asset{Symbol: "B"}
+	c := model.Asset{Symbol: "C"}
+	allocator := autopilot.NewOptimalAllocator()
+
+	// expensive shares and a small account
+	quantities := allocator.Allocate(autopilot.Allocation{
+		Weights:    model.Weights{a: 0.4, b: 0.4, c: 0.2},
+		Prices:     model.Prices{a: 300, b: 250, c: 40},
+		Quantities: model.Quantities{},
+		Total:      1000,
+		Cash:       1000,
+	})
+	value := quantities[a]*300 + quantities[b]*250 + quantities[c]*40
+	g.Expect(value).To(gomega.BeNumerically("<=", 1000))
+	g.Expect(value).To(gomega.BeNumerically(">=", 960))
+	for _, quantity := range quantities {
+		g.Expect(quantity).To(gomega.Equal(math.Floor(quantity)))
+	}
+
+	// sale proceeds are not available for purchases
+	quantities = allocator.Allocate(autopilot.Allocation{
+		Weights:    model.Weights{a: 0.5, b: 0.5},
+		Prices:     model.Prices{a: 10, b: 10},
+		Quantities: model.Quantities{a: 10, b: 0},
+		Total:      100,
+		Cash:       0,
+	})
+	g.Expect(quantities[a]).To(gomega.BeNumerically("~", 5))
+	g.Expect(quantities[b]).To(gomega.BeNumerically("~", 0))
+}
+
+func TestPlanWithOptimalAllocator(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockBroker := mocks.NewMockBroker(mockCtrl)
+
+	a := model.Asset{Symbol: "A"}
+	b := model.Asset{Symbol: "B"}
+	c := model.Asset{Symbol: "C"}
+	assets := []model.Asset{a, b, c}
+	desiredWeights := model.Weights{a: 0.4, b: 0.4, c: 0.2}
+	prices := model.Prices{a: 300, b: 250, c: 40}
+	actualPortfolio := model.Portfolio{
+		Weights:    model.Weights{a: 0, b: 0, c: 0},
+		Prices:     prices,
+		Quantities: model.Quantities{a: 0, b: 0, c: 0},
+		TotalValue: 0,
+	}
+	mockBroker.EXPECT().GetAvailableCash().Return(1000.0, nil).Times(2)
+	mockBroker.EXPECT().GetPortfolio(gomock.Eq(a), gomock.Eq(b), gomock.Eq(c)).Return(actualPortfolio, nil).Times(2)
+	pilot, err := autopilot.NewAutopilot(mockBroker)
+	g.Expect(err).To(gomega.BeNil())
+
+	// tracking error and idle cash of a plan
+	evaluate := func(orders []model.Order) (float64, float64) {
+		values := map[model.Asset]float64{}
+		var invested float64
+		for _, order := range orders {
+			g.Expect(order.Type).To(gomega.Equal(model.OrderTypeBuy))
+			values[order.Asset] += order.Value()
+			invested += order.Value()
+		}
+		var trackingError float64
+		for _, asset := range assets {
+			diff := values[asset]/1000 - desiredWeights[asset]
+			trackingError += diff * diff
+		}
+		return trackingError, 1000 - invested
+	}
+
+	orders, err := pilot.Rebalance(desiredWeights, false, assets...)
+	g.Expect(err).To(gomega.BeNil())
+	floorError, floorCash := evaluate(orders)
+
+	err = pilot.SetOptions(autopilot.Options{
+		Allocator: autopilot.NewOptimalAllocator(),
+	})
+	g.Expect(err).To(gomega.BeNil())
+	orders, err = pilot.Rebalance(desiredWeights, false, assets...)
+	g.Expect(err).To(gomega.BeNil())
+	optimalError, optimalCash := evaluate(orders)
+
+	g.Expect(optimalError).To(gomega.BeNumerically("<", floorError))
+	g.Expect(optimalCash).To(gomega.BeNumerically("<", floorCash))
+	g.Expect(optimalCash).To(gomega.BeNumerically(">=", 0))
+}
@@ -1,16 +1,20 @@
 package autopilot
 
 import (
-	"fmt"
+	"log/slog"
 	"math"
+	"time"
 
 	"github.com/MitchK/autorobin/lib/broker"
+	"github.com/MitchK/autorobin/lib/logging"
 	"github.com/MitchK/autorobin/lib/model"
 )
 
 // Autopilot Autopilot
 type Autopilot struct {
-	broker broker.Broker
+	broker     broker.Broker
+	options    Options
+	openOrders []model.Order
 }
 
 // NewAutopilot NewAutopilot
@@ -25,22 +29,166 @@ func (autopilot *Autopilot) GetBroker() broker.Broker {
 	return autopilot.broker
 }
 
+// SetOptions SetOptions
+func (autopilot *Autopilot) SetOptions(options Options) error {
+	if err := options.validate(); err != nil {
+		return err
+	}
+	autopilot.options = options
+	return nil
+}
+
+// GetOptions GetOptions
+func (autopilot *Autopilot) GetOptions() Options {
+	return autopilot.options
+}
+
+// SetOpenOrders Sets orders that are still open at the broker. Rebalance treats them as if they were filled.
+func (autopilot *Autopilot) SetOpenOrders(orders ...model.Order) {
+	autopilot.openOrders = orders
+}
+
+func (autopilot *Autopilot) logger() *slog.Logger {
+	return logging.Or(autopilot.options.Logger)
+}
+
+func (autopilot *Autopilot) now() time.Time {
+	if autopilot.options.Now != nil {
+		return autopilot.options.Now()
+	}
+	return time.Now()
+}
+
 // Rebalance Rebalance
 func (autopilot *Autopilot) Rebalance(desiredWeights model.Weights, partials bool, assets ...model.Asset) ([]model.Order, error) {
+	plan, err := autopilot.Plan(desiredWeights, partials, assets...)
+	if err != nil {
+		return nil, err
+	}
+	return plan.Orders, nil
+}
+
+// Plan Creates the orders of a rebalance, orders that violate the trade limits are dropped
+func (autopilot *Autopilot) Plan(desiredWeights model.Weights, partials bool, assets ...model.Asset) (model.Plan, error) {
 
 	// Get available cash
 	availableCash, err := autopilot.broker.GetAvailableCash()
 	if err != nil {
-		return nil, err
+		return model.Plan{}, err
+	}
+	summary := model.Plan{
+		Cash: availableCash,
 	}
-	fmt.Println("Unallocated cash:", availableCash)
 
-	// Get actual portfolio
-	actualPortfolio, err := autopilot.broker.GetPortfolio(assets...)
+	// Get actual portfolio, including the substitutes of harvested assets and the untargeted holdings unless they are ignored
+	harvest := autopilot.options.Harvest
+	portfolioAssets := harvest.WithSubstitutes(assets)
+	untargeted := []model.Asset{}
+	if autopilot.options.Untargeted.Policy != UntargetedIgnore {
+		untargeted, err = autopilot.untargetedAssets(portfolioAssets)
+		if err != nil {
+			return model.Plan{}, err
+		}
+		portfolioAssets = append(portfolioAssets, untargeted...)
+	}
+	actualPortfolio, err := autopilot.broker.GetPortfolio(portfolioAssets...)
 	if err != nil {
-		return nil, err
+		return model.Plan{}, err
+	}
+	summary.PortfolioValue = actualPortfolio.TotalValue
+	for _, asset := range untargeted {
+		summary.UntargetedValue += actualPortfolio.Quantities[asset] * actualPortfolio.Prices[asset]
+	}
+	if len(autopilot.openOrders) > 0 {
+		actualPortfolio = actualPortfolio.Apply(autopilot.openOrders...)
+		summary.OpenOrders = len(autopilot.openOrders)
+	}
+	summary.NettedValue = actualPortfolio.TotalValue
+
+	// Resolve the target of the schedule at the current time
+	if schedule := autopilot.options.Schedule; schedule != nil {
+		desiredWeights = schedule.Weights(autopilot.now())
+		for _, asset := range schedule.Assets() {
+			autopilot.logger().Debug("scheduled target weight", logging.KeySymbol, asset.Symbol, "weight", desiredWeights[asset])
+		}
+	}
+
+	// Compute the target of the weighting strategy from the trailing quotes
+	if autopilot.options.Weighting.IsEnabled() {
+		desiredWeights, err = autopilot.weights(assets)
+		if err != nil {
+			return model.Plan{}, err
+		}
+	}
+
+	// Resolve the target of the asset classes, classes within their bands keep their shares
+	if allocation := autopilot.options.Allocation; allocation != nil {
+		desiredWeights, err = allocation.Resolve(actualPortfolio)
+		if err != nil {
+			return model.Plan{}, err
+		}
+		for _, asset := range allocation.Members() {
+			autopilot.logger().Debug("resolved target weight", logging.KeySymbol, asset.Symbol, "weight", desiredWeights[asset])
+		}
+	}
+
+	// Harvest losses first, the rebalance treats the harvest as filled and the weights of harvested assets move to their substitutes
+	harvestOrders := []model.Order{}
+	if harvest.IsEnabled() {
+		harvestOrders, err = autopilot.harvest(actualPortfolio, partials, assets)
+		if err != nil {
+			return model.Plan{}, err
+		}
+		actualPortfolio = actualPortfolio.Apply(harvestOrders...)
+		desiredWeights, assets = harvest.substitute(desiredWeights, actualPortfolio, assets)
+	}
+
+	// Sell the share of the untargeted holdings that is liquidated by this rebalance, the proceeds are not available yet
+	liquidationOrders := []model.Order{}
+	if autopilot.options.Untargeted.Policy == UntargetedLiquidate {
+		liquidationOrders = autopilot.liquidate(actualPortfolio, partials, untargeted)
+		actualPortfolio = actualPortfolio.Apply(liquidationOrders...)
+	}
+
+	// Keep the cash reserve out of the market, refill it if it fell below its band
+	cashReserve := autopilot.options.CashReserve
+	total := actualPortfolio.TotalValue + availableCash
+	reserve := cashReserve.Target(total)
+	var shortfall float64
+	if reserve > 0 {
+		availableCash -= reserve
+		if availableCash < 0 {
+			if -availableCash > cashReserve.Band*total {
+				shortfall = -availableCash
+			}
+			availableCash = 0
+		}
+		summary.Reserve = reserve
+	}
+
+	// Raise the cash of a withdrawal, from available cash first and from sales for the rest
+	saleDescription := "Sale to refill cash reserve"
+	if withdrawal := autopilot.options.Withdrawal; withdrawal > 0 {
+		if withdrawal > availableCash {
+			shortfall += withdrawal - availableCash
+			availableCash = 0
+			saleDescription = "Sale to fund withdrawal"
+		} else {
+			availableCash -= withdrawal
+		}
+		summary.Withdrawal = withdrawal
+	}
+	summary.Investable = availableCash
+
+	if autopilot.options.Mode == ModeCashFlow {
+		orders := cashFlowOrders(desiredWeights, actualPortfolio, availableCash, shortfall, saleDescription, partials, assets)
+		return autopilot.plan(summary, harvestOrders, append(liquidationOrders, orders...)), nil
+	}
+
+	if autopilot.options.Allocator != nil && !partials {
+		orders := autopilot.allocate(desiredWeights, actualPortfolio, availableCash, shortfall, saleDescription, assets)
+		return autopilot.plan(summary, harvestOrders, append(liquidationOrders, orders...)), nil
 	}
-	fmt.Printf("Current portfolio value for assets %v: %v\n", assets, actualPortfolio.TotalValue)
 
 	// Create orders from diff
 	weightsDiff := desiredWeights.Diff(actualPortfolio.Weights)
@@ -56,6 +204,9 @@ func (autopilot *Autopilot) Rebalance(desiredWeights model.Weights, partials boo
 
 		// determine how much we can use to buy new stocks
 		volume := actualPortfolio.TotalValue * weightsDiff[asset]
+
+		// shrink the target by the share of the reserve shortfall
+		volume -= shortfall * desiredWeights[asset]
 		if volume >= availableCash {
 			volume = availableCash
 		}
@@ -63,6 +214,10 @@ func (autopilot *Autopilot) Rebalance(desiredWeights model.Weights, partials boo
 			description = "Purchase of missing stocks"
 			orderType = model.OrderTypeBuy
 			availableCash -= volume
+		} else if shortfall > 0 {
+			description = saleDescription
+			orderType = model.OrderTypeSell
+			volume *= -1
 		} else {
 			description = "Sale of excess stocks"
 			orderType = model.OrderTypeSell
@@ -111,5 +266,77 @@ func (autopilot *Autopilot) Rebalance(desiredWeights model.Weights, partials boo
 		}
 	}
 
-	return orders, nil
+	return autopilot.plan(summary, harvestOrders, append(liquidationOrders, orders...)), nil
+}
+
+// plan Selects the lots of the sell orders and applies the trade limits to the plan of the summary.
+// Harvest orders come first and are not limited, a harvest sale must not be kept without the purchase of its substitute.
+func (autopilot *Autopilot) plan(summary model.Plan, harvestOrders []model.Order, orders []model.Order) model.Plan {
+	for i := range orders {
+		if orders[i].Type == model.OrderTypeSell {
+			orders[i].LotMethod = autopilot.options.LotMethod
+		}
+	}
+	summary.Orders = orders
+	plan := autopilot.options.TradeLimits.Apply(summary)
+	plan.Orders = append(harvestOrders, plan.Orders...)
+
+	logger := autopilot.logger()
+	for _, order := range plan.Orders {
+		logger.Debug("planned order", append(logging.Order(order), "description", order.Description)...)
+	}
+	for _, dropped := range plan.Dropped {
+		logger.Debug("dropped order", append(logging.Order(dropped.Order), "reason", dropped.Reason)...)
+	}
+	logger.Info(
+		"created plan",
+		"cash", plan.Cash,
+		"portfolio_value", plan.PortfolioValue,
+		"untargeted_value", plan.UntargetedValue,
+		"open_orders", plan.OpenOrders,
+		"investable", plan.Investable,
+		"orders", len(plan.Orders),
+		"dropped", len(plan.Dropped),
+	)
+	return plan
+}
+
+// allocate Creates the orders that turn the portfolio into the allocation of the allocator
+func (autopilot *Autopilot) allocate(desiredWeights model.Weights, actualPortfolio model.Portfolio, availableCash float64, shortfall float64, saleDescription string, assets []model.Asset) []model.Order {
+	weights := model.Weights{}
+	for _, asset := range assets {
+		weights[asset] = desiredWeights[asset]
+	}
+	quantities := autopilot.options.Allocator.Allocate(Allocation{
+		Weights:    weights,
+		Prices:     actualPortfolio.Prices,
+		Quantities: actualPortfolio.Quantities,
+		Total:      actualPortfolio.TotalValue + availableCash - shortfall,
+		Cash:       availableCash,
+	})
+
+	orders := []model.Order{}
+	for _, asset := range assets {
+		quantity := quantities[asset] - actualPortfolio.Quantities[asset]
+		order := model.Order{
+			Asset: asset,
+			Price: actualPortfolio.Prices[asset],
+		}
+		if quantity >= 1 {
+			order.Description = "Purchase towards optimal allocation"
+			order.Type = model.OrderTypeBuy
+			order.Quantity = quantity
+		} else if quantity <= -1 {
+			order.Description = "Sale towards optimal allocation"
+			if shortfall > 0 {
+				order.Description = saleDescription
+			}
+			order.Type = model.OrderTypeSell
+			order.Quantity = -quantity
+		} else {
+			continue
+		}
+		orders = append(orders, order)
+	}
+	return orders
 }
@@ -2,10 +2,12 @@ package autopilot_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/MitchK/autorobin/lib/autopilot"
 	"github.com/MitchK/autorobin/lib/mocks"
 	"github.com/MitchK/autorobin/lib/model"
+	"github.com/MitchK/autorobin/lib/weighting"
 	"github.com/golang/mock/gomock"
 	"github.com/onsi/gomega"
 )
@@ -80,3 +82,513 @@ func TestRebalance(t *testing.T) {
 	}
 	g.Expect(orderVolume).To(gomega.BeNumerically("~", availableCash))
 }
+
+func TestRebalanceNetsOpenOrders(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockBroker := mocks.NewMockBroker(mockCtrl)
+
+	// fixtures
+	a := model.Asset{Symbol: "A"}
+	b := model.Asset{Symbol: "B"}
+	desiredWeights := model.Weights{
+		a: 0.5,
+		b: 0.5,
+	}
+	// the cash for the open buy of A is already held by the broker
+	actualPortfolio := model.Portfolio{
+		Weights:    model.Weights{a: 0, b: 1},
+		Prices:     model.Prices{a: 1, b: 1},
+		Quantities: model.Quantities{a: 0, b: 50},
+		TotalValue: 50,
+	}
+	openOrders := []model.Order{
+		{ID: "1", Asset: a, Type: model.OrderTypeBuy, Price: 1, Quantity: 50, Status: model.OrderStatusOpen},
+	}
+
+	mockBroker.EXPECT().GetAvailableCash().Return(0.0, nil).Times(2)
+	mockBroker.EXPECT().GetPortfolio(gomock.Eq(a), gomock.Eq(b)).Return(actualPortfolio, nil).Times(2)
+	autopilot, err := autopilot.NewAutopilot(mockBroker)
+	g.Expect(err).To(gomega.BeNil())
+
+	// without the open order, B looks overallocated
+	orders, err := autopilot.Rebalance(desiredWeights, false, a, b)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(orders)).To(gomega.Equal(1))
+	g.Expect(orders[0].Type).To(gomega.Equal(model.OrderTypeSell))
+
+	// netting the open order results in a balanced portfolio
+	autopilot.SetOpenOrders(openOrders...)
+	plan, err := autopilot.Plan(desiredWeights, false, a, b)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(plan.Orders).To(gomega.BeEmpty())
+	g.Expect(plan.PortfolioValue).To(gomega.Equal(50.0))
+	g.Expect(plan.OpenOrders).To(gomega.Equal(1))
+	g.Expect(plan.NettedValue).To(gomega.Equal(100.0))
+}
+
+func TestRebalanceCashReserve(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockBroker := mocks.NewMockBroker(mockCtrl)
+
+	// fixtures
+	a := model.Asset{Symbol: "A"}
+	b := model.Asset{Symbol: "B"}
+	desiredWeights := model.Weights{
+		a: 0.5,
+		b: 0.5,
+	}
+	actualPortfolio := model.Portfolio{
+		Weights:    model.Weights{a: 0.5, b: 0.5},
+		Prices:     model.Prices{a: 1, b: 1},
+		Quantities: model.Quantities{a: 50, b: 50},
+		TotalValue: 100,
+	}
+	autopilot, err := autopilot.NewAutopilot(mockBroker)
+	g.Expect(err).To(gomega.BeNil())
+
+	// only cash above the fixed reserve is invested
+	err = autopilot.SetOptions(autopilotOptions(0, 20, 0))
+	g.Expect(err).To(gomega.BeNil())
+	mockBroker.EXPECT().GetAvailableCash().Return(30.0, nil)
+	mockBroker.EXPECT().GetPortfolio(gomock.Eq(a), gomock.Eq(b)).Return(actualPortfolio, nil)
+	plan, err := autopilot.Plan(desiredWeights, false, a, b)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(plan.Cash).To(gomega.Equal(30.0))
+	g.Expect(plan.Reserve).To(gomega.Equal(20.0))
+	g.Expect(plan.Investable).To(gomega.Equal(10.0))
+	orderVolume := 0.0
+	for _, order := range plan.Orders {
+		g.Expect(order.Type).To(gomega.Equal(model.OrderTypeBuy))
+		orderVolume += order.Price * order.Quantity
+	}
+	g.Expect(orderVolume).To(gomega.BeNumerically("~", 10))
+
+	// a shortfall within the band is tolerated
+	err = autopilot.SetOptions(autopilotOptions(0.1, 0, 0.05))
+	g.Expect(err).To(gomega.BeNil())
+	mockBroker.EXPECT().GetAvailableCash().Return(8.0, nil)
+	mockBroker.EXPECT().GetPortfolio(gomock.Eq(a), gomock.Eq(b)).Return(actualPortfolio, nil)
+	orders, err := autopilot.Rebalance(desiredWeights, false, a, b)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(orders).To(gomega.BeEmpty())
+
+	// a shortfall beyond the band is refilled by selling stocks
+	mockBroker.EXPECT().GetAvailableCash().Return(0.0, nil)
+	mockBroker.EXPECT().GetPortfolio(gomock.Eq(a), gomock.Eq(b)).Return(actualPortfolio, nil)
+	orders, err = autopilot.Rebalance(desiredWeights, false, a, b)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(orders)).To(gomega.Equal(2))
+	for _, order := range orders {
+		g.Expect(order.Type).To(gomega.Equal(model.OrderTypeSell))
+		g.Expect(order.Description).To(gomega.Equal("Sale to refill cash reserve"))
+		g.Expect(order.Quantity).To(gomega.BeNumerically("~", 5))
+	}
+
+	// invalid reserves are rejected
+	err = autopilot.SetOptions(autopilotOptions(0.1, 10, 0))
+	g.Expect(err).ToNot(gomega.BeNil())
+}
+
+func autopilotOptions(weight float64, amount float64, band float64) autopilot.Options {
+	return autopilot.Options{
+		CashReserve: autopilot.CashReserve{
+			Weight: weight,
+			Amount: amount,
+			Band:   band,
+		},
+	}
+}
+
+func TestRebalanceCashFlow(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockBroker := mocks.NewMockBroker(mockCtrl)
+
+	// fixtures
+	a := model.Asset{Symbol: "A"}
+	b := model.Asset{Symbol: "B"}
+	c := model.Asset{Symbol: "C"}
+	desiredWeights := model.Weights{
+		a: 1.0 / 3,
+		b: 1.0 / 3,
+		c: 1.0 / 3,
+	}
+	actualPortfolio := model.Portfolio{
+		Weights:    model.Weights{a: 0.2, b: 0.3, c: 0.5},
+		Prices:     model.Prices{a: 1, b: 1, c: 1},
+		Quantities: model.Quantities{a: 20, b: 30, c: 50},
+		TotalValue: 100,
+	}
+	pilot, err := autopilot.NewAutopilot(mockBroker)
+	g.Expect(err).To(gomega.BeNil())
+	err = pilot.SetOptions(autopilot.Options{Mode: autopilot.ModeCashFlow})
+	g.Expect(err).To(gomega.BeNil())
+
+	// cash goes to the most underweight asset first, nothing is sold
+	mockBroker.EXPECT().GetAvailableCash().Return(30.0, nil)
+	mockBroker.EXPECT().GetPortfolio(gomock.Eq(a), gomock.Eq(b), gomock.Eq(c)).Return(actualPortfolio, nil)
+	orders, err := pilot.Rebalance(desiredWeights, false, a, b, c)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(orders)).To(gomega.Equal(2))
+	g.Expect(orders[0].Asset).To(gomega.Equal(a))
+	g.Expect(orders[0].Type).To(gomega.Equal(model.OrderTypeBuy))
+	g.Expect(orders[0].Quantity).To(gomega.BeNumerically("~", 20))
+	g.Expect(orders[1].Asset).To(gomega.Equal(b))
+	g.Expect(orders[1].Type).To(gomega.Equal(model.OrderTypeBuy))
+	g.Expect(orders[1].Quantity).To(gomega.BeNumerically("~", 10))
+
+	// a withdrawal is funded by selling the most overweight asset
+	err = pilot.SetOptions(autopilot.Options{Mode: autopilot.ModeCashFlow, Withdrawal: 25, LotMethod: model.LotMethodMinimumGain})
+	g.Expect(err).To(gomega.BeNil())
+	mockBroker.EXPECT().GetAvailableCash().Return(10.0, nil)
+	mockBroker.EXPECT().GetPortfolio(gomock.Eq(a), gomock.Eq(b), gomock.Eq(c)).Return(actualPortfolio, nil)
+	orders, err = pilot.Rebalance(desiredWeights, false, a, b, c)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(orders)).To(gomega.Equal(1))
+	g.Expect(orders[0].Asset).To(gomega.Equal(c))
+	g.Expect(orders[0].Type).To(gomega.Equal(model.OrderTypeSell))
+	g.Expect(orders[0].Description).To(gomega.Equal("Sale to fund withdrawal"))
+	g.Expect(orders[0].Quantity).To(gomega.BeNumerically("~", 15))
+	g.Expect(orders[0].LotMethod).To(gomega.Equal(model.LotMethodMinimumGain))
+
+	// invalid modes are rejected
+	err = pilot.SetOptions(autopilot.Options{Mode: autopilot.Mode(5)})
+	g.Expect(err).ToNot(gomega.BeNil())
+}
+
+func TestHarvest(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockBroker := mocks.NewMockBroker(mockCtrl)
+
+	// fixtures
+	a := model.Asset{Symbol: "A"}
+	b := model.Asset{Symbol: "B"}
+	substitute := model.Asset{Symbol: "S"}
+	now := time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC)
+	desiredWeights := model.Weights{
+		a: 0.5,
+		b: 0.5,
+	}
+	actualPortfolio := model.Portfolio{
+		Weights:    model.Weights{a: 0.5, b: 0.5, substitute: 0},
+		Prices:     model.Prices{a: 80, b: 80, substitute: 40},
+		Quantities: model.Quantities{a: 10, b: 10, substitute: 0},
+		TotalValue: 1600,
+	}
+	positions := []model.Position{
+		{Asset: a, Quantity: 10, AvgBuyPrice: 100},
+		{Asset: b, Quantity: 10, AvgBuyPrice: 50},
+	}
+	pilot, err := autopilot.NewAutopilot(mockBroker)
+	g.Expect(err).To(gomega.BeNil())
+	err = pilot.SetOptions(autopilot.Options{
+		Harvest: autopilot.Harvest{
+			MinLossRatio: 0.1,
+			Substitutes:  map[model.Asset]model.Asset{a: substitute},
+		},
+		Now: func() time.Time { return now },
+	})
+	g.Expect(err).To(gomega.BeNil())
+
+	// the loss of A is harvested and its weight moves to the substitute
+	mockBroker.EXPECT().GetAvailableCash().Return(0.0, nil)
+	mockBroker.EXPECT().GetPortfolio(gomock.Eq(a), gomock.Eq(b), gomock.Eq(substitute)).Return(actualPortfolio, nil)
+	mockBroker.EXPECT().GetOrderHistory(gomock.Eq(now.AddDate(0, 0, -30))).Return([]model.Order{}, nil)
+	mockBroker.EXPECT().GetPositions(gomock.Eq(a), gomock.Eq(b)).Return(positions, nil)
+	orders, err := pilot.Rebalance(desiredWeights, false, a, b)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(orders)).To(gomega.Equal(2))
+	g.Expect(orders[0].Asset).To(gomega.Equal(a))
+	g.Expect(orders[0].Type).To(gomega.Equal(model.OrderTypeSell))
+	g.Expect(orders[0].Quantity).To(gomega.BeNumerically("~", 10))
+	g.Expect(orders[1].Asset).To(gomega.Equal(substitute))
+	g.Expect(orders[1].Type).To(gomega.Equal(model.OrderTypeBuy))
+	g.Expect(orders[1].Quantity).To(gomega.BeNumerically("~", 20))
+
+	// a purchase of A within the wash-sale window prevents the harvest
+	mockBroker.EXPECT().GetAvailableCash().Return(0.0, nil)
+	mockBroker.EXPECT().GetPortfolio(gomock.Eq(a), gomock.Eq(b), gomock.Eq(substitute)).Return(actualPortfolio, nil)
+	mockBroker.EXPECT().GetOrderHistory(gomock.Any()).Return([]model.Order{
+		{Asset: a, Type: model.OrderTypeBuy, Quantity: 1, FilledQuantity: 1, FilledAt: now.AddDate(0, 0, -10)},
+	}, nil)
+	mockBroker.EXPECT().GetPositions(gomock.Eq(a), gomock.Eq(b)).Return(positions, nil)
+	orders, err = pilot.Rebalance(desiredWeights, false, a, b)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(orders).To(gomega.BeEmpty())
+}
+
+func TestUntargeted(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockBroker := mocks.NewMockBroker(mockCtrl)
+
+	// fixtures
+	a := model.Asset{Symbol: "A"}
+	b := model.Asset{Symbol: "B"}
+	x := model.Asset{Symbol: "X"}
+	desiredWeights := model.Weights{
+		a: 0.5,
+		b: 0.5,
+	}
+	actualPortfolio := model.Portfolio{
+		Weights:    model.Weights{a: 0.4, b: 0.4, x: 0.2},
+		Prices:     model.Prices{a: 1, b: 1, x: 1},
+		Quantities: model.Quantities{a: 40, b: 40, x: 20},
+		TotalValue: 100,
+	}
+	positions := []model.Position{
+		{Asset: a, Quantity: 40},
+		{Asset: b, Quantity: 40},
+		{Asset: x, Quantity: 20},
+	}
+	pilot, err := autopilot.NewAutopilot(mockBroker)
+	g.Expect(err).To(gomega.BeNil())
+
+	// included holdings count toward the portfolio value, the assets are underweight but there is no cash to buy them
+	err = pilot.SetOptions(autopilot.Options{Untargeted: autopilot.Untargeted{Policy: autopilot.UntargetedInclude}})
+	g.Expect(err).To(gomega.BeNil())
+	mockBroker.EXPECT().GetAvailableCash().Return(0.0, nil)
+	mockBroker.EXPECT().GetAllPositions().Return(positions, nil)
+	mockBroker.EXPECT().GetPortfolio(gomock.Eq(a), gomock.Eq(b), gomock.Eq(x)).Return(actualPortfolio, nil)
+	plan, err := pilot.Plan(desiredWeights, false, a, b)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(plan.Orders).To(gomega.BeEmpty())
+	g.Expect(plan.PortfolioValue).To(gomega.Equal(100.0))
+	g.Expect(plan.UntargetedValue).To(gomega.Equal(20.0))
+
+	// a quarter of the holding is liquidated per rebalance, nothing else is traded before the proceeds arrive
+	err = pilot.SetOptions(autopilot.Options{Untargeted: autopilot.Untargeted{Policy: autopilot.UntargetedLiquidate, Rate: 0.25}})
+	g.Expect(err).To(gomega.BeNil())
+	mockBroker.EXPECT().GetAvailableCash().Return(0.0, nil)
+	mockBroker.EXPECT().GetAllPositions().Return(positions, nil)
+	mockBroker.EXPECT().GetPortfolio(gomock.Eq(a), gomock.Eq(b), gomock.Eq(x)).Return(actualPortfolio, nil)
+	plan, err = pilot.Plan(desiredWeights, false, a, b)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(plan.Orders)).To(gomega.Equal(1))
+	g.Expect(plan.Orders[0].Asset).To(gomega.Equal(x))
+	g.Expect(plan.Orders[0].Type).To(gomega.Equal(model.OrderTypeSell))
+	g.Expect(plan.Orders[0].Quantity).To(gomega.BeNumerically("~", 5))
+	g.Expect(plan.Orders[0].Description).To(gomega.Equal("Liquidation of holding not in the desired portfolio"))
+
+	// invalid policies and rates are rejected
+	err = pilot.SetOptions(autopilot.Options{Untargeted: autopilot.Untargeted{Policy: autopilot.UntargetedPolicy(5)}})
+	g.Expect(err).ToNot(gomega.BeNil())
+	err = pilot.SetOptions(autopilot.Options{Untargeted: autopilot.Untargeted{Policy: autopilot.UntargetedLiquidate, Rate: 2}})
+	g.Expect(err).ToNot(gomega.BeNil())
+}
+
+func TestAllocationBands(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockBroker := mocks.NewMockBroker(mockCtrl)
+
+	// fixtures
+	a := model.Asset{Symbol: "A"}
+	b := model.Asset{Symbol: "B"}
+	allocation := model.Allocation{
+		Classes: []model.Allocation{
+			{Name: "stocks", Weight: 0.5, Band: 0.05, Assets: []model.Asset{a}},
+			{Name: "bonds", Weight: 0.5, Band: 0.05, Assets: []model.Asset{b}},
+		},
+	}
+	pilot, err := autopilot.NewAutopilot(mockBroker)
+	g.Expect(err).To(gomega.BeNil())
+	err = pilot.SetOptions(autopilot.Options{Allocation: &allocation})
+	g.Expect(err).To(gomega.BeNil())
+
+	// classes within their bands are not traded
+	mockBroker.EXPECT().GetAvailableCash().Return(0.0, nil)
+	mockBroker.EXPECT().GetPortfolio(gomock.Eq(a), gomock.Eq(b)).Return(model.Portfolio{
+		Weights:    model.Weights{a: 0.52, b: 0.48},
+		Prices:     model.Prices{a: 1, b: 1},
+		Quantities: model.Quantities{a: 52, b: 48},
+		TotalValue: 100,
+	}, nil)
+	orders, err := pilot.Rebalance(allocation.Weights(), false, a, b)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(orders).To(gomega.BeEmpty())
+
+	// a class outside its band is rebalanced to the target
+	mockBroker.EXPECT().GetAvailableCash().Return(0.0, nil)
+	mockBroker.EXPECT().GetPortfolio(gomock.Eq(a), gomock.Eq(b)).Return(model.Portfolio{
+		Weights:    model.Weights{a: 0.75, b: 0.25},
+		Prices:     model.Prices{a: 1, b: 1},
+		Quantities: model.Quantities{a: 75, b: 25},
+		TotalValue: 100,
+	}, nil)
+	orders, err = pilot.Rebalance(allocation.Weights(), false, a, b)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(orders)).To(gomega.Equal(1))
+	g.Expect(orders[0].Asset).To(gomega.Equal(a))
+	g.Expect(orders[0].Type).To(gomega.Equal(model.OrderTypeSell))
+	g.Expect(orders[0].Quantity).To(gomega.BeNumerically("~", 25))
+}
+
+func TestSchedule(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockBroker := mocks.NewMockBroker(mockCtrl)
+
+	// fixtures
+	a := model.Asset{Symbol: "A"}
+	b := model.Asset{Symbol: "B"}
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	schedule := model.GlidePath{
+		{Date: start, Weights: model.Weights{a: 1, b: 0}},
+		{Date: end, Weights: model.Weights{a: 0.5, b: 0.5}},
+	}
+	pilot, err := autopilot.NewAutopilot(mockBroker)
+	g.Expect(err).To(gomega.BeNil())
+	err = pilot.SetOptions(autopilot.Options{
+		Schedule: schedule,
+		Now: func() time.Time {
+			return start.Add(end.Sub(start) / 2)
+		},
+	})
+	g.Expect(err).To(gomega.BeNil())
+
+	// the weights of the schedule at the current time replace the desired weights
+	mockBroker.EXPECT().GetAvailableCash().Return(0.0, nil)
+	mockBroker.EXPECT().GetPortfolio(gomock.Eq(a), gomock.Eq(b)).Return(model.Portfolio{
+		Weights:    model.Weights{a: 0.5, b: 0.5},
+		Prices:     model.Prices{a: 1, b: 1},
+		Quantities: model.Quantities{a: 50, b: 50},
+		TotalValue: 100,
+	}, nil)
+	orders, err := pilot.Rebalance(model.Weights{a: 0.5, b: 0.5}, false, a, b)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(orders)).To(gomega.Equal(1))
+	g.Expect(orders[0].Asset).To(gomega.Equal(b))
+	g.Expect(orders[0].Type).To(gomega.Equal(model.OrderTypeSell))
+	g.Expect(orders[0].Quantity).To(gomega.BeNumerically("~", 25))
+
+	// a schedule cannot be combined with an allocation
+	err = pilot.SetOptions(autopilot.Options{Schedule: schedule, Allocation: &model.Allocation{}})
+	g.Expect(err).NotTo(gomega.BeNil())
+}
+
+func TestWeighting(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockBroker := mocks.NewMockBroker(mockCtrl)
+	mockAdapter := mocks.NewMockAdapter(mockCtrl)
+
+	// fixtures
+	a := model.Asset{Symbol: "A"}
+	b := model.Asset{Symbol: "B"}
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	pilot, err := autopilot.NewAutopilot(mockBroker)
+	g.Expect(err).To(gomega.BeNil())
+	err = pilot.SetOptions(autopilot.Options{
+		Weighting: autopilot.Weighting{
+			Strategy: weighting.NewEqualWeight(),
+			Lookback: 90,
+			History:  mockAdapter,
+		},
+		Now: func() time.Time {
+			return now
+		},
+	})
+	g.Expect(err).To(gomega.BeNil())
+
+	// the weights of the strategy for the lookback window replace the desired weights
+	mockBroker.EXPECT().GetAvailableCash().Return(0.0, nil)
+	mockBroker.EXPECT().GetPortfolio(gomock.Eq(a), gomock.Eq(b)).Return(model.Portfolio{
+		Weights:    model.Weights{a: 0.75, b: 0.25},
+		Prices:     model.Prices{a: 1, b: 1},
+		Quantities: model.Quantities{a: 75, b: 25},
+		TotalValue: 100,
+	}, nil)
+	mockAdapter.EXPECT().GetDailyAsc(now.AddDate(0, 0, -90), now, a, b).Return([][]model.Quote{{}, {}}, nil)
+	orders, err := pilot.Rebalance(model.Weights{a: 0.75, b: 0.25}, false, a, b)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(orders)).To(gomega.Equal(1))
+	g.Expect(orders[0].Asset).To(gomega.Equal(a))
+	g.Expect(orders[0].Type).To(gomega.Equal(model.OrderTypeSell))
+	g.Expect(orders[0].Quantity).To(gomega.BeNumerically("~", 25))
+
+	// a strategy requires a lookback window and history
+	err = pilot.SetOptions(autopilot.Options{Weighting: autopilot.Weighting{Strategy: weighting.NewEqualWeight(), History: mockAdapter}})
+	g.Expect(err).NotTo(gomega.BeNil())
+	err = pilot.SetOptions(autopilot.Options{Weighting: autopilot.Weighting{Strategy: weighting.NewEqualWeight(), Lookback: 90}})
+	g.Expect(err).NotTo(gomega.BeNil())
+}
+
+func TestTradeLimits(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	a := model.Asset{Symbol: "A"}
+	b := model.Asset{Symbol: "B"}
+	c := model.Asset{Symbol: "C"}
+	limits := autopilot.TradeLimits{
+		TradeLimit: autopilot.TradeLimit{
+			MinValue: 20,
+		},
+		Assets: map[model.Asset]autopilot.TradeLimit{
+			c: {MinQuantity: 2},
+		},
+		MaxOrders: 2,
+	}
+	plan := limits.Apply(model.Plan{
+		Orders: []model.Order{
+			{Asset: a, Type: model.OrderTypeBuy, Price: 5, Quantity: 3},   // below global minimum value
+			{Asset: b, Type: model.OrderTypeBuy, Price: 10, Quantity: 3},  // kept
+			{Asset: c, Type: model.OrderTypeSell, Price: 5, Quantity: 1},  // below minimum quantity of C
+			{Asset: c, Type: model.OrderTypeBuy, Price: 5, Quantity: 2},   // value below global minimum, but C has its own limit
+			{Asset: a, Type: model.OrderTypeSell, Price: 5, Quantity: 10}, // kept
+		},
+	})
+	g.Expect(len(plan.Orders)).To(gomega.Equal(2))
+	g.Expect(plan.Orders[0].Asset).To(gomega.Equal(b))
+	g.Expect(plan.Orders[1].Asset).To(gomega.Equal(a))
+	g.Expect(len(plan.Dropped)).To(gomega.Equal(3))
+	g.Expect(plan.Dropped[2].Order.Asset).To(gomega.Equal(c))
+	g.Expect(plan.Dropped[2].Reason).To(gomega.ContainSubstring("maximum"))
+	g.Expect(plan.DroppedValue()).To(gomega.BeNumerically("~", 15+5+10))
+}
+
+func TestPlanDropsSmallOrders(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockBroker := mocks.NewMockBroker(mockCtrl)
+
+	a := model.Asset{Symbol: "A"}
+	b := model.Asset{Symbol: "B"}
+	actualPortfolio := model.Portfolio{
+		Weights:    model.Weights{a: 0.5, b: 0.5},
+		Prices:     model.Prices{a: 3, b: 100},
+		Quantities: model.Quantities{a: 0, b: 0},
+		TotalValue: 0,
+	}
+	mockBroker.EXPECT().GetAvailableCash().Return(206.0, nil)
+	mockBroker.EXPECT().GetPortfolio(gomock.Eq(a), gomock.Eq(b)).Return(actualPortfolio, nil)
+	pilot, err := autopilot.NewAutopilot(mockBroker)
+	g.Expect(err).To(gomega.BeNil())
+	err = pilot.SetOptions(autopilot.Options{
+		TradeLimits: autopilot.TradeLimits{
+			TradeLimit: autopilot.TradeLimit{MinQuantity: 2},
+		},
+	})
+	g.Expect(err).To(gomega.BeNil())
+
+	plan, err := pilot.Plan(model.Weights{a: 0.5, b: 0.5}, false, a, b)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(plan.Orders)).To(gomega.Equal(1))
+	g.Expect(plan.Orders[0].Asset).To(gomega.Equal(a))
+	g.Expect(len(plan.Dropped)).To(gomega.Equal(1))
+	g.Expect(plan.Dropped[0].Order.Asset).To(gomega.Equal(b))
+	g.Expect(plan.DroppedValue()).To(gomega.BeNumerically("~", 100))
+}
@@ -0,0 +1,143 @@
+package autopilot
+
+import (
+	"math"
+	"sort"
+
+	"github.com/MitchK/autorobin/lib/model"
+)
+
+// cashFlowOrders Creates the orders of a cash-flow rebalance. Available cash is invested into the most underweight assets,
+// a shortfall is raised by selling the most overweight assets. No other sales are made.
+func cashFlowOrders(desiredWeights model.Weights, actualPortfolio model.Portfolio, availableCash float64, shortfall float64, saleDescription string, partials bool, assets []model.Asset) []model.Order {
+	// Target values of the portfolio after the cash was invested or the shortfall was raised
+	total := actualPortfolio.TotalValue + availableCash - shortfall
+	deviations := map[model.Asset]float64{}
+	for _, asset := range assets {
+		if actualPortfolio.Prices[asset] <= 0 {
+			continue
+		}
+		value := actualPortfolio.Quantities[asset] * actualPortfolio.Prices[asset]
+		deviations[asset] = value - desiredWeights[asset]*total
+	}
+
+	orders := []model.Order{}
+	if shortfall > 0 {
+		// positive deviations are overweight
+		volumes := waterFill(deviations, shortfall)
+		for _, asset := range assets {
+			volume, ok := volumes[asset]
+			if !ok || volume <= 0 {
+				continue
+			}
+			price := actualPortfolio.Prices[asset]
+			quantity := volume / price
+			if !partials {
+				// round up, the shortfall has to be raised completely
+				quantity = math.Ceil(quantity - 1e-9)
+			}
+			quantity = math.Min(quantity, actualPortfolio.Quantities[asset])
+			if quantity <= 0 {
+				continue
+			}
+			orders = append(orders, model.Order{
+				Description: saleDescription,
+				Type:        model.OrderTypeSell,
+				Quantity:    quantity,
+				Price:       price,
+				Asset:       asset,
+			})
+		}
+		return orders
+	}
+
+	if availableCash <= 0 {
+		return orders
+	}
+	underweights := map[model.Asset]float64{}
+	for asset, deviation := range deviations {
+		underweights[asset] = -deviation
+	}
+	volumes := waterFill(underweights, availableCash)
+	quantities := model.Quantities{}
+	for _, asset := range assets {
+		volume, ok := volumes[asset]
+		if !ok || volume <= 0 {
+			continue
+		}
+		price := actualPortfolio.Prices[asset]
+		quantity := volume / price
+		if !partials {
+			quantity = math.Floor(quantity)
+		}
+		quantities[asset] = quantity
+		availableCash -= quantity * price
+		underweights[asset] -= quantity * price
+	}
+
+	// Spend what rounding down left on single shares of the most underweight assets
+	for !partials {
+		var best model.Asset
+		var bestUnderweight float64
+		for _, asset := range assets {
+			underweight, ok := underweights[asset]
+			if ok && underweight > bestUnderweight && actualPortfolio.Prices[asset] <= availableCash {
+				best = asset
+				bestUnderweight = underweight
+			}
+		}
+		if bestUnderweight <= 0 {
+			break
+		}
+		price := actualPortfolio.Prices[best]
+		quantities[best]++
+		availableCash -= price
+		underweights[best] -= price
+	}
+
+	for _, asset := range assets {
+		quantity := quantities[asset]
+		if quantity <= 0 {
+			continue
+		}
+		orders = append(orders, model.Order{
+			Description: "Purchase of underweight stocks with available cash",
+			Type:        model.OrderTypeBuy,
+			Quantity:    quantity,
+			Price:       actualPortfolio.Prices[asset],
+			Asset:       asset,
+		})
+	}
+	return orders
+}
+
+// waterFill Distributes an amount over the positive gaps so that the largest gaps are closed first,
+// every gap is reduced to a common level until the amount is used up
+func waterFill(gaps map[model.Asset]float64, amount float64) map[model.Asset]float64 {
+	sorted := []float64{}
+	for _, gap := range gaps {
+		if gap > 0 {
+			sorted = append(sorted, gap)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(sorted)))
+
+	// find the level the largest gaps are reduced to
+	var level, sum float64
+	for i, gap := range sorted {
+		sum += gap
+		level = (sum - amount) / float64(i+1)
+		if i+1 == len(sorted) || level >= sorted[i+1] {
+			break
+		}
+	}
+	level = math.Max(level, 0)
+
+	amounts := map[model.Asset]float64{}
+	for asset, gap := range gaps {
+		if gap > level {
+			amounts[asset] = gap - level
+		}
+	}
+	return amounts
+}
@@ -0,0 +1,166 @@
+package autopilot
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/MitchK/autorobin/lib/logging"
+	"github.com/MitchK/autorobin/lib/model"
+	"github.com/MitchK/autorobin/lib/tax"
+)
+
+// Harvest Options of the tax-loss harvesting pass, it is disabled without substitutes.
+// Positions with an unrealized loss above both minimums are sold completely and replaced by their substitute.
+type Harvest struct {
+	// MinLoss Minimum unrealized loss in dollars
+	MinLoss float64
+
+	// MinLossRatio Minimum unrealized loss as a share of the cost basis, e.g. 0.05 for 5%
+	MinLossRatio float64
+
+	// Substitutes Asset that is bought for a harvested asset to keep the exposure, e.g. VTI for VOO
+	Substitutes map[model.Asset]model.Asset
+}
+
+// IsEnabled Returns true if substitutes are configured
+func (harvest Harvest) IsEnabled() bool {
+	return len(harvest.Substitutes) > 0
+}
+
+func (harvest Harvest) validate() error {
+	if harvest.MinLoss < 0 || harvest.MinLossRatio < 0 {
+		return errors.New("minimum harvest loss must not be negative")
+	}
+	for asset, substitute := range harvest.Substitutes {
+		if asset == substitute {
+			return fmt.Errorf("%s cannot be its own substitute", asset.Symbol)
+		}
+	}
+	return nil
+}
+
+// WithSubstitutes Returns the assets and their substitutes
+func (harvest Harvest) WithSubstitutes(assets []model.Asset) []model.Asset {
+	all := append([]model.Asset{}, assets...)
+	included := map[model.Asset]bool{}
+	for _, asset := range assets {
+		included[asset] = true
+	}
+	for _, asset := range assets {
+		substitute, ok := harvest.Substitutes[asset]
+		if ok && !included[substitute] {
+			all = append(all, substitute)
+			included[substitute] = true
+		}
+	}
+	return all
+}
+
+// substitute Moves the weight of every asset that is not held to its substitute if the substitute is held, so a harvested asset
+// is not bought back. Returns the weights and the assets including the substitutes that received a weight.
+func (harvest Harvest) substitute(desiredWeights model.Weights, portfolio model.Portfolio, assets []model.Asset) (model.Weights, []model.Asset) {
+	weights := model.Weights{}
+	for asset, weight := range desiredWeights {
+		weights[asset] = weight
+	}
+	substituted := append([]model.Asset{}, assets...)
+	included := map[model.Asset]bool{}
+	for _, asset := range assets {
+		included[asset] = true
+	}
+	for _, asset := range assets {
+		substitute, ok := harvest.Substitutes[asset]
+		if !ok || portfolio.Quantities[asset] > 0 || portfolio.Quantities[substitute] <= 0 {
+			continue
+		}
+		weights[substitute] += weights[asset]
+		weights[asset] = 0
+		if !included[substitute] {
+			substituted = append(substituted, substitute)
+			included[substitute] = true
+		}
+	}
+	return weights, substituted
+}
+
+// harvest Creates the sales of positions with losses and the purchases of their substitutes.
+// Assets with open orders and sales that would be wash sales are skipped.
+func (autopilot *Autopilot) harvest(portfolio model.Portfolio, partials bool, assets []model.Asset) ([]model.Order, error) {
+	harvest := autopilot.options.Harvest
+	history, err := autopilot.broker.GetOrderHistory(autopilot.now().Add(-tax.WashSaleWindow))
+	if err != nil {
+		return nil, err
+	}
+	positions, err := autopilot.broker.GetPositions(assets...)
+	if err != nil {
+		return nil, err
+	}
+
+	// a purchase of the asset in the window disallows the loss, a purchase of the substitute would disallow a loss of its previous sale
+	blocked := map[model.Asset]bool{}
+	for _, order := range history {
+		if order.Type == model.OrderTypeBuy {
+			blocked[order.Asset] = true
+		}
+	}
+	for asset, substitute := range harvest.Substitutes {
+		for _, order := range history {
+			if order.Type == model.OrderTypeSell && order.Asset == substitute {
+				blocked[asset] = true
+			}
+		}
+	}
+	for _, order := range autopilot.openOrders {
+		blocked[order.Asset] = true
+		for asset, substitute := range harvest.Substitutes {
+			if order.Asset == substitute {
+				blocked[asset] = true
+			}
+		}
+	}
+
+	orders := []model.Order{}
+	for _, position := range positions {
+		asset := position.Asset
+		substitute, ok := harvest.Substitutes[asset]
+		if !ok || position.Quantity <= 0 {
+			continue
+		}
+		if blocked[asset] {
+			autopilot.logger().Debug("skipping harvest because of the wash-sale window or open orders", logging.KeySymbol, asset.Symbol, "substitute", substitute.Symbol)
+			continue
+		}
+		price := portfolio.Prices[asset]
+		substitutePrice := portfolio.Prices[substitute]
+		if price <= 0 || substitutePrice <= 0 {
+			continue
+		}
+		cost := position.AvgBuyPrice * position.Quantity
+		loss := cost - price*position.Quantity
+		if loss <= 0 || loss < harvest.MinLoss || loss < harvest.MinLossRatio*cost {
+			continue
+		}
+		quantity := price * position.Quantity / substitutePrice
+		if !partials {
+			quantity = math.Floor(quantity)
+			if quantity < 1 {
+				continue
+			}
+		}
+		orders = append(orders, model.Order{
+			Description: fmt.Sprintf("Tax-loss harvest of %.2f", loss),
+			Type:        model.OrderTypeSell,
+			Quantity:    position.Quantity,
+			Price:       price,
+			Asset:       asset,
+		}, model.Order{
+			Description: fmt.Sprintf("Substitute for harvested %s", asset.Symbol),
+			Type:        model.OrderTypeBuy,
+			Quantity:    quantity,
+			Price:       substitutePrice,
+			Asset:       substitute,
+		})
+	}
+	return orders, nil
+}
@@ -0,0 +1,231 @@
+package autopilot
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/MitchK/autorobin/lib/model"
+)
+
+const (
+	// ModeFull Buys and sells to bring the portfolio back to its desired weights
+	ModeFull Mode = iota
+
+	// ModeCashFlow Never sells to rebalance, only invests available cash into the most underweight assets.
+	// Withdrawals and cash reserve shortfalls are funded by selling the most overweight assets.
+	ModeCashFlow
+)
+
+// Mode Mode
+type Mode int
+
+// Options Options
+type Options struct {
+	// Allocation Hierarchical target allocation, the desired weights of a plan are resolved from it for the current
+	// portfolio if set. The assets of the plan have to include all of its assets.
+	Allocation *model.Allocation
+
+	// Schedule Target weights that change over time, e.g. a glide path. The desired weights of a plan are the ones of
+	// the schedule at the current time if set, so a backtest uses the target of each simulated day.
+	Schedule model.Schedule
+
+	// Weighting Computes the desired weights of a plan from the trailing quotes of its assets if a strategy is set
+	Weighting Weighting
+
+	Mode        Mode
+	CashReserve CashReserve
+	TradeLimits TradeLimits
+
+	// LotMethod Lot method of sell orders, e.g. model.LotMethodMinimumGain to prefer sales that realize the lowest gains.
+	// The broker's default is used if not set.
+	LotMethod model.LotMethod
+
+	// Harvest Tax-loss harvesting before the rebalance
+	Harvest Harvest
+
+	// Untargeted Handling of the holdings of assets that are not part of the desired portfolio, they are ignored if not set
+	Untargeted Untargeted
+
+	// Now Returns the current time, e.g. the simulated date of a backtest. time.Now is used if not set.
+	Now func() time.Time
+
+	// Withdrawal Cash to raise for a withdrawal, it is taken from the available cash first and from sales for the rest
+	Withdrawal float64
+
+	// Allocator Allocates whole shares if set, otherwise every asset is rounded down on its own.
+	// It is not used in cash-flow mode.
+	Allocator Allocator
+
+	// Logger Logs the orders and decisions of the plans, silent if not set
+	Logger *slog.Logger
+}
+
+// CashReserve Cash that is kept out of the market. It is treated like an asset with its own weight and band:
+// the autopilot never buys into the reserve and sells stocks to refill it once it falls below its band.
+type CashReserve struct {
+	// Amount Fixed amount of cash
+	Amount float64
+
+	// Weight Share of the total value of portfolio and cash, e.g. 0.05 for 5%
+	Weight float64
+
+	// Band Tolerated shortfall as a share of the total value before stocks are sold to refill the reserve
+	Band float64
+}
+
+// Target Returns the cash that should be held for the given total value of portfolio and cash
+func (reserve CashReserve) Target(total float64) float64 {
+	if reserve.Amount > 0 {
+		return reserve.Amount
+	}
+	return reserve.Weight * total
+}
+
+func (reserve CashReserve) validate() error {
+	if reserve.Amount < 0 || reserve.Weight < 0 || reserve.Band < 0 {
+		return errors.New("cash reserve must not be negative")
+	}
+	if reserve.Amount > 0 && reserve.Weight > 0 {
+		return errors.New("cash reserve can either be a fixed amount or a weight, not both")
+	}
+	if reserve.Weight >= 1 {
+		return errors.New("cash reserve weight must be less than 1")
+	}
+	return nil
+}
+
+// TradeLimit Orders below the minimum value or quantity are dropped
+type TradeLimit struct {
+	MinValue    float64
+	MinQuantity float64
+}
+
+// TradeLimits Global trade limits, overrides per asset and the maximum number of orders per rebalance
+type TradeLimits struct {
+	TradeLimit
+	Assets map[model.Asset]TradeLimit
+
+	// MaxOrders Maximum number of orders per rebalance, 0 means unlimited. The orders with the highest value are kept.
+	MaxOrders int
+}
+
+// For Returns the trade limit of an asset
+func (limits TradeLimits) For(asset model.Asset) TradeLimit {
+	if limit, ok := limits.Assets[asset]; ok {
+		return limit
+	}
+	return limits.TradeLimit
+}
+
+// Apply Moves the orders that violate the limits from the orders of the plan to its dropped orders
+func (limits TradeLimits) Apply(plan model.Plan) model.Plan {
+	orders := []model.Order{}
+	for _, order := range plan.Orders {
+		limit := limits.For(order.Asset)
+		if order.Quantity < limit.MinQuantity {
+			plan.Dropped = append(plan.Dropped, model.DroppedOrder{
+				Order:  order,
+				Reason: fmt.Sprintf("quantity below minimum of %v", limit.MinQuantity),
+			})
+		} else if order.Value() < limit.MinValue {
+			plan.Dropped = append(plan.Dropped, model.DroppedOrder{
+				Order:  order,
+				Reason: fmt.Sprintf("value below minimum of %v", limit.MinValue),
+			})
+		} else {
+			orders = append(orders, order)
+		}
+	}
+
+	if limits.MaxOrders > 0 && len(orders) > limits.MaxOrders {
+		// keep the orders with the highest value, in their original order
+		indices := make([]int, len(orders))
+		for i := range indices {
+			indices[i] = i
+		}
+		sort.SliceStable(indices, func(i, j int) bool {
+			return orders[indices[i]].Value() > orders[indices[j]].Value()
+		})
+		keep := make([]bool, len(orders))
+		for _, i := range indices[:limits.MaxOrders] {
+			keep[i] = true
+		}
+		kept := []model.Order{}
+		for i, order := range orders {
+			if keep[i] {
+				kept = append(kept, order)
+			} else {
+				plan.Dropped = append(plan.Dropped, model.DroppedOrder{
+					Order:  order,
+					Reason: fmt.Sprintf("maximum of %d orders reached", limits.MaxOrders),
+				})
+			}
+		}
+		orders = kept
+	}
+
+	plan.Orders = orders
+	return plan
+}
+
+func (limits TradeLimits) validate() error {
+	if limits.MaxOrders < 0 {
+		return errors.New("maximum number of orders must not be negative")
+	}
+	for asset, limit := range limits.Assets {
+		if limit.MinValue < 0 || limit.MinQuantity < 0 {
+			return fmt.Errorf("trade limit of %s must not be negative", asset.Symbol)
+		}
+	}
+	if limits.MinValue < 0 || limits.MinQuantity < 0 {
+		return errors.New("trade limit must not be negative")
+	}
+	return nil
+}
+
+func (options Options) validate() error {
+	if options.Mode != ModeFull && options.Mode != ModeCashFlow {
+		return fmt.Errorf("invalid mode: %v", options.Mode)
+	}
+	if options.LotMethod < 0 || options.LotMethod > model.LotMethodMinimumGain {
+		return fmt.Errorf("invalid lot method: %v", options.LotMethod)
+	}
+	if options.LotMethod == model.LotMethodSpecific {
+		return errors.New("specific lots can only be selected per order")
+	}
+	if err := options.Harvest.validate(); err != nil {
+		return err
+	}
+	if err := options.Untargeted.validate(); err != nil {
+		return err
+	}
+	if options.Allocation != nil {
+		if err := options.Allocation.Validate(); err != nil {
+			return err
+		}
+	}
+	if options.Schedule != nil {
+		if options.Allocation != nil {
+			return errors.New("a schedule cannot be combined with an allocation")
+		}
+		if err := options.Schedule.Validate(); err != nil {
+			return err
+		}
+	}
+	if options.Weighting.IsEnabled() && (options.Schedule != nil || options.Allocation != nil) {
+		return errors.New("a weighting strategy cannot be combined with a schedule or an allocation")
+	}
+	if err := options.Weighting.validate(); err != nil {
+		return err
+	}
+	if options.Withdrawal < 0 {
+		return errors.New("withdrawal must not be negative")
+	}
+	if err := options.CashReserve.validate(); err != nil {
+		return err
+	}
+	return options.TradeLimits.validate()
+}
@@ -0,0 +1,96 @@
+package autopilot
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/MitchK/autorobin/lib/model"
+)
+
+const (
+	// UntargetedIgnore Leaves holdings that are not part of the desired portfolio out of the portfolio value
+	UntargetedIgnore UntargetedPolicy = iota
+
+	// UntargetedInclude Counts the value of the holdings toward the portfolio value, but never trades them.
+	// The desired weights refer to the total value, so the assets of the desired portfolio are bought with the available cash only.
+	UntargetedInclude
+
+	// UntargetedLiquidate Counts the value of the holdings toward the portfolio value and sells them, the proceeds are
+	// invested into the desired portfolio by the next rebalance
+	UntargetedLiquidate
+)
+
+// UntargetedPolicy UntargetedPolicy
+type UntargetedPolicy int
+
+// Untargeted Handling of the holdings of assets that are not part of the desired portfolio
+type Untargeted struct {
+	Policy UntargetedPolicy
+
+	// Rate Share of every holding that is sold per rebalance with UntargetedLiquidate, e.g. 0.25 to liquidate over
+	// four rebalances. Holdings are sold completely if not set.
+	Rate float64
+}
+
+func (untargeted Untargeted) validate() error {
+	if untargeted.Policy < UntargetedIgnore || untargeted.Policy > UntargetedLiquidate {
+		return fmt.Errorf("invalid untargeted policy: %v", untargeted.Policy)
+	}
+	if untargeted.Rate < 0 || untargeted.Rate > 1 {
+		return errors.New("liquidation rate must be between 0 and 1")
+	}
+	return nil
+}
+
+// untargetedAssets Returns the held assets that are not among the given assets
+func (autopilot *Autopilot) untargetedAssets(assets []model.Asset) ([]model.Asset, error) {
+	positions, err := autopilot.broker.GetAllPositions()
+	if err != nil {
+		return nil, err
+	}
+	included := map[model.Asset]bool{}
+	for _, asset := range assets {
+		included[asset] = true
+	}
+	untargeted := []model.Asset{}
+	for _, position := range positions {
+		if !included[position.Asset] && position.Quantity > 0 {
+			untargeted = append(untargeted, position.Asset)
+			included[position.Asset] = true
+		}
+	}
+	return untargeted, nil
+}
+
+// liquidate Creates the sell orders of the share of the untargeted holdings that is liquidated by this rebalance
+func (autopilot *Autopilot) liquidate(actualPortfolio model.Portfolio, partials bool, untargeted []model.Asset) []model.Order {
+	rate := autopilot.options.Untargeted.Rate
+	if rate == 0 {
+		rate = 1
+	}
+	orders := []model.Order{}
+	for _, asset := range untargeted {
+		held := actualPortfolio.Quantities[asset]
+		price := actualPortfolio.Prices[asset]
+		if held <= 0 || price <= 0 {
+			continue
+		}
+		quantity := held * rate
+		if !partials {
+			// round up so small holdings are liquidated eventually, fractional shares cannot be sold
+			quantity = math.Min(math.Ceil(quantity-1e-9), math.Floor(held))
+			if quantity < 1 {
+				continue
+			}
+		}
+		orders = append(orders, model.Order{
+			Description: "Liquidation of holding not in the desired portfolio",
+			Type:        model.OrderTypeSell,
+			Quantity:    quantity,
+			Price:       price,
+			Asset:       asset,
+		})
+	}
+	return orders
+}
@@ -0,0 +1,61 @@
+package autopilot
+
+import (
+	"errors"
+	"time"
+
+	"github.com/MitchK/autorobin/lib/data"
+	"github.com/MitchK/autorobin/lib/logging"
+	"github.com/MitchK/autorobin/lib/model"
+	"github.com/MitchK/autorobin/lib/weighting"
+)
+
+// Weighting Computes the desired weights of every plan from the trailing quotes of the assets, it is disabled without a strategy
+type Weighting struct {
+	Strategy weighting.Strategy
+
+	// Lookback Number of calendar days of quotes before the current time the strategy uses, e.g. 90
+	Lookback int
+
+	// History Source of the quotes, e.g. Tiingo. A backtest serves the quotes up to the simulated date.
+	History data.Adapter
+}
+
+// IsEnabled Returns true if a strategy is configured
+func (weighting Weighting) IsEnabled() bool {
+	return weighting.Strategy != nil
+}
+
+func (weighting Weighting) validate() error {
+	if !weighting.IsEnabled() {
+		return nil
+	}
+	if weighting.Lookback < 1 {
+		return errors.New("lookback must be at least 1 day")
+	}
+	if weighting.History == nil {
+		return errors.New("weighting requires a source of historic quotes")
+	}
+	return nil
+}
+
+// Weights Returns the weights of the strategy for the quotes of the lookback window before the time
+func (weighting Weighting) Weights(now time.Time, assets []model.Asset) (model.Weights, error) {
+	history, err := weighting.History.GetDailyAsc(now.AddDate(0, 0, -weighting.Lookback), now, assets...)
+	if err != nil {
+		return nil, err
+	}
+	return weighting.Strategy.Weights(assets, history)
+}
+
+// weights Returns the weights of the strategy at the current time
+func (autopilot *Autopilot) weights(assets []model.Asset) (model.Weights, error) {
+	weights, err := autopilot.options.Weighting.Weights(autopilot.now(), assets)
+	if err != nil {
+		return nil, err
+	}
+	for _, asset := range assets {
+		autopilot.logger().Debug("computed target weight", logging.KeySymbol, asset.Symbol, "weight", weights[asset])
+	}
+	return weights, nil
+}
@@ -0,0 +1,534 @@
+package alpaca
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MitchK/autorobin/lib/broker"
+	"github.com/MitchK/autorobin/lib/logging"
+	"github.com/MitchK/autorobin/lib/model"
+)
+
+const (
+	// LiveURL Trading API of live accounts
+	LiveURL = "https://api.alpaca.markets"
+
+	// PaperURL Trading API of paper accounts
+	PaperURL = "https://paper-api.alpaca.markets"
+
+	// DataURL Market data API
+	DataURL = "https://data.alpaca.markets"
+)
+
+// Config Config
+type Config struct {
+	KeyID     string
+	SecretKey string
+
+	// Paper Trades with the paper account instead of the live account
+	Paper bool
+
+	// BaseURL and DataURL override the endpoints, e.g. for tests
+	BaseURL string
+	DataURL string
+
+	// Client HTTP client, http.DefaultClient if not set
+	Client *http.Client
+
+	// Logger Logs requests and orders, silent if not set
+	Logger *slog.Logger
+}
+
+func init() {
+	broker.Register(broker.Registration{
+		Name:        "alpaca",
+		Description: "Alpaca paper or live account",
+		Settings: []broker.Setting{
+			{Name: "key-id", Usage: "Alpaca API key ID", Required: true},
+			{Name: "secret-key", Usage: "Alpaca API secret key", Required: true, Secret: true},
+			{Name: "paper", Usage: "Trade with the paper account instead of the live account", Default: "false"},
+		},
+		New: func(config broker.Config, logger *slog.Logger) (broker.Broker, error) {
+			paper, err := config.Bool("paper")
+			if err != nil {
+				return nil, err
+			}
+			return NewBroker(Config{
+				KeyID:     config["key-id"],
+				SecretKey: config["secret-key"],
+				Paper:     paper,
+				Logger:    logger,
+			})
+		},
+	})
+}
+
+// alpacaBroker alpacaBroker
+type alpacaBroker struct {
+	config Config
+	logger *slog.Logger
+}
+
+// NewBroker Creates a broker for the account of the API key and verifies the key
+func NewBroker(config Config) (broker.Broker, error) {
+	if config.KeyID == "" || config.SecretKey == "" {
+		return nil, errors.New("no Alpaca API key provided")
+	}
+	if config.BaseURL == "" {
+		config.BaseURL = LiveURL
+		if config.Paper {
+			config.BaseURL = PaperURL
+		}
+	}
+	if config.DataURL == "" {
+		config.DataURL = DataURL
+	}
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	broker := &alpacaBroker{
+		config: config,
+		logger: logging.Or(config.Logger),
+	}
+	if _, err := broker.getAccount(); err != nil {
+		return nil, err
+	}
+	return broker, nil
+}
+
+// apiError Error response of the API
+type apiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// do Sends a request with the API key and decodes the JSON response into out if it is not nil
+func (broker *alpacaBroker) do(method string, endpoint string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(buf)
+	}
+	req, err := http.NewRequest(method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("APCA-API-KEY-ID", broker.config.KeyID)
+	req.Header.Set("APCA-API-SECRET-KEY", broker.config.SecretKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := broker.config.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	buf, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	broker.logger.Debug("request", "method", method, "path", req.URL.Path, "status", res.StatusCode)
+	if res.StatusCode >= 300 {
+		apiErr := apiError{}
+		if json.Unmarshal(buf, &apiErr) == nil && apiErr.Message != "" {
+			return fmt.Errorf("alpaca: %s %s: %s", method, req.URL.Path, apiErr.Message)
+		}
+		return fmt.Errorf("alpaca: %s %s: %s", method, req.URL.Path, res.Status)
+	}
+	if out == nil || len(buf) == 0 {
+		return nil
+	}
+	return json.Unmarshal(buf, out)
+}
+
+type account struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Cash   string `json:"cash"`
+}
+
+func (broker *alpacaBroker) getAccount() (account, error) {
+	acc := account{}
+	err := broker.do(http.MethodGet, broker.config.BaseURL+"/v2/account", nil, &acc)
+	return acc, err
+}
+
+// GetAvailableCash Cash of the account without the cash held for open buy orders
+func (broker *alpacaBroker) GetAvailableCash() (float64, error) {
+	acc, err := broker.getAccount()
+	if err != nil {
+		return 0, err
+	}
+	cash, err := strconv.ParseFloat(acc.Cash, 64)
+	if err != nil {
+		return 0, err
+	}
+	openOrders, err := broker.GetOpenOrders()
+	if err != nil {
+		return 0, err
+	}
+	for _, order := range openOrders {
+		if order.Type == model.OrderTypeBuy {
+			cash -= order.RemainingQuantity() * order.Price
+		}
+	}
+	return math.Max(0, cash), nil
+}
+
+type position struct {
+	Symbol        string `json:"symbol"`
+	Qty           string `json:"qty"`
+	AvgEntryPrice string `json:"avg_entry_price"`
+}
+
+func convertPosition(pos position) (model.Position, error) {
+	quantity, err := strconv.ParseFloat(pos.Qty, 64)
+	if err != nil {
+		return model.Position{}, err
+	}
+	avgBuyPrice, err := strconv.ParseFloat(pos.AvgEntryPrice, 64)
+	if err != nil {
+		return model.Position{}, err
+	}
+	return model.Position{
+		Asset: model.Asset{
+			Symbol: pos.Symbol,
+		},
+		Quantity:    quantity,
+		AvgBuyPrice: avgBuyPrice,
+	}, nil
+}
+
+// GetAllPositions GetAllPositions
+func (broker *alpacaBroker) GetAllPositions() ([]model.Position, error) {
+	positions := []position{}
+	err := broker.do(http.MethodGet, broker.config.BaseURL+"/v2/positions", nil, &positions)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]model.Position, len(positions))
+	for i, pos := range positions {
+		result[i], err = convertPosition(pos)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// GetPositions GetPositions
+func (broker *alpacaBroker) GetPositions(assets ...model.Asset) ([]model.Position, error) {
+	positions, err := broker.GetAllPositions()
+	if err != nil {
+		return nil, err
+	}
+	bySymbol := map[string]model.Position{}
+	for _, pos := range positions {
+		bySymbol[pos.Asset.Symbol] = pos
+	}
+	result := make([]model.Position, len(assets))
+	for i, asset := range assets {
+		position, ok := bySymbol[asset.Symbol]
+		if !ok {
+			position = model.Position{
+				Asset: asset,
+			}
+		}
+		result[i] = position
+	}
+	return result, nil
+}
+
+// GetPortfolio GetPortfolio
+func (broker *alpacaBroker) GetPortfolio(assets ...model.Asset) (model.Portfolio, error) {
+	positions, err := broker.GetPositions(assets...)
+	if err != nil {
+		return model.Portfolio{}, err
+	}
+	quotes, err := broker.GetQuotes(assets...)
+	if err != nil {
+		return model.Portfolio{}, err
+	}
+
+	quantities := model.Quantities{}
+	prices := model.Prices{}
+	var total float64
+	for i, asset := range assets {
+		quantities[asset] = positions[i].Quantity
+		prices[asset] = quotes[i].Price
+		total += quantities[asset] * prices[asset]
+	}
+	weights := model.Weights{}
+	for _, asset := range assets {
+		if total == 0 {
+			weights[asset] = 0
+		} else {
+			weights[asset] = quantities[asset] * prices[asset] / total
+		}
+	}
+	return model.Portfolio{
+		Weights:    weights,
+		Quantities: quantities,
+		Prices:     prices,
+		TotalValue: total,
+	}, nil
+}
+
+type latestTrades struct {
+	Trades map[string]struct {
+		Timestamp time.Time `json:"t"`
+		Price     float64   `json:"p"`
+	} `json:"trades"`
+}
+
+// GetQuotes Returns the prices of the latest trades
+func (broker *alpacaBroker) GetQuotes(assets ...model.Asset) ([]model.Quote, error) {
+	if len(assets) == 0 {
+		return []model.Quote{}, nil
+	}
+	symbols := make([]string, len(assets))
+	for i, asset := range assets {
+		symbols[i] = asset.Symbol
+	}
+	trades := latestTrades{}
+	err := broker.do(http.MethodGet, broker.config.DataURL+"/v2/stocks/trades/latest?symbols="+url.QueryEscape(strings.Join(symbols, ",")), nil, &trades)
+	if err != nil {
+		return nil, err
+	}
+	quotes := make([]model.Quote, len(assets))
+	for i, asset := range assets {
+		trade, ok := trades.Trades[asset.Symbol]
+		if !ok {
+			return nil, fmt.Errorf("could not get quote of %s", asset.Symbol)
+		}
+		quotes[i] = model.Quote{
+			Asset: asset,
+			Price: trade.Price,
+			Date:  trade.Timestamp,
+		}
+	}
+	return quotes, nil
+}
+
+type orderRequest struct {
+	Symbol      string `json:"symbol"`
+	Qty         string `json:"qty"`
+	Side        string `json:"side"`
+	Type        string `json:"type"`
+	TimeInForce string `json:"time_in_force"`
+	LimitPrice  string `json:"limit_price"`
+}
+
+type order struct {
+	ID             string     `json:"id"`
+	Symbol         string     `json:"symbol"`
+	Qty            string     `json:"qty"`
+	FilledQty      string     `json:"filled_qty"`
+	FilledAvgPrice *string    `json:"filled_avg_price"`
+	FilledAt       *time.Time `json:"filled_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	SubmittedAt    time.Time  `json:"submitted_at"`
+	Side           string     `json:"side"`
+	LimitPrice     *string    `json:"limit_price"`
+	Status         string     `json:"status"`
+}
+
+func parseOptionalFloat(str *string) (float64, error) {
+	if str == nil || *str == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(*str, 64)
+}
+
+func convertOrder(o order) (model.Order, error) {
+	quantity, err := strconv.ParseFloat(o.Qty, 64)
+	if err != nil {
+		return model.Order{}, err
+	}
+	filledQuantity, err := parseOptionalFloat(&o.FilledQty)
+	if err != nil {
+		return model.Order{}, err
+	}
+	filledPrice, err := parseOptionalFloat(o.FilledAvgPrice)
+	if err != nil {
+		return model.Order{}, err
+	}
+	price, err := parseOptionalFloat(o.LimitPrice)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	var orderType model.OrderType
+	switch o.Side {
+	case "buy":
+		orderType = model.OrderTypeBuy
+	case "sell":
+		orderType = model.OrderTypeSell
+	default:
+		return model.Order{}, fmt.Errorf("invalid order side: %s", o.Side)
+	}
+
+	var status model.OrderStatus
+	switch o.Status {
+	case "new", "accepted", "pending_new", "accepted_for_bidding", "partially_filled", "pending_cancel", "pending_replace", "held", "calculated", "done_for_day", "stopped":
+		status = model.OrderStatusOpen
+	case "filled":
+		status = model.OrderStatusFilled
+	case "canceled", "expired", "replaced":
+		status = model.OrderStatusCancelled
+	case "rejected", "suspended":
+		status = model.OrderStatusRejected
+	default:
+		return model.Order{}, fmt.Errorf("unknown order status: %s", o.Status)
+	}
+
+	filledAt := o.UpdatedAt
+	if o.FilledAt != nil {
+		filledAt = *o.FilledAt
+	}
+
+	return model.Order{
+		ID:   o.ID,
+		Type: orderType,
+		Asset: model.Asset{
+			Symbol: o.Symbol,
+		},
+		Price:          price,
+		Quantity:       quantity,
+		Status:         status,
+		FilledQuantity: filledQuantity,
+		FilledPrice:    filledPrice,
+		FilledAt:       filledAt,
+	}, nil
+}
+
+// Submit Places a limit order that is valid for the day
+func (broker *alpacaBroker) Submit(o model.Order) (model.Order, error) {
+	if o.Quantity <= 0 {
+		return model.Order{}, fmt.Errorf("cannot submit order of %s: invalid quantity: %v", o.Asset.Symbol, o.Quantity)
+	}
+	side := "buy"
+	if o.Type == model.OrderTypeSell {
+		side = "sell"
+	} else if o.Type != model.OrderTypeBuy {
+		return model.Order{}, fmt.Errorf("invalid order type: %v", o.Type)
+	}
+	request := orderRequest{
+		Symbol:      o.Asset.Symbol,
+		Qty:         strconv.FormatFloat(o.Quantity, 'f', -1, 64),
+		Side:        side,
+		Type:        "limit",
+		TimeInForce: "day",
+		LimitPrice:  strconv.FormatFloat(math.Round(o.Price*100)/100, 'f', 2, 64),
+	}
+	response := order{}
+	err := broker.do(http.MethodPost, broker.config.BaseURL+"/v2/orders", request, &response)
+	if err != nil {
+		return model.Order{}, err
+	}
+	submitted, err := convertOrder(response)
+	if err != nil {
+		return model.Order{}, err
+	}
+	submitted.Description = o.Description
+	broker.logger.Info("order submitted", logging.Order(submitted)...)
+	return submitted, nil
+}
+
+// Execute Execute
+func (broker *alpacaBroker) Execute(orders ...model.Order) []error {
+	errs := []error{}
+	for _, order := range orders {
+		if _, err := broker.Submit(order); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// GetOrder GetOrder
+func (broker *alpacaBroker) GetOrder(id string) (model.Order, error) {
+	response := order{}
+	err := broker.do(http.MethodGet, broker.config.BaseURL+"/v2/orders/"+url.PathEscape(id), nil, &response)
+	if err != nil {
+		return model.Order{}, err
+	}
+	return convertOrder(response)
+}
+
+// CancelOrder CancelOrder
+func (broker *alpacaBroker) CancelOrder(id string) error {
+	if err := broker.do(http.MethodDelete, broker.config.BaseURL+"/v2/orders/"+url.PathEscape(id), nil, nil); err != nil {
+		return err
+	}
+	broker.logger.Info("order cancelled", logging.KeyOrderID, id)
+	return nil
+}
+
+// ordersPageSize Maximum number of orders the API returns per request
+const ordersPageSize = 500
+
+// listOrders Returns the orders of the given status that were submitted after the given time, in ascending order of submission
+func (broker *alpacaBroker) listOrders(status string, after time.Time) ([]model.Order, error) {
+	orders := []model.Order{}
+	for {
+		query := url.Values{}
+		query.Set("status", status)
+		query.Set("limit", strconv.Itoa(ordersPageSize))
+		query.Set("direction", "asc")
+		if !after.IsZero() {
+			query.Set("after", after.UTC().Format(time.RFC3339Nano))
+		}
+		page := []order{}
+		err := broker.do(http.MethodGet, broker.config.BaseURL+"/v2/orders?"+query.Encode(), nil, &page)
+		if err != nil {
+			return nil, err
+		}
+		for _, response := range page {
+			converted, err := convertOrder(response)
+			if err != nil {
+				return nil, err
+			}
+			orders = append(orders, converted)
+		}
+		if len(page) < ordersPageSize {
+			return orders, nil
+		}
+		after = page[len(page)-1].SubmittedAt
+	}
+}
+
+// GetOpenOrders GetOpenOrders
+func (broker *alpacaBroker) GetOpenOrders() ([]model.Order, error) {
+	return broker.listOrders("open", time.Time{})
+}
+
+// GetOrderHistory GetOrderHistory
+func (broker *alpacaBroker) GetOrderHistory(since time.Time) ([]model.Order, error) {
+	// orders are only valid for the day they were submitted, older ones cannot have been filled since
+	orders, err := broker.listOrders("all", since.Add(-24*time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	history := []model.Order{}
+	for _, order := range orders {
+		if order.FilledQuantity > 0 && !order.FilledAt.Before(since) {
+			history = append(history, order)
+		}
+	}
+	return history, nil
+}
@@ -0,0 +1,246 @@
+package alpaca_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MitchK/autorobin/lib/broker"
+	"github.com/MitchK/autorobin/lib/broker/alpaca"
+	"github.com/MitchK/autorobin/lib/broker/replay"
+	"github.com/MitchK/autorobin/lib/model"
+	"github.com/onsi/gomega"
+)
+
+var (
+	aapl = model.Asset{
+		Symbol: "AAPL",
+	}
+	vti = model.Asset{
+		Symbol: "VTI",
+	}
+	bnd = model.Asset{
+		Symbol: "BND",
+	}
+	assets = []model.Asset{
+		aapl, vti, bnd,
+	}
+	filledID   = "61e69015-8549-4bfd-b9c3-01e75843f47d"
+	openID     = "0d2d7e3f-31a1-4b3d-a4b2-7e1f1b7c9a10"
+	recordings = filepath.Join("fixtures", "recordings.json")
+)
+
+func newBroker(t *testing.T) (broker.Broker, *replay.Server) {
+	server := replay.NewServer(t, recordings)
+	broker, err := alpaca.NewBroker(alpaca.Config{
+		KeyID:     "PKTEST",
+		SecretKey: "secret",
+		Paper:     true,
+		Client:    server.Client(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return broker, server
+}
+
+func TestNewBroker(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	// should use the paper endpoint and send the API key
+	_, server := newBroker(t)
+	requests := server.Requests()
+	g.Expect(requests).To(gomega.HaveLen(1))
+	g.Expect(requests[0].Host).To(gomega.Equal("paper-api.alpaca.markets"))
+	g.Expect(requests[0].Path).To(gomega.Equal("/v2/account"))
+	g.Expect(requests[0].Header.Get("APCA-API-KEY-ID")).To(gomega.Equal("PKTEST"))
+	g.Expect(requests[0].Header.Get("APCA-API-SECRET-KEY")).To(gomega.Equal("secret"))
+
+	// should use the live endpoint by default
+	server = replay.NewServer(t, recordings)
+	_, err := alpaca.NewBroker(alpaca.Config{
+		KeyID:     "AKTEST",
+		SecretKey: "secret",
+		Client:    server.Client(),
+	})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(server.Requests()[0].Host).To(gomega.Equal("api.alpaca.markets"))
+
+	// should require an API key
+	_, err = alpaca.NewBroker(alpaca.Config{
+		Client: server.Client(),
+	})
+	g.Expect(err).NotTo(gomega.BeNil())
+}
+
+func TestGetAvailableCash(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	broker, _ := newBroker(t)
+
+	// should hold back the cash of the remaining quantity of open buy orders
+	cash, err := broker.GetAvailableCash()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(cash).To(gomega.BeNumerically("~", 10000-3*180, 1e-9))
+}
+
+func TestGetPositions(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	broker, _ := newBroker(t)
+
+	// should return a position for every asset, empty if not held
+	positions, err := broker.GetPositions(assets...)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(positions).To(gomega.Equal([]model.Position{
+		{Asset: aapl, Quantity: 10, AvgBuyPrice: 170.25},
+		{Asset: vti, Quantity: 3.5, AvgBuyPrice: 210},
+		{Asset: bnd},
+	}))
+
+	// should return the held positions only
+	positions, err = broker.GetAllPositions()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(positions).To(gomega.Equal([]model.Position{
+		{Asset: aapl, Quantity: 10, AvgBuyPrice: 170.25},
+		{Asset: vti, Quantity: 3.5, AvgBuyPrice: 210},
+	}))
+}
+
+func TestGetQuotes(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	broker, server := newBroker(t)
+
+	// should return the prices of the latest trades from the data endpoint
+	quotes, err := broker.GetQuotes(assets...)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(quotes).To(gomega.HaveLen(3))
+	g.Expect(quotes[0].Asset).To(gomega.Equal(aapl))
+	g.Expect(quotes[0].Price).To(gomega.Equal(180.52))
+	g.Expect(quotes[0].Date.Equal(time.Date(2021, 3, 5, 20, 59, 59, 918000000, time.UTC))).To(gomega.BeTrue())
+	g.Expect(quotes[1].Price).To(gomega.Equal(207.2))
+	g.Expect(quotes[2].Price).To(gomega.Equal(72.1))
+	requests := server.Requests()
+	g.Expect(requests[len(requests)-1].Host).To(gomega.Equal("data.alpaca.markets"))
+
+	// should fail for assets without trades
+	_, err = broker.GetQuotes(aapl, model.Asset{Symbol: "XYZ"})
+	g.Expect(err).NotTo(gomega.BeNil())
+
+	// should compute the portfolio from positions and quotes
+	portfolio, err := broker.GetPortfolio(assets...)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(portfolio.TotalValue).To(gomega.BeNumerically("~", 10*180.52+3.5*207.2, 1e-9))
+	g.Expect(portfolio.Quantities[bnd]).To(gomega.Equal(0.0))
+	g.Expect(portfolio.Weights[bnd]).To(gomega.Equal(0.0))
+}
+
+func TestSubmit(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	broker, server := newBroker(t)
+
+	// should place a limit order for the day
+	errs := broker.Execute(model.Order{
+		Type:     model.OrderTypeBuy,
+		Asset:    bnd,
+		Quantity: 10,
+		Price:    72.1,
+	})
+	g.Expect(errs).To(gomega.BeEmpty())
+	requests := server.Requests()
+	request := requests[len(requests)-1]
+	g.Expect(request.Method).To(gomega.Equal(http.MethodPost))
+	g.Expect(request.Host).To(gomega.Equal("paper-api.alpaca.markets"))
+	body := map[string]string{}
+	g.Expect(json.Unmarshal(request.Body, &body)).To(gomega.Succeed())
+	g.Expect(body).To(gomega.Equal(map[string]string{
+		"symbol":        "BND",
+		"qty":           "10",
+		"side":          "buy",
+		"type":          "limit",
+		"time_in_force": "day",
+		"limit_price":   "72.10",
+	}))
+
+	// should not submit invalid orders
+	errs = broker.Execute(model.Order{
+		Type:  model.OrderTypeSell,
+		Asset: bnd,
+	})
+	g.Expect(errs).To(gomega.HaveLen(1))
+	g.Expect(server.Requests()).To(gomega.HaveLen(len(requests)))
+}
+
+func TestGetOrder(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	broker, _ := newBroker(t)
+
+	// should convert the order status and fill
+	order, err := broker.GetOrder(filledID)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(order.ID).To(gomega.Equal(filledID))
+	g.Expect(order.Type).To(gomega.Equal(model.OrderTypeBuy))
+	g.Expect(order.Asset).To(gomega.Equal(bnd))
+	g.Expect(order.Status).To(gomega.Equal(model.OrderStatusFilled))
+	g.Expect(order.Quantity).To(gomega.Equal(10.0))
+	g.Expect(order.Price).To(gomega.Equal(72.1))
+	g.Expect(order.FilledQuantity).To(gomega.Equal(10.0))
+	g.Expect(order.FilledPrice).To(gomega.Equal(72.08))
+	g.Expect(order.FilledAt.Equal(time.Date(2021, 3, 8, 14, 30, 2, 450000000, time.UTC))).To(gomega.BeTrue())
+}
+
+func TestCancelOrder(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	broker, server := newBroker(t)
+
+	// should cancel open orders
+	g.Expect(broker.CancelOrder(openID)).To(gomega.Succeed())
+	requests := server.Requests()
+	g.Expect(requests[len(requests)-1].Method).To(gomega.Equal(http.MethodDelete))
+
+	// should report the message of the API
+	err := broker.CancelOrder(filledID)
+	g.Expect(err).NotTo(gomega.BeNil())
+	g.Expect(err.Error()).To(gomega.ContainSubstring(`order is already in "filled" state`))
+}
+
+func TestGetOpenOrders(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	broker, _ := newBroker(t)
+
+	// should treat partially filled orders as open
+	orders, err := broker.GetOpenOrders()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(orders).To(gomega.HaveLen(1))
+	g.Expect(orders[0].ID).To(gomega.Equal(openID))
+	g.Expect(orders[0].Status).To(gomega.Equal(model.OrderStatusOpen))
+	g.Expect(orders[0].RemainingQuantity()).To(gomega.Equal(3.0))
+}
+
+func TestGetOrderHistory(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	broker, server := newBroker(t)
+
+	// should only return orders that were filled since the given time
+	orders, err := broker.GetOrderHistory(time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC))
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(orders).To(gomega.HaveLen(1))
+	g.Expect(orders[0].Asset).To(gomega.Equal(vti))
+	g.Expect(orders[0].FilledQuantity).To(gomega.Equal(3.5))
+	requests := server.Requests()
+	query := requests[len(requests)-1].Query
+	g.Expect(query.Get("status")).To(gomega.Equal("all"))
+	g.Expect(query.Get("after")).To(gomega.Equal("2021-02-28T00:00:00Z"))
+
+	orders, err = broker.GetOrderHistory(time.Date(2021, 3, 2, 0, 0, 0, 0, time.UTC))
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(orders).To(gomega.BeEmpty())
+}
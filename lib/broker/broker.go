@@ -1,14 +1,45 @@
 package broker
 
-import "github.com/MitchK/autorobin/lib/model"
+import (
+	"time"
+
+	"github.com/MitchK/autorobin/lib/model"
+)
 
 //go:generate mockgen -destination=../mocks/mock_broker.go -package=mocks github.com/MitchK/autorobin/lib/broker Broker
 
 // Broker Broker
+//
+// Positions only contain settled shares and the available cash does not include cash that is held for open orders.
+// Open orders are reported separately by GetOpenOrders.
 type Broker interface {
 	Execute(orders ...model.Order) []error
 	GetAvailableCash() (float64, error)
 	GetPositions(assets ...model.Asset) ([]model.Position, error)
 	GetPortfolio(assets ...model.Asset) (model.Portfolio, error)
 	GetQuotes(assets ...model.Asset) ([]model.Quote, error)
+
+	// GetAllPositions Returns every open position of the account, including assets that are not part of the target portfolio
+	GetAllPositions() ([]model.Position, error)
+
+	// Submit Places a limit order and returns it with the ID and status assigned by the broker
+	Submit(order model.Order) (model.Order, error)
+
+	// GetOrder Returns the current state of a submitted order
+	GetOrder(id string) (model.Order, error)
+
+	// CancelOrder Cancels a submitted order that was not filled yet
+	CancelOrder(id string) error
+
+	// GetOpenOrders Returns all submitted orders that are not filled, cancelled or rejected yet
+	GetOpenOrders() ([]model.Order, error)
+
+	// GetOrderHistory Returns all orders that were filled at least partially since the given time
+	GetOrderHistory(since time.Time) ([]model.Order, error)
+}
+
+// LotTracker Broker that reports the tax lots of its positions
+type LotTracker interface {
+	// GetLotMethod Returns the lot method of sell orders that do not select one
+	GetLotMethod() model.LotMethod
 }
@@ -3,8 +3,14 @@ package fake
 import (
 	"errors"
 	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"time"
 
+	"github.com/MitchK/autorobin/lib/logging"
 	"github.com/MitchK/autorobin/lib/model"
+	"github.com/MitchK/autorobin/lib/tax"
 )
 
 // Fake Fake
@@ -13,22 +19,116 @@ type Fake struct {
 	quotes map[model.Asset]model.Quote
 
 	positions map[model.Asset]*model.Position
+
+	// submitted limit orders by ID, open ones hold cash or shares until they are filled or cancelled
+	orders       map[string]*model.Order
+	orderIDs     []string
+	heldForSells map[model.Asset]float64
+
+	// lots are acquired and sold at the date of the current quote of their asset
+	lotMethod     model.LotMethod
+	lotCount      int
+	realizedGains []model.RealizedGain
+
+	logger *slog.Logger
 }
 
 // NewBroker NewBroker
 func NewBroker(cash float64) *Fake {
 	return &Fake{
-		cash:      cash,
-		positions: map[model.Asset]*model.Position{},
+		cash:         cash,
+		positions:    map[model.Asset]*model.Position{},
+		orders:       map[string]*model.Order{},
+		heldForSells: map[model.Asset]float64{},
+		lotMethod:    model.LotMethodFIFO,
+		logger:       logging.Discard(),
 	}
 }
 
+// SetLogger Logs the executed and filled orders, silent by default
+func (fake *Fake) SetLogger(logger *slog.Logger) {
+	fake.logger = logging.Or(logger)
+}
+
+// SetLotMethod Sets the lot method of sell orders that do not select one, FIFO by default
+func (fake *Fake) SetLotMethod(method model.LotMethod) {
+	fake.lotMethod = method
+}
+
+// GetLotMethod Returns the lot method of sell orders that do not select one
+func (fake *Fake) GetLotMethod() model.LotMethod {
+	return fake.lotMethod
+}
+
+// GetRealizedGains Returns the gains of all sales so far
+func (fake *Fake) GetRealizedGains() []model.RealizedGain {
+	return fake.realizedGains
+}
+
 // SetQuotes SetQuotes
 func (fake *Fake) SetQuotes(quotes ...model.Quote) {
 	fake.quotes = map[model.Asset]model.Quote{}
 	for _, quote := range quotes {
 		fake.quotes[quote.Asset] = quote
 	}
+	fake.matchOrders()
+}
+
+// UpdateQuotes Sets the quotes of the given assets and keeps the quotes of all others
+func (fake *Fake) UpdateQuotes(quotes ...model.Quote) {
+	if fake.quotes == nil {
+		fake.quotes = map[model.Asset]model.Quote{}
+	}
+	for _, quote := range quotes {
+		fake.quotes[quote.Asset] = quote
+	}
+	fake.matchOrders()
+}
+
+// Quotes Returns the quotes of all assets, sorted by symbol
+func (fake *Fake) Quotes() []model.Quote {
+	quotes := []model.Quote{}
+	for _, quote := range fake.quotes {
+		quotes = append(quotes, quote)
+	}
+	sort.Slice(quotes, func(i, j int) bool {
+		return quotes[i].Asset.Symbol < quotes[j].Asset.Symbol
+	})
+	return quotes
+}
+
+// Deposit Adds cash to the account
+func (fake *Fake) Deposit(amount float64) {
+	fake.cash += amount
+}
+
+// Withdraw Removes cash from the account, the cash held for open buy orders cannot be withdrawn
+func (fake *Fake) Withdraw(amount float64) error {
+	if amount > fake.cash {
+		return fmt.Errorf("cannot withdraw %v: only %v of cash available", amount, fake.cash)
+	}
+	fake.cash -= amount
+	return nil
+}
+
+func validate(order model.Order) error {
+	if order.Asset == (model.Asset{}) {
+		return errors.New("cannot execute order: no asset set")
+	}
+	asset := order.Asset
+	if order.Price <= 0 {
+		return fmt.Errorf("cannot execute order of %s: invalid price: %v", asset.Symbol, order.Price)
+	}
+	if order.Quantity < 1 {
+		return fmt.Errorf("cannot execute order of %s: quantity less than 1", asset.Symbol)
+	}
+	if order.Type == 0 {
+		return fmt.Errorf("cannot execute order of %s: order type not set", asset.Symbol)
+	}
+	if order.Type != model.OrderTypeBuy && order.Type != model.OrderTypeSell {
+		return fmt.Errorf("invalid order type: %v", order.Type)
+	}
+	return nil
 }
 
 // Execute Execute
@@ -37,67 +137,228 @@ func (fake *Fake) Execute(orders ...model.Order) []error {
 	errs := []error{}
 
 	for _, order := range orders {
-		// Disabled output
-		// if order.Type == model.OrderTypeBuy {
-		// 	fmt.Printf("BUY %v x %s @ %v (%s)\n", order.Quantity, order.Asset.Symbol, order.Price, order.Description)
-		// } else if order.Type == model.OrderTypeSell {
-		// 	fmt.Printf("SELL %v x %s @ %v (%s)\n", order.Quantity, order.Asset.Symbol, order.Price, order.Description)
-		// }
-
-		if order.Asset == (model.Asset{}) {
-			errs = append(errs, errors.New("cannot execute order: no asset set"))
+		fake.logger.Debug("executing order", append(logging.Order(order), "description", order.Description)...)
+		if err := validate(order); err != nil {
+			errs = append(errs, err)
 			continue
 		}
-		asset := order.Asset
-		if order.Price <= 0 {
-			errs = append(errs, fmt.Errorf("cannot execute order of %s: invalid price: %v", asset.Symbol, order.Price))
+		if err := fake.reserve(order); err != nil {
+			errs = append(errs, err)
 			continue
 		}
-		if order.Quantity < 1 {
-			errs = append(errs, fmt.Errorf("cannot execute order of %s: quantity less than 1", asset.Symbol))
+		if err := fake.fill(order); err != nil {
+			fake.release(order, order.Quantity)
+			errs = append(errs, err)
 			continue
 		}
-		if order.Type == 0 {
-			errs = append(errs, fmt.Errorf("cannot execute order of %s: order type not set", asset.Symbol))
-			continue
+		order.Status = model.OrderStatusFilled
+		order.FilledQuantity = order.Quantity
+		order.FilledPrice = order.Price
+		order.FilledAt = fake.quotes[order.Asset].Date
+		fake.record(order)
+	}
+	return errs
+}
+
+// reserve Holds the cash of a buy order or the shares of a sell order
+func (fake *Fake) reserve(order model.Order) error {
+	asset := order.Asset
+	if order.Type == model.OrderTypeBuy {
+		total := order.Quantity * order.Price
+		if total > fake.cash {
+			return fmt.Errorf("cannot execute buy order of %s: not enough cash", asset.Symbol)
 		}
-		position, exists := fake.positions[asset]
-		if !exists {
-			if order.Type == model.OrderTypeSell {
-				errs = append(errs, fmt.Errorf("cannot execute sell order of %s: no open positions", asset.Symbol))
-				continue
-			}
-			fake.positions[asset] = &model.Position{
-				Asset: asset,
-			}
-			position = fake.positions[asset]
+		fake.cash -= total
+		return nil
+	}
+	position, exists := fake.positions[asset]
+	if !exists {
+		return fmt.Errorf("cannot execute sell order of %s: no open positions", asset.Symbol)
+	}
+	if order.Quantity > position.Quantity-fake.heldForSells[asset] {
+		return fmt.Errorf("cannot execute sell order of %s: not enough positions to sell", asset.Symbol)
+	}
+	if _, _, err := fake.selectLots(order, position); err != nil {
+		return fmt.Errorf("cannot execute sell order of %s: %v", asset.Symbol, err)
+	}
+	fake.heldForSells[asset] += order.Quantity
+	return nil
+}
+
+// release Returns what reserve held for the given quantity of an order
+func (fake *Fake) release(order model.Order, quantity float64) {
+	if order.Type == model.OrderTypeBuy {
+		fake.cash += quantity * order.Price
+		return
+	}
+	fake.heldForSells[order.Asset] -= quantity
+	if fake.heldForSells[order.Asset] <= 0 {
+		delete(fake.heldForSells, order.Asset)
+	}
+}
+
+// selectLots Selects the lots a sell order sells from a position
+func (fake *Fake) selectLots(order model.Order, position *model.Position) ([]model.Lot, []model.Lot, error) {
+	method := order.LotMethod
+	if method == 0 {
+		method = fake.lotMethod
+	}
+	return tax.Select(position.Lots, order.Quantity, order.Price, fake.quotes[order.Asset].Date, method, order.LotIDs...)
+}
+
+// fill Fills a reserved order at its limit price
+func (fake *Fake) fill(order model.Order) error {
+	asset := order.Asset
+	date := fake.quotes[asset].Date
+	position, exists := fake.positions[asset]
+	if !exists {
+		fake.positions[asset] = &model.Position{
+			Asset: asset,
 		}
-		if order.Type == model.OrderTypeBuy {
-			total := order.Quantity * order.Price
-			if total > fake.cash {
-				errs = append(errs, fmt.Errorf("cannot execute buy order of %s: not enough cash", asset.Symbol))
-				continue
-			}
-			position.AvgBuyPrice = (position.AvgBuyPrice*position.Quantity + order.Price*order.Quantity) / (position.Quantity + order.Quantity)
-			position.Quantity += order.Quantity
-			fake.cash -= order.Quantity * order.Price
-		} else if order.Type == model.OrderTypeSell {
-			if order.Quantity > position.Quantity {
-				errs = append(errs, fmt.Errorf("cannot execute sell order of %s: not enough positions to sell", asset.Symbol))
-				continue
-			}
-			position.AvgBuyPrice = (position.AvgBuyPrice*position.Quantity - order.Price*order.Quantity) / (position.Quantity - order.Quantity)
-			position.Quantity -= order.Quantity
-			fake.cash += order.Quantity * order.Price
-			if position.Quantity == 0 {
-				delete(fake.positions, asset)
-			}
-		} else {
-			errs = append(errs, fmt.Errorf("invalid order type: %v", order.Type))
+		position = fake.positions[asset]
+	}
+	if order.Type == model.OrderTypeBuy {
+		fake.lotCount++
+		position.Lots = append(position.Lots, model.Lot{
+			ID:       strconv.Itoa(fake.lotCount),
+			Acquired: date,
+			Quantity: order.Quantity,
+			Cost:     order.Price,
+		})
+		position.Quantity += order.Quantity
+		position.AvgBuyPrice = averageCost(position.Lots)
+		return nil
+	}
+	sold, remaining, err := fake.selectLots(order, position)
+	if err != nil {
+		return fmt.Errorf("cannot execute sell order of %s: %v", asset.Symbol, err)
+	}
+	fake.release(order, order.Quantity)
+	fake.realizedGains = append(fake.realizedGains, tax.Realize(asset, sold, order.Price, date)...)
+	position.Lots = remaining
+	position.Quantity -= order.Quantity
+	position.AvgBuyPrice = averageCost(position.Lots)
+	fake.cash += order.Quantity * order.Price
+	if position.Quantity == 0 {
+		delete(fake.positions, asset)
+	}
+	return nil
+}
+
+// averageCost Returns the average cost per share of the lots
+func averageCost(lots []model.Lot) float64 {
+	var cost, quantity float64
+	for _, lot := range lots {
+		cost += lot.Cost * lot.Quantity
+		quantity += lot.Quantity
+	}
+	if quantity == 0 {
+		return 0
+	}
+	return cost / quantity
+}
+
+// isMarketable Returns true if the current quote satisfies the limit of the order
+func (fake *Fake) isMarketable(order model.Order) bool {
+	quote, exists := fake.quotes[order.Asset]
+	if !exists {
+		return false
+	}
+	if order.Type == model.OrderTypeBuy {
+		return quote.Price <= order.Price
+	}
+	return quote.Price >= order.Price
+}
+
+// matchOrders Fills all open orders whose limit is reached by the current quotes
+func (fake *Fake) matchOrders() {
+	for _, id := range fake.orderIDs {
+		order := fake.orders[id]
+		if order.Status != model.OrderStatusOpen || !fake.isMarketable(*order) {
+			continue
+		}
+		if err := fake.fill(*order); err != nil {
+			// the lots of the order were sold by another order in the meantime
+			fake.release(*order, order.Quantity)
+			order.Status = model.OrderStatusRejected
 			continue
 		}
+		order.Status = model.OrderStatusFilled
+		order.FilledQuantity = order.Quantity
+		order.FilledPrice = order.Price
+		order.FilledAt = fake.quotes[order.Asset].Date
+		fake.logger.Debug("order filled", logging.Order(*order)...)
 	}
-	return errs
+}
+
+// Submit Places a limit order that is filled as soon as the quotes reach its limit price
+func (fake *Fake) Submit(order model.Order) (model.Order, error) {
+	if err := validate(order); err != nil {
+		return model.Order{}, err
+	}
+	if err := fake.reserve(order); err != nil {
+		return model.Order{}, err
+	}
+	order.Status = model.OrderStatusOpen
+	order.FilledQuantity = 0
+	order.FilledPrice = 0
+	id := fake.record(order)
+	fake.matchOrders()
+	return *fake.orders[id], nil
+}
+
+// record Assigns the next ID to an order and stores it, returns the ID
+func (fake *Fake) record(order model.Order) string {
+	order.ID = strconv.Itoa(len(fake.orderIDs) + 1)
+	fake.orders[order.ID] = &order
+	fake.orderIDs = append(fake.orderIDs, order.ID)
+	return order.ID
+}
+
+// GetOrder GetOrder
+func (fake *Fake) GetOrder(id string) (model.Order, error) {
+	order, exists := fake.orders[id]
+	if !exists {
+		return model.Order{}, fmt.Errorf("order %s does not exist", id)
+	}
+	return *order, nil
+}
+
+// GetOpenOrders GetOpenOrders
+func (fake *Fake) GetOpenOrders() ([]model.Order, error) {
+	orders := []model.Order{}
+	for _, id := range fake.orderIDs {
+		if order := fake.orders[id]; !order.IsDone() {
+			orders = append(orders, *order)
+		}
+	}
+	return orders, nil
+}
+
+// GetOrderHistory GetOrderHistory
+func (fake *Fake) GetOrderHistory(since time.Time) ([]model.Order, error) {
+	orders := []model.Order{}
+	for _, id := range fake.orderIDs {
+		order := fake.orders[id]
+		if order.FilledQuantity > 0 && !order.FilledAt.Before(since) {
+			orders = append(orders, *order)
+		}
+	}
+	return orders, nil
+}
+
+// CancelOrder CancelOrder
+func (fake *Fake) CancelOrder(id string) error {
+	order, exists := fake.orders[id]
+	if !exists {
+		return fmt.Errorf("order %s does not exist", id)
+	}
+	if order.IsDone() {
+		return fmt.Errorf("cannot cancel order %s: order is not open", id)
+	}
+	fake.release(*order, order.RemainingQuantity())
+	order.Status = model.OrderStatusCancelled
+	return nil
 }
 
 // GetAvailableCash GetAvailableCash
@@ -116,7 +377,25 @@ func (fake *Fake) GetPositions(assets ...model.Asset) ([]model.Position, error)
 			}
 		}
 		positions[i] = *position
+		positions[i].Lots = append([]model.Lot{}, position.Lots...)
+	}
+	return positions, nil
+}
+
+// GetAllPositions Returns the positions with a quantity, sorted by symbol
+func (fake *Fake) GetAllPositions() ([]model.Position, error) {
+	positions := []model.Position{}
+	for _, position := range fake.positions {
+		if position == nil || position.Quantity == 0 {
+			continue
+		}
+		copied := *position
+		copied.Lots = append([]model.Lot{}, position.Lots...)
+		positions = append(positions, copied)
 	}
+	sort.Slice(positions, func(i, j int) bool {
+		return positions[i].Asset.Symbol < positions[j].Asset.Symbol
+	})
 	return positions, nil
 }
 
@@ -2,11 +2,13 @@ package fake_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/MitchK/autorobin/lib/broker"
 	"github.com/MitchK/autorobin/lib/broker/fake"
 	"github.com/MitchK/autorobin/lib/broker/fake/fixtures"
 	"github.com/MitchK/autorobin/lib/model"
+	"github.com/MitchK/autorobin/lib/tax"
 	"github.com/onsi/gomega"
 )
 
@@ -217,6 +219,13 @@ func TestGetPortfolio(t *testing.T) {
 	g.Expect(err).To(gomega.BeNil())
 	g.Expect(len(positions)).To(gomega.Equal(4))
 
+	// Only the held positions, sorted by symbol
+	positions, err = broker.GetAllPositions()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(positions)).To(gomega.Equal(2))
+	g.Expect(positions[0].Asset).To(gomega.Equal(googl))
+	g.Expect(positions[1].Asset).To(gomega.Equal(sap))
+
 	// Get portfolio
 	portfolio, err := broker.GetPortfolio(assets...)
 	g.Expect(err).To(gomega.BeNil())
@@ -229,3 +238,206 @@ func TestGetPortfolio(t *testing.T) {
 	g.Expect(portfolio.Quantities[googl]).To(gomega.BeNumerically("~", 1))
 	g.Expect(portfolio.Quantities[sap]).To(gomega.BeNumerically("~", 1))
 }
+
+func TestSubmitCancel(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	broker := fake.NewBroker(initialCash)
+	broker.SetQuotes(model.Quote{Asset: googl, Price: 100})
+
+	// Limit below market stays open and holds cash
+	order, err := broker.Submit(model.Order{
+		Asset:    googl,
+		Quantity: 2,
+		Price:    90,
+		Type:     model.OrderTypeBuy,
+	})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(order.ID).ToNot(gomega.BeEmpty())
+	g.Expect(order.Status).To(gomega.Equal(model.OrderStatusOpen))
+	availableCash, err := broker.GetAvailableCash()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(availableCash).To(gomega.BeNumerically("~", initialCash-180))
+
+	// Cancelling releases the cash
+	err = broker.CancelOrder(order.ID)
+	g.Expect(err).To(gomega.BeNil())
+	order, err = broker.GetOrder(order.ID)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(order.Status).To(gomega.Equal(model.OrderStatusCancelled))
+	availableCash, err = broker.GetAvailableCash()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(availableCash).To(gomega.BeNumerically("~", initialCash))
+	g.Expect(broker.CancelOrder(order.ID)).ToNot(gomega.BeNil())
+
+	// Open order is filled once the market reaches the limit
+	order, err = broker.Submit(model.Order{
+		Asset:    googl,
+		Quantity: 2,
+		Price:    90,
+		Type:     model.OrderTypeBuy,
+	})
+	g.Expect(err).To(gomega.BeNil())
+	broker.SetQuotes(model.Quote{Asset: googl, Price: 89})
+	order, err = broker.GetOrder(order.ID)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(order.Status).To(gomega.Equal(model.OrderStatusFilled))
+	g.Expect(order.FilledQuantity).To(gomega.BeNumerically("~", 2))
+	positions, err := broker.GetPositions(googl)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(positions[0].Quantity).To(gomega.BeNumerically("~", 2))
+
+	// Shares held for an open sell cannot be sold twice
+	_, err = broker.Submit(model.Order{
+		Asset:    googl,
+		Quantity: 2,
+		Price:    100,
+		Type:     model.OrderTypeSell,
+	})
+	g.Expect(err).To(gomega.BeNil())
+	errs := broker.Execute(model.Order{
+		Asset:    googl,
+		Quantity: 1,
+		Price:    89,
+		Type:     model.OrderTypeSell,
+	})
+	g.Expect(len(errs)).To(gomega.Equal(1))
+}
+
+func TestGetOpenOrders(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	broker := fake.NewBroker(initialCash)
+	broker.SetQuotes(model.Quote{Asset: googl, Price: 100}, model.Quote{Asset: sap, Price: 50})
+
+	_, err := broker.Submit(model.Order{Asset: googl, Quantity: 1, Price: 90, Type: model.OrderTypeBuy})
+	g.Expect(err).To(gomega.BeNil())
+	filled, err := broker.Submit(model.Order{Asset: sap, Quantity: 1, Price: 50, Type: model.OrderTypeBuy})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(filled.Status).To(gomega.Equal(model.OrderStatusFilled))
+
+	openOrders, err := broker.GetOpenOrders()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(openOrders)).To(gomega.Equal(1))
+	g.Expect(openOrders[0].Asset).To(gomega.Equal(googl))
+	g.Expect(openOrders[0].RemainingQuantity()).To(gomega.BeNumerically("~", 1))
+
+	g.Expect(broker.CancelOrder(openOrders[0].ID)).To(gomega.BeNil())
+	openOrders, err = broker.GetOpenOrders()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(openOrders).To(gomega.BeEmpty())
+}
+
+func TestLots(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	broker := fake.NewBroker(initialCash)
+	day := time.Date(2018, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	// buy two lots a year apart
+	broker.SetQuotes(model.Quote{Asset: aapl, Price: 100, Date: day})
+	errs := broker.Execute(model.Order{Asset: aapl, Type: model.OrderTypeBuy, Price: 100, Quantity: 10})
+	g.Expect(errs).To(gomega.BeEmpty())
+	broker.SetQuotes(model.Quote{Asset: aapl, Price: 150, Date: day.AddDate(1, 0, 0)})
+	errs = broker.Execute(model.Order{Asset: aapl, Type: model.OrderTypeBuy, Price: 150, Quantity: 10})
+	g.Expect(errs).To(gomega.BeEmpty())
+	positions, err := broker.GetPositions(aapl)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(positions[0].Lots).To(gomega.HaveLen(2))
+	g.Expect(positions[0].AvgBuyPrice).To(gomega.BeNumerically("~", 125))
+
+	// FIFO sells the first lot, held for more than a year
+	broker.SetQuotes(model.Quote{Asset: aapl, Price: 120, Date: day.AddDate(1, 0, 10)})
+	errs = broker.Execute(model.Order{Asset: aapl, Type: model.OrderTypeSell, Price: 120, Quantity: 5})
+	g.Expect(errs).To(gomega.BeEmpty())
+	positions, err = broker.GetPositions(aapl)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(positions[0].AvgBuyPrice).To(gomega.BeNumerically("~", 2000.0/15))
+
+	// highest cost sells the second lot at a short-term loss
+	errs = broker.Execute(model.Order{Asset: aapl, Type: model.OrderTypeSell, Price: 120, Quantity: 5, LotMethod: model.LotMethodHighestCost})
+	g.Expect(errs).To(gomega.BeEmpty())
+
+	// specific lots must exist
+	errs = broker.Execute(model.Order{Asset: aapl, Type: model.OrderTypeSell, Price: 120, Quantity: 1, LotMethod: model.LotMethodSpecific, LotIDs: []string{"3"}})
+	g.Expect(errs).To(gomega.HaveLen(1))
+
+	summary := tax.Summarize(broker.GetRealizedGains()...)
+	g.Expect(summary.LongTerm).To(gomega.BeNumerically("~", 100))
+	g.Expect(summary.ShortTerm).To(gomega.BeNumerically("~", -150))
+}
+
+func TestGetOrderHistory(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	broker := fake.NewBroker(initialCash)
+	day := time.Date(2018, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	broker.SetQuotes(model.Quote{Asset: aapl, Price: 100, Date: day})
+	errs := broker.Execute(model.Order{Asset: aapl, Type: model.OrderTypeBuy, Price: 100, Quantity: 10})
+	g.Expect(errs).To(gomega.BeEmpty())
+	broker.SetQuotes(model.Quote{Asset: aapl, Price: 100, Date: day.AddDate(0, 1, 0)})
+	errs = broker.Execute(model.Order{Asset: aapl, Type: model.OrderTypeSell, Price: 100, Quantity: 5})
+	g.Expect(errs).To(gomega.BeEmpty())
+	_, err := broker.Submit(model.Order{Asset: aapl, Type: model.OrderTypeBuy, Price: 90, Quantity: 1})
+	g.Expect(err).To(gomega.BeNil())
+
+	orders, err := broker.GetOrderHistory(day.AddDate(0, 0, 1))
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(orders).To(gomega.HaveLen(1))
+	g.Expect(orders[0].Type).To(gomega.Equal(model.OrderTypeSell))
+	g.Expect(orders[0].FilledAt).To(gomega.Equal(day.AddDate(0, 1, 0)))
+
+	orders, err = broker.GetOrderHistory(day)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(orders).To(gomega.HaveLen(2))
+}
+
+func TestUpdateQuotes(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	broker := fake.NewBroker(initialCash)
+
+	// Quotes of other assets are kept
+	broker.UpdateQuotes(model.Quote{Asset: googl, Price: 100})
+	broker.UpdateQuotes(model.Quote{Asset: aapl, Price: 50})
+	quotes, err := broker.GetQuotes(googl, aapl)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(quotes[0].Price).To(gomega.Equal(100.0))
+	g.Expect(quotes[1].Price).To(gomega.Equal(50.0))
+
+	// Open orders are filled once the market reaches the limit
+	order, err := broker.Submit(model.Order{
+		Asset:    googl,
+		Quantity: 1,
+		Price:    90,
+		Type:     model.OrderTypeBuy,
+	})
+	g.Expect(err).To(gomega.BeNil())
+	broker.UpdateQuotes(model.Quote{Asset: googl, Price: 90})
+	order, err = broker.GetOrder(order.ID)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(order.Status).To(gomega.Equal(model.OrderStatusFilled))
+}
+
+func TestDepositWithdraw(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	broker := fake.NewBroker(initialCash)
+	broker.SetQuotes(model.Quote{Asset: googl, Price: 100})
+
+	broker.Deposit(500)
+	g.Expect(broker.Withdraw(1500)).To(gomega.Succeed())
+	availableCash, err := broker.GetAvailableCash()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(availableCash).To(gomega.BeNumerically("~", initialCash-1000))
+
+	// Cash held for open buy orders cannot be withdrawn
+	_, err = broker.Submit(model.Order{
+		Asset:    googl,
+		Quantity: 10,
+		Price:    90,
+		Type:     model.OrderTypeBuy,
+	})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(broker.Withdraw(initialCash - 1500)).NotTo(gomega.Succeed())
+	g.Expect(broker.Withdraw(initialCash - 1900)).To(gomega.Succeed())
+}
@@ -0,0 +1,77 @@
+package fake
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/MitchK/autorobin/lib/model"
+)
+
+// state State of the broker as it is stored
+type state struct {
+	Cash          float64
+	Quotes        []model.Quote
+	Positions     []model.Position
+	Orders        []model.Order
+	LotMethod     model.LotMethod
+	LotCount      int
+	RealizedGains []model.RealizedGain
+}
+
+// MarshalJSON Encodes cash, quotes, positions with their lots, orders and realized gains
+func (fake *Fake) MarshalJSON() ([]byte, error) {
+	s := state{
+		Cash:          fake.cash,
+		Quotes:        fake.Quotes(),
+		Positions:     []model.Position{},
+		Orders:        []model.Order{},
+		LotMethod:     fake.lotMethod,
+		LotCount:      fake.lotCount,
+		RealizedGains: fake.realizedGains,
+	}
+	for _, position := range fake.positions {
+		s.Positions = append(s.Positions, *position)
+	}
+	sort.Slice(s.Positions, func(i, j int) bool {
+		return s.Positions[i].Asset.Symbol < s.Positions[j].Asset.Symbol
+	})
+	for _, id := range fake.orderIDs {
+		s.Orders = append(s.Orders, *fake.orders[id])
+	}
+	return json.Marshal(s)
+}
+
+// UnmarshalJSON Restores a state encoded by MarshalJSON, the shares held for open sell orders are derived from the orders
+func (fake *Fake) UnmarshalJSON(data []byte) error {
+	s := state{}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	restored := NewBroker(s.Cash)
+	if s.LotMethod != 0 {
+		restored.lotMethod = s.LotMethod
+	}
+	restored.lotCount = s.LotCount
+	restored.realizedGains = s.RealizedGains
+	restored.quotes = map[model.Asset]model.Quote{}
+	for _, quote := range s.Quotes {
+		restored.quotes[quote.Asset] = quote
+	}
+	for i := range s.Positions {
+		position := s.Positions[i]
+		restored.positions[position.Asset] = &position
+	}
+	for _, order := range s.Orders {
+		order := order
+		restored.orders[order.ID] = &order
+		restored.orderIDs = append(restored.orderIDs, order.ID)
+		if order.Type == model.OrderTypeSell && !order.IsDone() {
+			restored.heldForSells[order.Asset] += order.RemainingQuantity()
+		}
+	}
+	if fake.logger != nil {
+		restored.logger = fake.logger
+	}
+	*fake = *restored
+	return nil
+}
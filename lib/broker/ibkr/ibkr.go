@@ -0,0 +1,756 @@
+package ibkr
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MitchK/autorobin/lib/broker"
+	"github.com/MitchK/autorobin/lib/logging"
+	"github.com/MitchK/autorobin/lib/model"
+)
+
+const (
+	// DefaultURL API of a Client Portal gateway running on the local machine
+	DefaultURL = "https://localhost:5000/v1/api"
+
+	// fieldLastPrice Market data field of the last price
+	fieldLastPrice = "31"
+
+	// positionsPageSize Number of positions the API returns per page
+	positionsPageSize = 100
+
+	// maxReplies Maximum number of order confirmations that are answered before an order is given up
+	maxReplies = 10
+
+	// snapshotAttempts Number of snapshot requests until market data has to be available
+	snapshotAttempts = 5
+
+	// tradesDays Number of days the API returns executions for
+	tradesDays = 7
+)
+
+// Config Config
+type Config struct {
+	// BaseURL API of the gateway, DefaultURL if not set
+	BaseURL string
+
+	// Account Account ID, e.g. U1234567. The selected account of the gateway is used if not set.
+	Account string
+
+	// Insecure Accepts the self-signed certificate of the gateway. Ignored if Client is set.
+	Insecure bool
+
+	// Client HTTP client, http.DefaultClient if not set
+	Client *http.Client
+
+	// Logger Logs requests and orders, silent if not set
+	Logger *slog.Logger
+
+	// SnapshotDelay Wait between market data snapshots until the prices arrive, 500ms if not set
+	SnapshotDelay time.Duration
+}
+
+func init() {
+	broker.Register(broker.Registration{
+		Name:        "ibkr",
+		Description: "Interactive Brokers account of a logged in Client Portal gateway",
+		Settings: []broker.Setting{
+			{Name: "url", Usage: "API of the Client Portal gateway", Default: DefaultURL},
+			{Name: "account", Usage: "Account ID, the selected account of the gateway if not set"},
+			{Name: "insecure", Usage: "Accept the self-signed certificate of the gateway", Default: "false"},
+		},
+		New: func(config broker.Config, logger *slog.Logger) (broker.Broker, error) {
+			insecure, err := config.Bool("insecure")
+			if err != nil {
+				return nil, err
+			}
+			return NewBroker(Config{
+				BaseURL:  config["url"],
+				Account:  config["account"],
+				Insecure: insecure,
+				Logger:   logger,
+			})
+		},
+	})
+}
+
+// ibkrBroker ibkrBroker
+type ibkrBroker struct {
+	config  Config
+	logger  *slog.Logger
+	account string
+	conids  map[string]int
+}
+
+// NewBroker Creates a broker for an account of a gateway session. The session has to be authenticated in the browser before.
+func NewBroker(config Config) (broker.Broker, error) {
+	if config.BaseURL == "" {
+		config.BaseURL = DefaultURL
+	}
+	config.BaseURL = strings.TrimSuffix(config.BaseURL, "/")
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+		if config.Insecure {
+			config.Client = &http.Client{
+				Transport: &http.Transport{
+					TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+				},
+			}
+		}
+	}
+	if config.SnapshotDelay == 0 {
+		config.SnapshotDelay = 500 * time.Millisecond
+	}
+	broker := &ibkrBroker{
+		config: config,
+		logger: logging.Or(config.Logger),
+		conids: map[string]int{},
+	}
+
+	status := struct {
+		Authenticated bool `json:"authenticated"`
+		Connected     bool `json:"connected"`
+	}{}
+	if err := broker.do(http.MethodPost, "/iserver/auth/status", nil, &status); err != nil {
+		return nil, err
+	}
+	if !status.Authenticated || !status.Connected {
+		return nil, errors.New("gateway session is not authenticated, log in at the gateway first")
+	}
+	if err := broker.selectAccount(config.Account); err != nil {
+		return nil, err
+	}
+	return broker, nil
+}
+
+// apiError Error response of the API
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// do Sends a request to the gateway and decodes the JSON response into out if it is not nil
+func (broker *ibkrBroker) do(method string, endpoint string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(buf)
+	}
+	req, err := http.NewRequest(method, broker.config.BaseURL+endpoint, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := broker.config.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	buf, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	broker.logger.Debug("request", "method", method, "path", req.URL.Path, "status", res.StatusCode)
+	if res.StatusCode >= 300 {
+		apiErr := apiError{}
+		if json.Unmarshal(buf, &apiErr) == nil && apiErr.Error != "" {
+			return fmt.Errorf("ibkr: %s %s: %s", method, req.URL.Path, apiErr.Error)
+		}
+		return fmt.Errorf("ibkr: %s %s: %s", method, req.URL.Path, res.Status)
+	}
+	if out == nil || len(buf) == 0 {
+		return nil
+	}
+	return json.Unmarshal(buf, out)
+}
+
+// number Number that the API sends either as JSON number or as string. Strings may be prefixed with a letter,
+// e.g. C for closing prices or H for halted ones.
+type number float64
+
+func (n *number) UnmarshalJSON(data []byte) error {
+	str := strings.Trim(string(data), `"`)
+	str = strings.TrimLeft(str, "ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	str = strings.Replace(str, ",", "", -1)
+	if str == "" || str == "null" {
+		*n = 0
+		return nil
+	}
+	value, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return fmt.Errorf("invalid number: %s", data)
+	}
+	*n = number(value)
+	return nil
+}
+
+// selectAccount Switches the gateway to the given account, or uses its selected account
+func (broker *ibkrBroker) selectAccount(account string) error {
+	accounts := struct {
+		Accounts        []string `json:"accounts"`
+		SelectedAccount string   `json:"selectedAccount"`
+	}{}
+	if err := broker.do(http.MethodGet, "/iserver/accounts", nil, &accounts); err != nil {
+		return err
+	}
+	if len(accounts.Accounts) == 0 {
+		return errors.New("gateway session has no accounts")
+	}
+	if account == "" {
+		account = accounts.SelectedAccount
+		if account == "" {
+			account = accounts.Accounts[0]
+		}
+		broker.account = account
+		return nil
+	}
+
+	found := false
+	for _, id := range accounts.Accounts {
+		found = found || id == account
+	}
+	if !found {
+		return fmt.Errorf("account %s does not exist", account)
+	}
+	if account != accounts.SelectedAccount {
+		request := struct {
+			AcctID string `json:"acctId"`
+		}{account}
+		if err := broker.do(http.MethodPost, "/iserver/account", request, nil); err != nil {
+			return err
+		}
+	}
+	broker.account = account
+	return nil
+}
+
+type stock struct {
+	AssetClass string `json:"assetClass"`
+	Contracts  []struct {
+		Conid int  `json:"conid"`
+		IsUS  bool `json:"isUS"`
+	} `json:"contracts"`
+}
+
+// getConids Looks up the contract IDs of the assets, US listings are preferred
+func (broker *ibkrBroker) getConids(assets ...model.Asset) ([]int, error) {
+	missing := []string{}
+	for _, asset := range assets {
+		if _, ok := broker.conids[asset.Symbol]; !ok {
+			missing = append(missing, asset.Symbol)
+		}
+	}
+	if len(missing) > 0 {
+		stocks := map[string][]stock{}
+		err := broker.do(http.MethodGet, "/trsrv/stocks?symbols="+url.QueryEscape(strings.Join(missing, ",")), nil, &stocks)
+		if err != nil {
+			return nil, err
+		}
+		for symbol, entries := range stocks {
+			us := false
+			for _, entry := range entries {
+				if entry.AssetClass != "STK" {
+					continue
+				}
+				for _, contract := range entry.Contracts {
+					if _, ok := broker.conids[symbol]; !ok || (contract.IsUS && !us) {
+						broker.conids[symbol] = contract.Conid
+						us = contract.IsUS
+					}
+				}
+			}
+		}
+	}
+
+	conids := make([]int, len(assets))
+	for i, asset := range assets {
+		conid, ok := broker.conids[asset.Symbol]
+		if !ok {
+			return nil, fmt.Errorf("could not find contract of %s", asset.Symbol)
+		}
+		conids[i] = conid
+	}
+	return conids, nil
+}
+
+// GetAvailableCash Cash balance of the account without the cash held for open buy orders
+func (broker *ibkrBroker) GetAvailableCash() (float64, error) {
+	ledger := map[string]struct {
+		CashBalance number `json:"cashbalance"`
+	}{}
+	if err := broker.do(http.MethodGet, "/portfolio/"+url.PathEscape(broker.account)+"/ledger", nil, &ledger); err != nil {
+		return 0, err
+	}
+	balance, ok := ledger["USD"]
+	if !ok {
+		balance, ok = ledger["BASE"]
+	}
+	if !ok {
+		return 0, errors.New("ledger has no USD balance")
+	}
+	cash := float64(balance.CashBalance)
+
+	openOrders, err := broker.GetOpenOrders()
+	if err != nil {
+		return 0, err
+	}
+	for _, order := range openOrders {
+		if order.Type == model.OrderTypeBuy {
+			cash -= order.RemainingQuantity() * order.Price
+		}
+	}
+	return math.Max(0, cash), nil
+}
+
+type position struct {
+	Conid      int    `json:"conid"`
+	Ticker     string `json:"ticker"`
+	AssetClass string `json:"assetClass"`
+	Position   number `json:"position"`
+	AvgCost    number `json:"avgCost"`
+}
+
+// getPositions Returns the positions of the account of all pages
+func (broker *ibkrBroker) getPositions() ([]position, error) {
+	result := []position{}
+	for page := 0; ; page++ {
+		positions := []position{}
+		endpoint := fmt.Sprintf("/portfolio/%s/positions/%d", url.PathEscape(broker.account), page)
+		if err := broker.do(http.MethodGet, endpoint, nil, &positions); err != nil {
+			return nil, err
+		}
+		result = append(result, positions...)
+		if len(positions) < positionsPageSize {
+			break
+		}
+	}
+	return result, nil
+}
+
+// GetAllPositions Returns the open stock positions of the account and remembers their conids
+func (broker *ibkrBroker) GetAllPositions() ([]model.Position, error) {
+	positions, err := broker.getPositions()
+	if err != nil {
+		return nil, err
+	}
+	result := []model.Position{}
+	for _, pos := range positions {
+		if pos.AssetClass != "STK" || pos.Position == 0 {
+			continue
+		}
+		if _, ok := broker.conids[pos.Ticker]; !ok {
+			broker.conids[pos.Ticker] = pos.Conid
+		}
+		result = append(result, model.Position{
+			Asset: model.Asset{
+				Symbol: pos.Ticker,
+			},
+			Quantity:    float64(pos.Position),
+			AvgBuyPrice: float64(pos.AvgCost),
+		})
+	}
+	return result, nil
+}
+
+// GetPositions GetPositions
+func (broker *ibkrBroker) GetPositions(assets ...model.Asset) ([]model.Position, error) {
+	conids, err := broker.getConids(assets...)
+	if err != nil {
+		return nil, err
+	}
+	positions, err := broker.getPositions()
+	if err != nil {
+		return nil, err
+	}
+	byConid := map[int]position{}
+	for _, pos := range positions {
+		byConid[pos.Conid] = pos
+	}
+
+	result := make([]model.Position, len(assets))
+	for i, asset := range assets {
+		pos := byConid[conids[i]]
+		result[i] = model.Position{
+			Asset:       asset,
+			Quantity:    float64(pos.Position),
+			AvgBuyPrice: float64(pos.AvgCost),
+		}
+	}
+	return result, nil
+}
+
+// GetPortfolio GetPortfolio
+func (broker *ibkrBroker) GetPortfolio(assets ...model.Asset) (model.Portfolio, error) {
+	positions, err := broker.GetPositions(assets...)
+	if err != nil {
+		return model.Portfolio{}, err
+	}
+	quotes, err := broker.GetQuotes(assets...)
+	if err != nil {
+		return model.Portfolio{}, err
+	}
+
+	quantities := model.Quantities{}
+	prices := model.Prices{}
+	var total float64
+	for i, asset := range assets {
+		quantities[asset] = positions[i].Quantity
+		prices[asset] = quotes[i].Price
+		total += quantities[asset] * prices[asset]
+	}
+	weights := model.Weights{}
+	for _, asset := range assets {
+		if total == 0 {
+			weights[asset] = 0
+		} else {
+			weights[asset] = quantities[asset] * prices[asset] / total
+		}
+	}
+	return model.Portfolio{
+		Weights:    weights,
+		Quantities: quantities,
+		Prices:     prices,
+		TotalValue: total,
+	}, nil
+}
+
+// GetQuotes Returns the last prices of a market data snapshot. The gateway only starts streaming with the first request,
+// so the snapshot is repeated until the prices of all assets arrived.
+func (broker *ibkrBroker) GetQuotes(assets ...model.Asset) ([]model.Quote, error) {
+	if len(assets) == 0 {
+		return []model.Quote{}, nil
+	}
+	conids, err := broker.getConids(assets...)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(conids))
+	for i, conid := range conids {
+		ids[i] = strconv.Itoa(conid)
+	}
+	endpoint := "/iserver/marketdata/snapshot?conids=" + strings.Join(ids, ",") + "&fields=" + fieldLastPrice
+
+	for attempt := 1; ; attempt++ {
+		snapshots := []map[string]json.RawMessage{}
+		if err := broker.do(http.MethodGet, endpoint, nil, &snapshots); err != nil {
+			return nil, err
+		}
+		byConid := map[int]model.Quote{}
+		for _, snapshot := range snapshots {
+			raw, ok := snapshot[fieldLastPrice]
+			if !ok {
+				continue
+			}
+			var conid int
+			var price number
+			var updated int64
+			if err := json.Unmarshal(snapshot["conid"], &conid); err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(raw, &price); err != nil {
+				return nil, err
+			}
+			if _, ok := snapshot["_updated"]; ok {
+				if err := json.Unmarshal(snapshot["_updated"], &updated); err != nil {
+					return nil, err
+				}
+			}
+			byConid[conid] = model.Quote{
+				Price: float64(price),
+				Date:  time.Unix(0, updated*int64(time.Millisecond)).UTC(),
+			}
+		}
+
+		quotes := make([]model.Quote, len(assets))
+		complete := true
+		for i, asset := range assets {
+			quote, ok := byConid[conids[i]]
+			if !ok || quote.Price <= 0 {
+				if attempt == snapshotAttempts {
+					return nil, fmt.Errorf("could not get quote of %s", asset.Symbol)
+				}
+				complete = false
+				break
+			}
+			quote.Asset = asset
+			quotes[i] = quote
+		}
+		if complete {
+			return quotes, nil
+		}
+		time.Sleep(broker.config.SnapshotDelay)
+	}
+}
+
+type orderRequest struct {
+	AcctID    string  `json:"acctId"`
+	Conid     int     `json:"conid"`
+	OrderType string  `json:"orderType"`
+	Price     float64 `json:"price"`
+	Side      string  `json:"side"`
+	TIF       string  `json:"tif"`
+	Quantity  float64 `json:"quantity"`
+}
+
+// orderReply Reply to an order request, either a question that has to be confirmed or the placed order
+type orderReply struct {
+	ID          string   `json:"id"`
+	Message     []string `json:"message"`
+	OrderID     string   `json:"order_id"`
+	OrderStatus string   `json:"order_status"`
+	Error       string   `json:"error"`
+}
+
+// Submit Places a limit order that is valid for the day. The questions of the gateway, e.g. about price
+// deviations or order sizes, are confirmed.
+func (broker *ibkrBroker) Submit(o model.Order) (model.Order, error) {
+	if o.Quantity <= 0 {
+		return model.Order{}, fmt.Errorf("cannot submit order of %s: invalid quantity: %v", o.Asset.Symbol, o.Quantity)
+	}
+	side := "BUY"
+	if o.Type == model.OrderTypeSell {
+		side = "SELL"
+	} else if o.Type != model.OrderTypeBuy {
+		return model.Order{}, fmt.Errorf("invalid order type: %v", o.Type)
+	}
+	conids, err := broker.getConids(o.Asset)
+	if err != nil {
+		return model.Order{}, err
+	}
+	request := struct {
+		Orders []orderRequest `json:"orders"`
+	}{
+		Orders: []orderRequest{{
+			AcctID:    broker.account,
+			Conid:     conids[0],
+			OrderType: "LMT",
+			Price:     math.Round(o.Price*100) / 100,
+			Side:      side,
+			TIF:       "DAY",
+			Quantity:  o.Quantity,
+		}},
+	}
+
+	replies := []orderReply{}
+	err = broker.do(http.MethodPost, "/iserver/account/"+url.PathEscape(broker.account)+"/orders", request, &replies)
+	for i := 0; err == nil; i++ {
+		if len(replies) == 0 {
+			return model.Order{}, fmt.Errorf("cannot submit order of %s: empty reply", o.Asset.Symbol)
+		}
+		reply := replies[0]
+		if reply.Error != "" {
+			return model.Order{}, fmt.Errorf("cannot submit order of %s: %s", o.Asset.Symbol, reply.Error)
+		}
+		if reply.OrderID != "" {
+			submitted := o
+			submitted.ID = reply.OrderID
+			submitted.Status = model.OrderStatusOpen
+			broker.logger.Info("order submitted", logging.Order(submitted)...)
+			return submitted, nil
+		}
+		if reply.ID == "" || i == maxReplies {
+			return model.Order{}, fmt.Errorf("cannot submit order of %s: unexpected reply: %s", o.Asset.Symbol, strings.Join(reply.Message, " "))
+		}
+		broker.logger.Debug("confirming order", append(logging.Order(o), "question", strings.Join(reply.Message, " "))...)
+		confirmation := struct {
+			Confirmed bool `json:"confirmed"`
+		}{true}
+		replies = []orderReply{}
+		err = broker.do(http.MethodPost, "/iserver/reply/"+url.PathEscape(reply.ID), confirmation, &replies)
+	}
+	return model.Order{}, err
+}
+
+// Execute Execute
+func (broker *ibkrBroker) Execute(orders ...model.Order) []error {
+	errs := []error{}
+	for _, order := range orders {
+		if _, err := broker.Submit(order); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func convertStatus(status string) model.OrderStatus {
+	switch status {
+	case "Filled":
+		return model.OrderStatusFilled
+	case "Cancelled", "ApiCancelled":
+		return model.OrderStatusCancelled
+	case "Inactive":
+		return model.OrderStatusRejected
+	}
+	return model.OrderStatusOpen
+}
+
+func convertSide(side string) (model.OrderType, error) {
+	switch side {
+	case "B", "BUY":
+		return model.OrderTypeBuy, nil
+	case "S", "SELL":
+		return model.OrderTypeSell, nil
+	}
+	return 0, fmt.Errorf("invalid order side: %s", side)
+}
+
+type orderStatus struct {
+	OrderID      int    `json:"order_id"`
+	Symbol       string `json:"symbol"`
+	Side         string `json:"side"`
+	TotalSize    number `json:"total_size"`
+	CumFill      number `json:"cum_fill"`
+	AveragePrice number `json:"average_price"`
+	LimitPrice   number `json:"limit_price"`
+	OrderStatus  string `json:"order_status"`
+	OrderTime    string `json:"order_time"`
+}
+
+// GetOrder GetOrder
+func (broker *ibkrBroker) GetOrder(id string) (model.Order, error) {
+	status := orderStatus{}
+	if err := broker.do(http.MethodGet, "/iserver/account/order/status/"+url.PathEscape(id), nil, &status); err != nil {
+		return model.Order{}, err
+	}
+	orderType, err := convertSide(status.Side)
+	if err != nil {
+		return model.Order{}, err
+	}
+	order := model.Order{
+		ID:   strconv.Itoa(status.OrderID),
+		Type: orderType,
+		Asset: model.Asset{
+			Symbol: status.Symbol,
+		},
+		Price:          float64(status.LimitPrice),
+		Quantity:       float64(status.TotalSize),
+		Status:         convertStatus(status.OrderStatus),
+		FilledQuantity: float64(status.CumFill),
+		FilledPrice:    float64(status.AveragePrice),
+	}
+	if orderTime, err := time.Parse("060102150405", status.OrderTime); err == nil {
+		order.FilledAt = orderTime
+	}
+	return order, nil
+}
+
+// CancelOrder CancelOrder
+func (broker *ibkrBroker) CancelOrder(id string) error {
+	if err := broker.do(http.MethodDelete, "/iserver/account/"+url.PathEscape(broker.account)+"/order/"+url.PathEscape(id), nil, nil); err != nil {
+		return err
+	}
+	broker.logger.Info("order cancelled", logging.KeyOrderID, id)
+	return nil
+}
+
+type liveOrder struct {
+	Account        string `json:"acct"`
+	OrderID        int    `json:"orderId"`
+	Ticker         string `json:"ticker"`
+	Side           string `json:"side"`
+	TotalSize      number `json:"totalSize"`
+	FilledQuantity number `json:"filledQuantity"`
+	AvgPrice       number `json:"avgPrice"`
+	Price          number `json:"price"`
+	Status         string `json:"status"`
+}
+
+// GetOpenOrders GetOpenOrders
+func (broker *ibkrBroker) GetOpenOrders() ([]model.Order, error) {
+	live := struct {
+		Orders []liveOrder `json:"orders"`
+	}{}
+	if err := broker.do(http.MethodGet, "/iserver/account/orders", nil, &live); err != nil {
+		return nil, err
+	}
+	orders := []model.Order{}
+	for _, o := range live.Orders {
+		if o.Account != broker.account || convertStatus(o.Status) != model.OrderStatusOpen {
+			continue
+		}
+		orderType, err := convertSide(o.Side)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, model.Order{
+			ID:   strconv.Itoa(o.OrderID),
+			Type: orderType,
+			Asset: model.Asset{
+				Symbol: o.Ticker,
+			},
+			Price:          float64(o.Price),
+			Quantity:       float64(o.TotalSize),
+			Status:         model.OrderStatusOpen,
+			FilledQuantity: float64(o.FilledQuantity),
+			FilledPrice:    float64(o.AvgPrice),
+		})
+	}
+	return orders, nil
+}
+
+type trade struct {
+	ExecutionID string `json:"execution_id"`
+	Symbol      string `json:"symbol"`
+	Side        string `json:"side"`
+	Size        number `json:"size"`
+	Price       number `json:"price"`
+	TradeTime   int64  `json:"trade_time_r"`
+	Account     string `json:"account"`
+}
+
+// GetOrderHistory Returns every execution since the given time as a filled order.
+// The gateway only reports the executions of the last 7 days.
+func (broker *ibkrBroker) GetOrderHistory(since time.Time) ([]model.Order, error) {
+	days := int(math.Ceil(time.Since(since).Hours() / 24))
+	if days < 1 {
+		days = 1
+	}
+	if days > tradesDays {
+		days = tradesDays
+	}
+	trades := []trade{}
+	if err := broker.do(http.MethodGet, "/iserver/account/trades?days="+strconv.Itoa(days), nil, &trades); err != nil {
+		return nil, err
+	}
+	orders := []model.Order{}
+	for _, t := range trades {
+		filledAt := time.Unix(0, t.TradeTime*int64(time.Millisecond)).UTC()
+		if t.Account != broker.account || filledAt.Before(since) {
+			continue
+		}
+		orderType, err := convertSide(t.Side)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, model.Order{
+			ID:   t.ExecutionID,
+			Type: orderType,
+			Asset: model.Asset{
+				Symbol: t.Symbol,
+			},
+			Price:          float64(t.Price),
+			Quantity:       float64(t.Size),
+			Status:         model.OrderStatusFilled,
+			FilledQuantity: float64(t.Size),
+			FilledPrice:    float64(t.Price),
+			FilledAt:       filledAt,
+		})
+	}
+	return orders, nil
+}
@@ -0,0 +1,259 @@
+package ibkr_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MitchK/autorobin/lib/broker"
+	"github.com/MitchK/autorobin/lib/broker/ibkr"
+	"github.com/MitchK/autorobin/lib/broker/replay"
+	"github.com/MitchK/autorobin/lib/model"
+	"github.com/onsi/gomega"
+)
+
+var (
+	aapl = model.Asset{
+		Symbol: "AAPL",
+	}
+	vti = model.Asset{
+		Symbol: "VTI",
+	}
+	bnd = model.Asset{
+		Symbol: "BND",
+	}
+	assets = []model.Asset{
+		aapl, vti, bnd,
+	}
+	filledID   = "1799796559"
+	openID     = "1799796600"
+	recordings = filepath.Join("fixtures", "recordings.json")
+)
+
+func newBroker(t *testing.T) (broker.Broker, *replay.Server) {
+	server := replay.NewServer(t, recordings)
+	broker, err := ibkr.NewBroker(ibkr.Config{
+		BaseURL:       server.URL + "/v1/api",
+		SnapshotDelay: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return broker, server
+}
+
+func TestNewBroker(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	// should use the selected account of the gateway
+	_, server := newBroker(t)
+	for _, request := range server.Requests() {
+		g.Expect(request.Path).NotTo(gomega.Equal("/v1/api/iserver/account"))
+	}
+
+	// should switch to the given account
+	server = replay.NewServer(t, recordings)
+	_, err := ibkr.NewBroker(ibkr.Config{
+		BaseURL: server.URL + "/v1/api",
+		Account: "U7654321",
+	})
+	g.Expect(err).To(gomega.BeNil())
+	requests := server.Requests()
+	request := requests[len(requests)-1]
+	g.Expect(request.Method).To(gomega.Equal(http.MethodPost))
+	g.Expect(request.Path).To(gomega.Equal("/v1/api/iserver/account"))
+	g.Expect(string(request.Body)).To(gomega.MatchJSON(`{"acctId": "U7654321"}`))
+
+	// should fail for unknown accounts
+	_, err = ibkr.NewBroker(ibkr.Config{
+		BaseURL: server.URL + "/v1/api",
+		Account: "U0000000",
+	})
+	g.Expect(err).NotTo(gomega.BeNil())
+}
+
+func TestGetAvailableCash(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	broker, _ := newBroker(t)
+
+	// should hold back the cash of the remaining quantity of open buy orders of the account
+	cash, err := broker.GetAvailableCash()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(cash).To(gomega.BeNumerically("~", 10000-3*180, 1e-9))
+}
+
+func TestGetPositions(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	broker, server := newBroker(t)
+
+	// should match the positions by the conids of the US listings
+	positions, err := broker.GetPositions(assets...)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(positions).To(gomega.Equal([]model.Position{
+		{Asset: aapl, Quantity: 10, AvgBuyPrice: 170.25},
+		{Asset: vti, Quantity: 3.5, AvgBuyPrice: 210},
+		{Asset: bnd},
+	}))
+
+	// should cache the conids
+	count := len(server.Requests())
+	_, err = broker.GetPositions(assets...)
+	g.Expect(err).To(gomega.BeNil())
+	requests := server.Requests()
+	g.Expect(requests).To(gomega.HaveLen(count + 1))
+	g.Expect(requests[count].Path).To(gomega.Equal("/v1/api/portfolio/U1234567/positions/0"))
+
+	// should fail for unknown symbols
+	_, err = broker.GetPositions(model.Asset{Symbol: "XYZ"})
+	g.Expect(err).NotTo(gomega.BeNil())
+
+	// should return the held positions by their tickers
+	positions, err = broker.GetAllPositions()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(positions).To(gomega.Equal([]model.Position{
+		{Asset: aapl, Quantity: 10, AvgBuyPrice: 170.25},
+		{Asset: vti, Quantity: 3.5, AvgBuyPrice: 210},
+	}))
+}
+
+func TestGetQuotes(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	broker, server := newBroker(t)
+
+	// should repeat the snapshot until the prices arrived
+	quotes, err := broker.GetQuotes(assets...)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(quotes).To(gomega.Equal([]model.Quote{
+		{Asset: aapl, Price: 180.52, Date: time.Unix(1615214001, 0).UTC()},
+		{Asset: vti, Price: 207.2, Date: time.Unix(1615214001, 0).UTC()},
+		{Asset: bnd, Price: 72.1, Date: time.Unix(1615214001, 0).UTC()},
+	}))
+	snapshots := 0
+	for _, request := range server.Requests() {
+		if request.Path == "/v1/api/iserver/marketdata/snapshot" {
+			snapshots++
+		}
+	}
+	g.Expect(snapshots).To(gomega.Equal(2))
+
+	// should compute the portfolio from positions and quotes
+	portfolio, err := broker.GetPortfolio(assets...)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(portfolio.TotalValue).To(gomega.BeNumerically("~", 10*180.52+3.5*207.2, 1e-9))
+	g.Expect(portfolio.Weights[bnd]).To(gomega.Equal(0.0))
+}
+
+func TestSubmit(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	broker, server := newBroker(t)
+
+	// should place a limit order for the day and confirm all questions
+	errs := broker.Execute(model.Order{
+		Type:     model.OrderTypeBuy,
+		Asset:    bnd,
+		Quantity: 10,
+		Price:    72.1,
+	})
+	g.Expect(errs).To(gomega.BeEmpty())
+	requests := server.Requests()
+	orders := requests[len(requests)-3]
+	g.Expect(orders.Path).To(gomega.Equal("/v1/api/iserver/account/U1234567/orders"))
+	body := struct {
+		Orders []map[string]interface{} `json:"orders"`
+	}{}
+	g.Expect(json.Unmarshal(orders.Body, &body)).To(gomega.Succeed())
+	g.Expect(body.Orders).To(gomega.Equal([]map[string]interface{}{{
+		"acctId":    "U1234567",
+		"conid":     43645865.0,
+		"orderType": "LMT",
+		"price":     72.1,
+		"side":      "BUY",
+		"tif":       "DAY",
+		"quantity":  10.0,
+	}}))
+	for _, reply := range requests[len(requests)-2:] {
+		g.Expect(string(reply.Body)).To(gomega.MatchJSON(`{"confirmed": true}`))
+	}
+	g.Expect(requests[len(requests)-1].Path).To(gomega.Equal("/v1/api/iserver/reply/9c7d1a2e-5d2b-4f5b-8c3d-2e6f7a8b9c0d"))
+
+	// should not submit invalid orders
+	errs = broker.Execute(model.Order{
+		Type:  model.OrderTypeSell,
+		Asset: bnd,
+	})
+	g.Expect(errs).To(gomega.HaveLen(1))
+	g.Expect(server.Requests()).To(gomega.HaveLen(len(requests)))
+}
+
+func TestGetOrder(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	broker, _ := newBroker(t)
+
+	// should convert the order status and fill
+	order, err := broker.GetOrder(filledID)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(order).To(gomega.Equal(model.Order{
+		ID:             filledID,
+		Type:           model.OrderTypeBuy,
+		Asset:          bnd,
+		Price:          72.1,
+		Quantity:       10,
+		Status:         model.OrderStatusFilled,
+		FilledQuantity: 10,
+		FilledPrice:    72.08,
+		FilledAt:       time.Date(2021, 3, 8, 14, 30, 2, 0, time.UTC),
+	}))
+}
+
+func TestCancelOrder(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	broker, _ := newBroker(t)
+
+	// should cancel open orders
+	g.Expect(broker.CancelOrder(openID)).To(gomega.Succeed())
+
+	// should report the error of the API
+	err := broker.CancelOrder(filledID)
+	g.Expect(err).NotTo(gomega.BeNil())
+	g.Expect(err.Error()).To(gomega.ContainSubstring("doesn't exist"))
+}
+
+func TestGetOpenOrders(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	broker, _ := newBroker(t)
+
+	// should only return the open orders of the account
+	orders, err := broker.GetOpenOrders()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(orders).To(gomega.HaveLen(1))
+	g.Expect(orders[0].ID).To(gomega.Equal(openID))
+	g.Expect(orders[0].Asset).To(gomega.Equal(aapl))
+	g.Expect(orders[0].Price).To(gomega.Equal(180.0))
+	g.Expect(orders[0].RemainingQuantity()).To(gomega.Equal(3.0))
+}
+
+func TestGetOrderHistory(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	broker, _ := newBroker(t)
+
+	// should only return the executions of the account since the given time
+	orders, err := broker.GetOrderHistory(time.Date(2021, 3, 6, 0, 0, 0, 0, time.UTC))
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(orders).To(gomega.HaveLen(1))
+	g.Expect(orders[0].Asset).To(gomega.Equal(bnd))
+	g.Expect(orders[0].Type).To(gomega.Equal(model.OrderTypeBuy))
+	g.Expect(orders[0].Status).To(gomega.Equal(model.OrderStatusFilled))
+	g.Expect(orders[0].FilledQuantity).To(gomega.Equal(10.0))
+	g.Expect(orders[0].FilledPrice).To(gomega.Equal(72.08))
+	g.Expect(orders[0].FilledAt).To(gomega.Equal(time.Date(2021, 3, 8, 14, 30, 2, 0, time.UTC)))
+}
@@ -0,0 +1,343 @@
+package paper
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MitchK/autorobin/lib/broker"
+	"github.com/MitchK/autorobin/lib/broker/fake"
+	"github.com/MitchK/autorobin/lib/data"
+	"github.com/MitchK/autorobin/lib/data/quandl"
+	"github.com/MitchK/autorobin/lib/data/tiingo"
+	"github.com/MitchK/autorobin/lib/logging"
+	"github.com/MitchK/autorobin/lib/model"
+)
+
+const (
+	// DataPeriod Period of daily prices that is fetched to find the latest close, it covers weekends and holidays
+	DataPeriod = 7 * 24 * time.Hour
+)
+
+func init() {
+	broker.Register(broker.Registration{
+		Name:        "paper",
+		Description: "Simulated account whose state is stored in a local file",
+		Settings: []broker.Setting{
+			{Name: "state", Usage: "State file of the account, created on first use", Default: "autorobin-paper.json"},
+			{Name: "cash", Usage: "Initial cash of a new account", Default: "10000"},
+			{Name: "prices", Usage: "Current prices, e.g. AAPL=180.5,VTI=207"},
+			{Name: "price-file", Usage: "CSV file with lines SYMBOL,PRICE of current prices"},
+			{Name: "data", Usage: "Fetch the latest close of assets without a given price from tiingo or quandl"},
+			{Name: "data-token", Usage: "Token of the data provider", Secret: true},
+		},
+		New: func(config broker.Config, logger *slog.Logger) (broker.Broker, error) {
+			return newConfigBroker(config, logger)
+		},
+	})
+}
+
+// newConfigBroker Creates a broker from the settings of the registration
+func newConfigBroker(config broker.Config, logger *slog.Logger) (*Broker, error) {
+	cash, err := config.Float("cash")
+	if err != nil {
+		return nil, err
+	}
+	prices := []model.Quote{}
+	if config["price-file"] != "" {
+		prices, err = LoadPrices(config["price-file"])
+		if err != nil {
+			return nil, err
+		}
+	}
+	quotes, err := ParsePrices(config["prices"], time.Now())
+	if err != nil {
+		return nil, err
+	}
+	prices = append(prices, quotes...)
+
+	var adapter data.Adapter
+	switch config["data"] {
+	case "":
+	case "tiingo":
+		adapter = tiingo.NewAdapter(config["data-token"])
+	case "quandl":
+		adapter = quandl.NewAdapter(config["data-token"])
+	default:
+		return nil, fmt.Errorf("unknown data provider: %s", config["data"])
+	}
+	return NewBroker(Config{
+		Path:   config["state"],
+		Cash:   cash,
+		Prices: prices,
+		Data:   adapter,
+		Logger: logger,
+	})
+}
+
+// ParsePrices Parses prices of the form SYMBOL=PRICE,SYMBOL=PRICE
+func ParsePrices(str string, date time.Time) ([]model.Quote, error) {
+	quotes := []model.Quote{}
+	for _, entry := range strings.Split(str, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid price %q, expected SYMBOL=PRICE", entry)
+		}
+		quote, err := parsePrice(parts[0], parts[1], date)
+		if err != nil {
+			return nil, err
+		}
+		quotes = append(quotes, quote)
+	}
+	return quotes, nil
+}
+
+// LoadPrices Loads a CSV file with lines SYMBOL,PRICE, the prices are dated at the modification of the file
+func LoadPrices(path string) ([]model.Quote, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid price file %s: %v", path, err)
+	}
+	quotes := []model.Quote{}
+	for _, record := range records {
+		quote, err := parsePrice(record[0], record[1], info.ModTime())
+		if err != nil {
+			return nil, fmt.Errorf("invalid price file %s: %v", path, err)
+		}
+		quotes = append(quotes, quote)
+	}
+	return quotes, nil
+}
+
+func parsePrice(symbol string, str string, date time.Time) (model.Quote, error) {
+	price, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+	if err != nil || price <= 0 {
+		return model.Quote{}, fmt.Errorf("invalid price %q of %s", str, symbol)
+	}
+	return model.Quote{
+		Asset: model.Asset{
+			Symbol: strings.TrimSpace(symbol),
+		},
+		Price: price,
+		Date:  date,
+	}, nil
+}
+
+// Config Config
+type Config struct {
+	// Path State file of the account, a new account with Cash is created if it does not exist
+	Path string
+	Cash float64
+
+	// Prices Current prices, they are stored for later runs
+	Prices []model.Quote
+
+	// Data Optional provider of the latest close of assets without a current price
+	Data data.Adapter
+
+	// Logger Logs orders and fetched prices, silent if not set
+	Logger *slog.Logger
+}
+
+// Broker Fake broker whose cash, positions, lots, orders and quotes are stored in a file after every change
+type Broker struct {
+	*fake.Fake
+	config Config
+	logger *slog.Logger
+
+	// current Assets whose price is current, they are not fetched from the data provider
+	current map[model.Asset]bool
+}
+
+// NewBroker Loads the state file or creates a new account. The prices of the config replace the stored ones, open orders
+// whose limit they reach are filled.
+func NewBroker(config Config) (*Broker, error) {
+	paper := &Broker{
+		Fake:    fake.NewBroker(config.Cash),
+		config:  config,
+		logger:  logging.Or(config.Logger),
+		current: map[model.Asset]bool{},
+	}
+	paper.SetLogger(paper.logger)
+	state, err := ioutil.ReadFile(config.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(state, paper.Fake); err != nil {
+			return nil, fmt.Errorf("invalid state file %s: %v", config.Path, err)
+		}
+	}
+	for _, quote := range config.Prices {
+		paper.current[quote.Asset] = true
+	}
+	paper.UpdateQuotes(config.Prices...)
+	if err := paper.Save(); err != nil {
+		return nil, err
+	}
+	return paper, nil
+}
+
+// Save Writes the state file. The file is replaced at once, so a failed write does not corrupt it.
+func (paper *Broker) Save() error {
+	data, err := json.MarshalIndent(paper.Fake, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(paper.config.Path), filepath.Base(paper.config.Path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), paper.config.Path)
+}
+
+// Deposit Adds cash to the account
+func (paper *Broker) Deposit(amount float64) error {
+	if amount <= 0 {
+		return fmt.Errorf("invalid amount: %v", amount)
+	}
+	paper.Fake.Deposit(amount)
+	return paper.Save()
+}
+
+// Withdraw Removes cash from the account
+func (paper *Broker) Withdraw(amount float64) error {
+	if amount <= 0 {
+		return fmt.Errorf("invalid amount: %v", amount)
+	}
+	if err := paper.Fake.Withdraw(amount); err != nil {
+		return err
+	}
+	return paper.Save()
+}
+
+// Reset Replaces the account by a new one with the cash of the config, the quotes are kept
+func (paper *Broker) Reset() error {
+	quotes := paper.Quotes()
+	paper.Fake = fake.NewBroker(paper.config.Cash)
+	paper.SetLogger(paper.logger)
+	paper.SetQuotes(quotes...)
+	return paper.Save()
+}
+
+// refresh Fetches the latest close of the assets without a current price from the data provider
+func (paper *Broker) refresh(assets ...model.Asset) error {
+	if paper.config.Data == nil {
+		return nil
+	}
+	missing := []model.Asset{}
+	for _, asset := range assets {
+		if !paper.current[asset] {
+			missing = append(missing, asset)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	now := time.Now()
+	daily, err := paper.config.Data.GetDailyAsc(now.Add(-DataPeriod), now, missing...)
+	if err != nil {
+		return fmt.Errorf("could not fetch prices: %v", err)
+	}
+	quotes := []model.Quote{}
+	for i, asset := range missing {
+		if i >= len(daily) || len(daily[i]) == 0 {
+			return fmt.Errorf("could not fetch prices: no prices of %s", asset.Symbol)
+		}
+		quote := daily[i][len(daily[i])-1]
+		quote.Asset = asset
+		if quote.Date.IsZero() {
+			quote.Date = now
+		}
+		quotes = append(quotes, quote)
+		paper.current[asset] = true
+		paper.logger.Debug("fetched price", logging.KeySymbol, asset.Symbol, "price", quote.Price, "date", quote.Date)
+	}
+	paper.UpdateQuotes(quotes...)
+	return paper.Save()
+}
+
+// GetQuotes GetQuotes
+func (paper *Broker) GetQuotes(assets ...model.Asset) ([]model.Quote, error) {
+	if err := paper.refresh(assets...); err != nil {
+		return nil, err
+	}
+	return paper.Fake.GetQuotes(assets...)
+}
+
+// GetPortfolio GetPortfolio
+func (paper *Broker) GetPortfolio(assets ...model.Asset) (model.Portfolio, error) {
+	if err := paper.refresh(assets...); err != nil {
+		return model.Portfolio{}, err
+	}
+	return paper.Fake.GetPortfolio(assets...)
+}
+
+// Execute Execute
+func (paper *Broker) Execute(orders ...model.Order) []error {
+	assets := []model.Asset{}
+	for _, order := range orders {
+		assets = append(assets, order.Asset)
+	}
+	if err := paper.refresh(assets...); err != nil {
+		return []error{err}
+	}
+	errs := paper.Fake.Execute(orders...)
+	if err := paper.Save(); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// Submit Submit
+func (paper *Broker) Submit(order model.Order) (model.Order, error) {
+	if err := paper.refresh(order.Asset); err != nil {
+		return model.Order{}, err
+	}
+	submitted, err := paper.Fake.Submit(order)
+	if err != nil {
+		return model.Order{}, err
+	}
+	return submitted, paper.Save()
+}
+
+// CancelOrder CancelOrder
+func (paper *Broker) CancelOrder(id string) error {
+	if err := paper.Fake.CancelOrder(id); err != nil {
+		return err
+	}
+	return paper.Save()
+}
@@ -0,0 +1,246 @@
+package paper_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MitchK/autorobin/lib/broker"
+	"github.com/MitchK/autorobin/lib/broker/paper"
+	"github.com/MitchK/autorobin/lib/model"
+	"github.com/onsi/gomega"
+)
+
+var (
+	initialCash = 10000.0
+	aapl        = model.Asset{
+		Symbol: "AAPL",
+	}
+	googl = model.Asset{
+		Symbol: "GOOGL",
+	}
+	vti = model.Asset{
+		Symbol: "VTI",
+	}
+)
+
+// adapter Returns daily prices of the last days, counts the fetched assets
+type adapter struct {
+	prices  map[model.Asset][]float64
+	fetched []model.Asset
+}
+
+func (adapter *adapter) GetDailyAsc(from, to time.Time, assets ...model.Asset) ([][]model.Quote, error) {
+	daily := make([][]model.Quote, len(assets))
+	for i, asset := range assets {
+		prices, exists := adapter.prices[asset]
+		if !exists {
+			return nil, errors.New("unknown ticker")
+		}
+		for _, price := range prices {
+			daily[i] = append(daily[i], model.Quote{Asset: asset, Price: price})
+		}
+		adapter.fetched = append(adapter.fetched, asset)
+	}
+	return daily, nil
+}
+
+func TestNewBroker(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	path := filepath.Join(t.TempDir(), "paper.json")
+
+	// New account starts with the initial cash
+	account, err := paper.NewBroker(paper.Config{
+		Path:   path,
+		Cash:   initialCash,
+		Prices: []model.Quote{{Asset: googl, Price: 100}, {Asset: aapl, Price: 50}},
+	})
+	g.Expect(err).To(gomega.BeNil())
+	errs := account.Execute(model.Order{
+		Asset:    googl,
+		Quantity: 10,
+		Price:    100,
+		Type:     model.OrderTypeBuy,
+	})
+	g.Expect(errs).To(gomega.BeEmpty())
+	open, err := account.Submit(model.Order{
+		Asset:    googl,
+		Quantity: 4,
+		Price:    120,
+		Type:     model.OrderTypeSell,
+	})
+	g.Expect(err).To(gomega.BeNil())
+
+	// Positions, open orders and quotes are restored, the initial cash only applies to new accounts
+	account, err = paper.NewBroker(paper.Config{
+		Path:   path,
+		Cash:   500,
+		Prices: []model.Quote{{Asset: aapl, Price: 55}},
+	})
+	g.Expect(err).To(gomega.BeNil())
+	cash, err := account.GetAvailableCash()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(cash).To(gomega.BeNumerically("~", initialCash-1000))
+	positions, err := account.GetPositions(googl)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(positions[0].Quantity).To(gomega.BeNumerically("~", 10))
+	g.Expect(positions[0].Lots).To(gomega.HaveLen(1))
+	quotes, err := account.GetQuotes(googl, aapl)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(quotes[0].Price).To(gomega.Equal(100.0))
+	g.Expect(quotes[1].Price).To(gomega.Equal(55.0))
+	orders, err := account.GetOpenOrders()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(orders).To(gomega.HaveLen(1))
+	g.Expect(orders[0].ID).To(gomega.Equal(open.ID))
+
+	// Shares held for the open sell are restored
+	errs = account.Execute(model.Order{
+		Asset:    googl,
+		Quantity: 7,
+		Price:    100,
+		Type:     model.OrderTypeSell,
+	})
+	g.Expect(errs).To(gomega.HaveLen(1))
+
+	// Open orders are filled once new prices reach their limit
+	account, err = paper.NewBroker(paper.Config{
+		Path:   path,
+		Prices: []model.Quote{{Asset: googl, Price: 121}},
+	})
+	g.Expect(err).To(gomega.BeNil())
+	order, err := account.GetOrder(open.ID)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(order.Status).To(gomega.Equal(model.OrderStatusFilled))
+
+	// Cancelled orders are stored
+	open, err = account.Submit(model.Order{
+		Asset:    googl,
+		Quantity: 1,
+		Price:    150,
+		Type:     model.OrderTypeSell,
+	})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(account.CancelOrder(open.ID)).To(gomega.Succeed())
+	account, err = paper.NewBroker(paper.Config{Path: path})
+	g.Expect(err).To(gomega.BeNil())
+	orders, err = account.GetOpenOrders()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(orders).To(gomega.BeEmpty())
+}
+
+func TestData(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	path := filepath.Join(t.TempDir(), "paper.json")
+	data := &adapter{
+		prices: map[model.Asset][]float64{
+			googl: {98, 99},
+			vti:   {200, 201},
+		},
+	}
+	account, err := paper.NewBroker(paper.Config{
+		Path:   path,
+		Cash:   initialCash,
+		Prices: []model.Quote{{Asset: aapl, Price: 50}},
+		Data:   data,
+	})
+	g.Expect(err).To(gomega.BeNil())
+
+	// should use the latest close of assets without a given price, once per run
+	portfolio, err := account.GetPortfolio(aapl, googl, vti)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(portfolio.Prices).To(gomega.Equal(model.Prices{aapl: 50, googl: 99, vti: 201}))
+	_, err = account.GetQuotes(googl, vti)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(data.fetched).To(gomega.Equal([]model.Asset{googl, vti}))
+
+	// should report assets the provider does not know
+	_, err = account.GetQuotes(model.Asset{Symbol: "XYZ"})
+	g.Expect(err).NotTo(gomega.BeNil())
+
+	// should keep the fetched prices for runs without provider
+	account, err = paper.NewBroker(paper.Config{Path: path})
+	g.Expect(err).To(gomega.BeNil())
+	quotes, err := account.GetQuotes(vti)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(quotes[0].Price).To(gomega.Equal(201.0))
+}
+
+func TestDepositWithdrawReset(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	path := filepath.Join(t.TempDir(), "paper.json")
+	account, err := paper.NewBroker(paper.Config{
+		Path:   path,
+		Cash:   initialCash,
+		Prices: []model.Quote{{Asset: googl, Price: 100}},
+	})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(account.Execute(model.Order{
+		Asset:    googl,
+		Quantity: 10,
+		Price:    100,
+		Type:     model.OrderTypeBuy,
+	})).To(gomega.BeEmpty())
+
+	// Deposits and withdrawals are stored
+	g.Expect(account.Deposit(500)).To(gomega.Succeed())
+	g.Expect(account.Withdraw(2000)).To(gomega.Succeed())
+	g.Expect(account.Withdraw(initialCash)).NotTo(gomega.Succeed())
+	g.Expect(account.Deposit(-1)).NotTo(gomega.Succeed())
+	account, err = paper.NewBroker(paper.Config{Path: path})
+	g.Expect(err).To(gomega.BeNil())
+	cash, err := account.GetAvailableCash()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(cash).To(gomega.BeNumerically("~", initialCash-1000+500-2000))
+
+	// Reset starts a new account with the initial cash and keeps the quotes
+	account, err = paper.NewBroker(paper.Config{Path: path, Cash: 2000})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(account.Reset()).To(gomega.Succeed())
+	account, err = paper.NewBroker(paper.Config{Path: path})
+	g.Expect(err).To(gomega.BeNil())
+	cash, err = account.GetAvailableCash()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(cash).To(gomega.Equal(2000.0))
+	positions, err := account.GetPositions(googl)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(positions[0].Quantity).To(gomega.Equal(0.0))
+	quotes, err := account.GetQuotes(googl)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(quotes[0].Price).To(gomega.Equal(100.0))
+}
+
+func TestRegistration(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	path := filepath.Join(t.TempDir(), "paper.json")
+
+	// Prices are parsed from the config, they take precedence over the price file
+	account, err := broker.New("paper", broker.Config{
+		"state":      path,
+		"cash":       "1000",
+		"prices":     "GOOGL=101, VTI=200",
+		"price-file": filepath.Join("fixtures", "prices.csv"),
+	}, nil)
+	g.Expect(err).To(gomega.BeNil())
+	cash, err := account.GetAvailableCash()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(cash).To(gomega.Equal(1000.0))
+	quotes, err := account.GetQuotes(googl, aapl, vti)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(quotes[0].Price).To(gomega.Equal(101.0))
+	g.Expect(quotes[1].Price).To(gomega.Equal(50.5))
+	g.Expect(quotes[2].Price).To(gomega.Equal(200.0))
+
+	// Invalid prices and providers are rejected
+	_, err = broker.New("paper", broker.Config{"state": path, "prices": "GOOGL"}, nil)
+	g.Expect(err).NotTo(gomega.BeNil())
+	_, err = broker.New("paper", broker.Config{"state": path, "prices": "GOOGL=-1"}, nil)
+	g.Expect(err).NotTo(gomega.BeNil())
+	_, err = broker.New("paper", broker.Config{"state": path, "data": "yahoo"}, nil)
+	g.Expect(err).NotTo(gomega.BeNil())
+}
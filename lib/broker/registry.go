@@ -0,0 +1,149 @@
+package broker
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/MitchK/autorobin/lib/logging"
+)
+
+// Setting Config setting of a broker, e.g. a username or an API key
+type Setting struct {
+	Name  string
+	Usage string
+
+	// Alias Short name of the setting, e.g. a one-letter command line flag
+	Alias string
+
+	// Default Value of the setting if it is not configured
+	Default string
+
+	Required bool
+
+	// Secret The value must not be shown, e.g. passwords and API keys
+	Secret bool
+}
+
+// Config Config of a broker as values by setting name
+type Config map[string]string
+
+// Bool Returns a setting as bool, false if it is not set
+func (config Config) Bool(name string) (bool, error) {
+	if config[name] == "" {
+		return false, nil
+	}
+	value, err := strconv.ParseBool(config[name])
+	if err != nil {
+		return false, fmt.Errorf("invalid value %q of %s: expected true or false", config[name], name)
+	}
+	return value, nil
+}
+
+// Float Returns a setting as float, 0 if it is not set
+func (config Config) Float(name string) (float64, error) {
+	if config[name] == "" {
+		return 0, nil
+	}
+	value, err := strconv.ParseFloat(config[name], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q of %s: expected a number", config[name], name)
+	}
+	return value, nil
+}
+
+// Constructor Creates a broker from a complete config, the logger is never nil
+type Constructor func(config Config, logger *slog.Logger) (Broker, error)
+
+// Registration Name, config schema and constructor of a broker implementation
+type Registration struct {
+	Name        string
+	Description string
+	Settings    []Setting
+	New         Constructor
+}
+
+var (
+	registryMutex sync.RWMutex
+	registry      = map[string]Registration{}
+)
+
+// Register Makes a broker implementation available by its name, usually from the init function of its package.
+// It panics if the name is registered twice.
+func Register(registration Registration) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	if registration.New == nil {
+		panic("broker: no constructor for " + registration.Name)
+	}
+	if _, exists := registry[registration.Name]; exists {
+		panic("broker: " + registration.Name + " is registered twice")
+	}
+	registry[registration.Name] = registration
+}
+
+// Registrations Returns all registered broker implementations, sorted by name
+func Registrations() []Registration {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	registrations := []Registration{}
+	for _, registration := range registry {
+		registrations = append(registrations, registration)
+	}
+	sort.Slice(registrations, func(i, j int) bool {
+		return registrations[i].Name < registrations[j].Name
+	})
+	return registrations
+}
+
+// Lookup Returns the registration of a broker implementation
+func Lookup(name string) (Registration, error) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	registration, exists := registry[name]
+	if !exists {
+		return Registration{}, fmt.Errorf("unknown broker: %s", name)
+	}
+	return registration, nil
+}
+
+// New Creates a broker of a registered implementation. Missing settings are set to their defaults,
+// unknown settings and missing required ones are rejected. The broker is silent if logger is nil.
+func New(name string, config Config, logger *slog.Logger) (Broker, error) {
+	registration, err := Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	complete, err := registration.Complete(config)
+	if err != nil {
+		return nil, err
+	}
+	return registration.New(complete, logging.Or(logger))
+}
+
+// Complete Returns a copy of the config with the defaults of missing settings. It fails for unknown settings and missing required ones.
+func (registration Registration) Complete(config Config) (Config, error) {
+	known := map[string]bool{}
+	complete := Config{}
+	for _, setting := range registration.Settings {
+		known[setting.Name] = true
+		value := config[setting.Name]
+		if value == "" {
+			value = setting.Default
+		}
+		if value == "" && setting.Required {
+			return nil, fmt.Errorf("no %s %s provided", registration.Name, setting.Name)
+		}
+		if value != "" {
+			complete[setting.Name] = value
+		}
+	}
+	for name := range config {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown setting of broker %s: %s", registration.Name, name)
+		}
+	}
+	return complete, nil
+}
@@ -0,0 +1,74 @@
+package broker_test
+
+import (
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/MitchK/autorobin/lib/broker"
+	"github.com/onsi/gomega"
+)
+
+func TestRegistry(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	var created broker.Config
+	broker.Register(broker.Registration{
+		Name: "test",
+		Settings: []broker.Setting{
+			{Name: "key", Required: true},
+			{Name: "url", Default: "https://example.com"},
+			{Name: "account"},
+		},
+		New: func(config broker.Config, logger *slog.Logger) (broker.Broker, error) {
+			created = config
+			return nil, errors.New("not connected")
+		},
+	})
+
+	// should be listed and found by name
+	names := []string{}
+	for _, registration := range broker.Registrations() {
+		names = append(names, registration.Name)
+	}
+	g.Expect(names).To(gomega.ContainElement("test"))
+	_, err := broker.Lookup("test")
+	g.Expect(err).To(gomega.BeNil())
+	_, err = broker.Lookup("unknown")
+	g.Expect(err).NotTo(gomega.BeNil())
+
+	// should pass the config with defaults to the constructor
+	_, err = broker.New("test", broker.Config{"key": "secret"}, nil)
+	g.Expect(err).To(gomega.MatchError("not connected"))
+	g.Expect(created).To(gomega.Equal(broker.Config{"key": "secret", "url": "https://example.com"}))
+
+	// should reject missing required and unknown settings
+	_, err = broker.New("test", broker.Config{}, nil)
+	g.Expect(err).To(gomega.MatchError("no test key provided"))
+	_, err = broker.New("test", broker.Config{"key": "secret", "username": "me"}, nil)
+	g.Expect(err).To(gomega.MatchError("unknown setting of broker test: username"))
+
+	// should not register a name twice
+	g.Expect(func() {
+		broker.Register(broker.Registration{Name: "test", New: func(broker.Config, *slog.Logger) (broker.Broker, error) { return nil, nil }})
+	}).To(gomega.Panic())
+}
+
+func TestConfig(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	config := broker.Config{"paper": "true", "cash": "100.5", "invalid": "yes please"}
+	paper, err := config.Bool("paper")
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(paper).To(gomega.BeTrue())
+	cash, err := config.Float("cash")
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(cash).To(gomega.Equal(100.5))
+	missing, err := config.Bool("missing")
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(missing).To(gomega.BeFalse())
+	_, err = config.Bool("invalid")
+	g.Expect(err).NotTo(gomega.BeNil())
+	_, err = config.Float("invalid")
+	g.Expect(err).NotTo(gomega.BeNil())
+}
@@ -0,0 +1,139 @@
+package replay
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+// originalHost Header that carries the host of a request that was rewritten to the server
+const originalHost = "X-Original-Host"
+
+// Recording Recorded response of a broker API. A request matches if method and path are equal
+// and its query contains the recorded query parameters. The first matching recording is replayed.
+type Recording struct {
+	Method string            `json:"method"`
+	Path   string            `json:"path"`
+	Query  map[string]string `json:"query"`
+	Status int               `json:"status"`
+	Body   json.RawMessage   `json:"body"`
+
+	// Once The recording is only replayed for the first matching request, e.g. a snapshot without market data
+	Once bool `json:"once"`
+}
+
+// Request Request received by the server
+type Request struct {
+	Method string
+
+	// Host Host the request was sent to before it was rewritten to the server, empty if it was sent to the server directly
+	Host   string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+}
+
+// Server Replays recorded responses and records the requests it receives
+type Server struct {
+	*httptest.Server
+
+	mutex    sync.Mutex
+	requests []Request
+}
+
+// NewServer Starts a server with the recordings of a JSON file, it is closed when the test ends
+func NewServer(t *testing.T, path string) *Server {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordings := []Recording{}
+	if err := json.Unmarshal(buf, &recordings); err != nil {
+		t.Fatal(err)
+	}
+
+	server := &Server{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		host := r.Header.Get(originalHost)
+		r.Header.Del(originalHost)
+		server.mutex.Lock()
+		defer server.mutex.Unlock()
+		server.requests = append(server.requests, Request{
+			Method: r.Method,
+			Host:   host,
+			Path:   r.URL.Path,
+			Query:  r.URL.Query(),
+			Header: r.Header,
+			Body:   body,
+		})
+
+		for i, recording := range recordings {
+			if matches(recording, r) {
+				if recording.Once {
+					recordings = append(recordings[:i:i], recordings[i+1:]...)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(recording.Status)
+				w.Write(recording.Body)
+				return
+			}
+		}
+		t.Errorf("no recording for %s %s", r.Method, r.URL)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func matches(recording Recording, r *http.Request) bool {
+	if recording.Method != r.Method || recording.Path != r.URL.Path {
+		return false
+	}
+	query := r.URL.Query()
+	for key, value := range recording.Query {
+		if query.Get(key) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Requests Returns the requests received so far
+func (server *Server) Requests() []Request {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return append([]Request{}, server.requests...)
+}
+
+// Client Returns a client that sends every request to the server, whatever its host.
+// The original host is kept, e.g. to check which endpoint was selected.
+func (server *Server) Client() *http.Client {
+	target, _ := url.Parse(server.URL)
+	return &http.Client{
+		Transport: rewrite{
+			target: target,
+		},
+	}
+}
+
+type rewrite struct {
+	target *url.URL
+}
+
+func (rewrite rewrite) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set(originalHost, r.URL.Host)
+	r.URL.Scheme = rewrite.target.Scheme
+	r.URL.Host = rewrite.target.Host
+	r.Host = rewrite.target.Host
+	return http.DefaultTransport.RoundTrip(r)
+}
@@ -0,0 +1,325 @@
+package robinhood
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/MitchK/autorobin/lib/credentials"
+	robinhood "github.com/andrewstuart/go-robinhood"
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// Service Service of the Robinhood passwords in a credentials store
+	Service = "robinhood"
+
+	// maxVerifications Codes that are asked for during one login before it is given up
+	maxVerifications = 3
+)
+
+// session Token and device of a login that are cached between runs. The device is trusted once it was verified,
+// so later logins need no verification.
+type session struct {
+	DeviceToken string        `json:"device_token"`
+	Token       *oauth2.Token `json:"token"`
+}
+
+// login Password login of the API. The login of the client library always uses the default HTTP client and endpoint,
+// and supports neither refresh tokens nor verification codes.
+type login struct {
+	logger      *slog.Logger
+	username    string
+	password    string
+	credentials credentials.Store
+	prompt      func(message string) (string, error)
+	cache       string
+	client      *http.Client
+
+	session session
+}
+
+// loadSession Loads the session of the cache file, a new session with a new device if there is none
+func (login *login) loadSession() error {
+	login.session = session{}
+	if login.cache != "" {
+		buf, err := ioutil.ReadFile(login.cache)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err == nil {
+			if err := json.Unmarshal(buf, &login.session); err != nil {
+				return fmt.Errorf("invalid token cache %s: %v", login.cache, err)
+			}
+		}
+	}
+	if login.session.DeviceToken == "" {
+		login.session.DeviceToken = uuid.New().String()
+	}
+	return nil
+}
+
+func (login *login) saveSession() error {
+	if login.cache == "" {
+		return nil
+	}
+	buf, err := json.Marshal(login.session)
+	if err != nil {
+		return err
+	}
+	if err := credentials.WriteFile(login.cache, buf); err != nil {
+		return fmt.Errorf("could not cache token: %v", err)
+	}
+	return nil
+}
+
+// Token Returns the cached token while it is valid, refreshes it once it expired and logs in with the password
+// if it cannot be refreshed
+func (login *login) Token() (*oauth2.Token, error) {
+	if login.session.Token.Valid() {
+		login.logger.Debug("using cached token", "username", login.username)
+		return login.session.Token, nil
+	}
+	var token *oauth2.Token
+	var err error
+	if login.session.Token != nil && login.session.Token.RefreshToken != "" {
+		token, err = login.refresh(login.session.Token.RefreshToken)
+		if err != nil {
+			login.logger.Warn("could not refresh token, logging in with password", "username", login.username, "error", err)
+		} else {
+			login.logger.Info("refreshed token", "username", login.username)
+		}
+	}
+	if token == nil {
+		token, err = login.passwordLogin()
+		if err == nil {
+			login.logger.Info("logged in", "username", login.username)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	login.session.Token = token
+	return token, login.saveSession()
+}
+
+// refresh Returns a new token for a refresh token
+func (login *login) refresh(refreshToken string) (*oauth2.Token, error) {
+	form := url.Values{}
+	form.Set("refresh_token", refreshToken)
+	response, err := login.post("refresh_token", form, nil)
+	if err != nil {
+		return nil, err
+	}
+	if response.token == nil {
+		return nil, fmt.Errorf("could not refresh token: %s", response.detail())
+	}
+	return response.token, nil
+}
+
+// getPassword Returns the given password, the stored one or asks for it
+func (login *login) getPassword() (string, error) {
+	if login.password != "" {
+		return login.password, nil
+	}
+	if login.credentials != nil {
+		password, err := login.credentials.Get(Service, login.username)
+		if err == nil {
+			return password, nil
+		}
+		if err != credentials.ErrNotFound {
+			return "", err
+		}
+	}
+	if login.prompt != nil {
+		password, err := login.prompt(fmt.Sprintf("Robinhood password of %s", login.username))
+		if err == nil && password != "" {
+			return password, nil
+		}
+	}
+	return "", errors.New("no Robinhood password provided")
+}
+
+// ask Asks for a verification code
+func (login *login) ask(message string) (string, error) {
+	if login.prompt == nil {
+		return "", errors.New("could not log in: Robinhood asks for a verification code, log in interactively once to verify the device")
+	}
+	code, err := login.prompt(message)
+	if err != nil {
+		return "", fmt.Errorf("could not log in: %v", err)
+	}
+	return strings.TrimSpace(code), nil
+}
+
+// passwordLogin Logs in with the password and answers MFA and device challenges with codes that are asked for
+func (login *login) passwordLogin() (*oauth2.Token, error) {
+	if login.username == "" {
+		return nil, errors.New("no Robinhood username provided")
+	}
+	password, err := login.getPassword()
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("username", login.username)
+	form.Set("password", password)
+	form.Set("device_token", login.session.DeviceToken)
+	form.Set("challenge_type", "sms")
+	header := http.Header{}
+
+	for verifications := 0; ; verifications++ {
+		response, err := login.post("password", form, header)
+		if err != nil {
+			return nil, err
+		}
+		if response.token != nil {
+			return response.token, nil
+		}
+		if verifications == maxVerifications || (!response.MFARequired && response.Challenge == nil) {
+			return nil, fmt.Errorf("could not log in: %s", response.detail())
+		}
+
+		login.logger.Info("verification required", "username", login.username, "mfa", response.MFARequired)
+		if response.MFARequired {
+			code, err := login.ask(fmt.Sprintf("Robinhood MFA code (%s)", response.MFAType))
+			if err != nil {
+				return nil, err
+			}
+			form.Set("mfa_code", code)
+			continue
+		}
+
+		// device challenge, answered once and then referenced by the login
+		code, err := login.ask(fmt.Sprintf("Robinhood verification code (%s)", response.Challenge.Type))
+		if err != nil {
+			return nil, err
+		}
+		if err := login.respond(response.Challenge.ID, code); err != nil {
+			return nil, err
+		}
+		header.Set("X-Robinhood-Challenge-Response-ID", response.Challenge.ID)
+	}
+}
+
+// loginResponse Response of the token endpoint
+type loginResponse struct {
+	oauth2.Token
+	ExpiresIn   int    `json:"expires_in"`
+	Detail      string `json:"detail"`
+	MFARequired bool   `json:"mfa_required"`
+	MFAType     string `json:"mfa_type"`
+	Challenge   *struct {
+		ID     string `json:"id"`
+		Type   string `json:"type"`
+		Status string `json:"status"`
+	} `json:"challenge"`
+
+	status string
+
+	// token Token of a successful login, nil otherwise
+	token *oauth2.Token
+}
+
+func (response loginResponse) detail() string {
+	if response.Detail != "" {
+		return response.Detail
+	}
+	return response.status
+}
+
+// post Posts a form to the token endpoint
+func (login *login) post(grantType string, form url.Values, header http.Header) (loginResponse, error) {
+	query := url.Values{}
+	query.Set("expires_in", fmt.Sprint(int64(24*time.Hour/time.Second)))
+	query.Set("client_id", robinhood.DefaultClientID)
+	query.Set("grant_type", grantType)
+	query.Set("scope", "internal")
+
+	req, err := http.NewRequest(http.MethodPost, robinhood.EPLogin+"?"+query.Encode(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return loginResponse{}, err
+	}
+	for key := range header {
+		req.Header.Set(key, header.Get(key))
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	res, err := login.client.Do(req)
+	if err != nil {
+		return loginResponse{}, fmt.Errorf("could not log in: %v", err)
+	}
+	defer res.Body.Close()
+	buf, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return loginResponse{}, fmt.Errorf("could not log in: %v", err)
+	}
+
+	response := loginResponse{}
+	if err := json.Unmarshal(buf, &response); err != nil {
+		return loginResponse{}, fmt.Errorf("could not log in: %s", res.Status)
+	}
+	response.status = res.Status
+	if res.StatusCode == http.StatusOK && response.AccessToken != "" {
+		token := response.Token
+		token.Expiry = time.Now().Add(time.Duration(response.ExpiresIn) * time.Second)
+		response.token = &token
+	}
+	return response, nil
+}
+
+// respond Answers a device challenge with a code
+func (login *login) respond(id string, code string) error {
+	body := strings.NewReader(url.Values{"response": {code}}.Encode())
+	req, err := http.NewRequest(http.MethodPost, robinhood.EPBase+"challenge/"+url.PathEscape(id)+"/respond/", body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	res, err := login.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not verify device: %v", err)
+	}
+	defer res.Body.Close()
+	var response struct {
+		Status string `json:"status"`
+		Detail string `json:"detail"`
+	}
+	json.NewDecoder(res.Body).Decode(&response)
+	if res.StatusCode != http.StatusOK || response.Status != "validated" {
+		if response.Detail != "" {
+			return fmt.Errorf("could not verify device: %s", response.Detail)
+		}
+		return fmt.Errorf("could not verify device: %s", res.Status)
+	}
+	return nil
+}
+
+// rewrite Sends the requests to the API to another base URL
+type rewrite struct {
+	base      *url.URL
+	transport http.RoundTripper
+}
+
+// RoundTrip RoundTrip
+func (rewrite rewrite) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !strings.HasPrefix(req.URL.String(), robinhood.EPBase) {
+		return rewrite.transport.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.URL.Scheme = rewrite.base.Scheme
+	req.URL.Host = rewrite.base.Host
+	req.URL.Path = strings.TrimSuffix(rewrite.base.Path, "/") + req.URL.Path
+	req.URL.RawPath = ""
+	req.Host = ""
+	return rewrite.transport.RoundTrip(req)
+}
@@ -0,0 +1,194 @@
+package robinhood_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MitchK/autorobin/lib/broker/replay"
+	"github.com/MitchK/autorobin/lib/broker/robinhood"
+	"github.com/MitchK/autorobin/lib/credentials"
+	"github.com/onsi/gomega"
+)
+
+// logins Returns the requests to the token endpoint
+func logins(server *replay.Server) []replay.Request {
+	requests := []replay.Request{}
+	for _, request := range server.Requests() {
+		if request.Path == "/oauth2/token/" {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+// prompt Answers with the given answers in order and records the messages
+type prompt struct {
+	answers  []string
+	messages []string
+}
+
+func (prompt *prompt) ask(message string) (string, error) {
+	prompt.messages = append(prompt.messages, message)
+	if len(prompt.messages) > len(prompt.answers) {
+		return "", errors.New("no answer")
+	}
+	return prompt.answers[len(prompt.messages)-1], nil
+}
+
+// passwords Store of one password
+type passwords map[string]string
+
+func (passwords passwords) Get(service string, user string) (string, error) {
+	password, exists := passwords[service+"/"+user]
+	if !exists {
+		return "", credentials.ErrNotFound
+	}
+	return password, nil
+}
+
+func (passwords passwords) Set(service string, user string, secret string) error {
+	passwords[service+"/"+user] = secret
+	return nil
+}
+
+func TestTokenCache(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	cache := filepath.Join(t.TempDir(), "robinhood.json")
+	server := replay.NewServer(t, recordings)
+	config := robinhood.Config{
+		Username:   "me@example.com",
+		Password:   "secret",
+		BaseURL:    server.URL,
+		TokenCache: cache,
+	}
+
+	// should cache the token and the device of the login
+	_, err := robinhood.NewConfigBroker(config)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(logins(server)).To(gomega.HaveLen(1))
+	form, err := url.ParseQuery(string(logins(server)[0].Body))
+	g.Expect(err).To(gomega.BeNil())
+	device := form.Get("device_token")
+	g.Expect(device).NotTo(gomega.BeEmpty())
+	buf, err := ioutil.ReadFile(cache)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(string(buf)).NotTo(gomega.ContainSubstring("secret"))
+
+	// should reuse a valid token without password
+	config.Password = ""
+	_, err = robinhood.NewConfigBroker(config)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(logins(server)).To(gomega.HaveLen(1))
+
+	// should refresh an expired token without password
+	var session struct {
+		DeviceToken string                 `json:"device_token"`
+		Token       map[string]interface{} `json:"token"`
+	}
+	g.Expect(json.Unmarshal(buf, &session)).To(gomega.Succeed())
+	session.Token["expiry"] = time.Now().Add(-time.Hour)
+	buf, err = json.Marshal(session)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(ioutil.WriteFile(cache, buf, 0600)).To(gomega.Succeed())
+	_, err = robinhood.NewConfigBroker(config)
+	g.Expect(err).To(gomega.BeNil())
+	requests := logins(server)
+	g.Expect(requests).To(gomega.HaveLen(2))
+	g.Expect(requests[1].Query.Get("grant_type")).To(gomega.Equal("refresh_token"))
+	form, err = url.ParseQuery(string(requests[1].Body))
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(form.Get("refresh_token")).To(gomega.Equal("3Yb8Zq0f1cY2sB5oVbW6uN9eRk4tLm"))
+
+	// should keep the device for later logins
+	buf, err = ioutil.ReadFile(cache)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(string(buf)).To(gomega.ContainSubstring(device))
+}
+
+func TestPassword(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	server := replay.NewServer(t, recordings)
+
+	// should read the password from the store
+	_, err := robinhood.NewConfigBroker(robinhood.Config{
+		Username:    "me@example.com",
+		Credentials: passwords{"robinhood/me@example.com": "stored"},
+		BaseURL:     server.URL,
+	})
+	g.Expect(err).To(gomega.BeNil())
+	form, err := url.ParseQuery(string(logins(server)[0].Body))
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(form.Get("password")).To(gomega.Equal("stored"))
+
+	// should ask for the password if it is not stored
+	ask := &prompt{answers: []string{"asked"}}
+	_, err = robinhood.NewConfigBroker(robinhood.Config{
+		Username:    "me@example.com",
+		Credentials: passwords{},
+		Prompt:      ask.ask,
+		BaseURL:     server.URL,
+	})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(ask.messages).To(gomega.Equal([]string{"Robinhood password of me@example.com"}))
+	form, err = url.ParseQuery(string(logins(server)[1].Body))
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(form.Get("password")).To(gomega.Equal("asked"))
+}
+
+func TestVerification(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	// should send the MFA code
+	server := replay.NewServer(t, filepath.Join("fixtures", "mfa.json"))
+	ask := &prompt{answers: []string{"123456"}}
+	_, err := robinhood.NewConfigBroker(robinhood.Config{
+		Username: "me@example.com",
+		Password: "secret",
+		Prompt:   ask.ask,
+		BaseURL:  server.URL,
+	})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(ask.messages).To(gomega.Equal([]string{"Robinhood MFA code (app)"}))
+	requests := logins(server)
+	g.Expect(requests).To(gomega.HaveLen(2))
+	form, err := url.ParseQuery(string(requests[1].Body))
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(form.Get("mfa_code")).To(gomega.Equal("123456"))
+
+	// should answer the device challenge and log in with its ID
+	server = replay.NewServer(t, filepath.Join("fixtures", "challenge.json"))
+	ask = &prompt{answers: []string{"654321"}}
+	_, err = robinhood.NewConfigBroker(robinhood.Config{
+		Username: "me@example.com",
+		Password: "secret",
+		Prompt:   ask.ask,
+		BaseURL:  server.URL,
+	})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(ask.messages).To(gomega.Equal([]string{"Robinhood verification code (sms)"}))
+	requests = server.Requests()
+	g.Expect(requests[1].Method).To(gomega.Equal(http.MethodPost))
+	g.Expect(requests[1].Path).To(gomega.Equal("/challenge/4d2f7a1c-9b8e-4c3d-a2f1-0e9d8c7b6a55/respond/"))
+	form, err = url.ParseQuery(string(requests[1].Body))
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(form.Get("response")).To(gomega.Equal("654321"))
+	g.Expect(requests[2].Header.Get("X-Robinhood-Challenge-Response-ID")).To(gomega.Equal("4d2f7a1c-9b8e-4c3d-a2f1-0e9d8c7b6a55"))
+
+	// should fail without prompt, e.g. in scheduled runs
+	server = replay.NewServer(t, filepath.Join("fixtures", "mfa.json"))
+	_, err = robinhood.NewConfigBroker(robinhood.Config{
+		Username: "me@example.com",
+		Password: "secret",
+		BaseURL:  server.URL,
+	})
+	g.Expect(err).NotTo(gomega.BeNil())
+	g.Expect(err.Error()).To(gomega.ContainSubstring("log in interactively once"))
+}
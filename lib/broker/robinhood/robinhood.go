@@ -3,29 +3,195 @@ package robinhood
 import (
 	"errors"
 	"fmt"
+	"log/slog"
 	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/MitchK/autorobin/lib/broker"
+	"github.com/MitchK/autorobin/lib/credentials"
+	"github.com/MitchK/autorobin/lib/logging"
 	"github.com/MitchK/autorobin/lib/model"
 	robinhood "github.com/andrewstuart/go-robinhood"
+	"golang.org/x/oauth2"
 )
 
 // robinhoodBroker robinhoodBroker
 type robinhoodBroker struct {
 	client *robinhood.Client
+	logger *slog.Logger
+
+	// accountNumber Account to trade with, the first account of the login if empty
+	accountNumber string
+}
+
+// Config Config
+type Config struct {
+	Username string
+
+	// Password Password of the login, it is read from Credentials or asked for with Prompt if it is empty.
+	// It is only needed if there is no cached token that is valid or can be refreshed.
+	Password string
+
+	// Credentials Optional store of the password by username, with service "robinhood"
+	Credentials credentials.Store
+
+	// Prompt Optionally asks for the password and for the verification codes of MFA and new devices, e.g. credentials.Prompt.
+	// Logins that need a verification code fail without it.
+	Prompt func(message string) (string, error)
+
+	// TokenCache File the token and the device of the login are cached in between runs, no caching if empty
+	TokenCache string
+
+	// AccountNumber Account to trade with, the first account of the login if empty
+	AccountNumber string
+
+	// BaseURL Replaces the API URL https://api.robinhood.com/ in all requests, e.g. for tests
+	BaseURL string
+
+	// Client HTTP client, http.DefaultClient if not set
+	Client *http.Client
+
+	// Logger Logs logins and orders, silent if not set
+	Logger *slog.Logger
+}
+
+func init() {
+	broker.Register(broker.Registration{
+		Name:        "robinhood",
+		Description: "Robinhood account",
+		Settings: []broker.Setting{
+			{Name: "username", Alias: "u", Usage: "Robinhood login username", Required: true},
+			{Name: "password", Alias: "p", Usage: "Robinhood login password, read from the credential file, the keyring or asked for if not set", Secret: true},
+			{Name: "account", Usage: "Robinhood account number, the first account of the login if not set"},
+			{Name: "credential-file", Usage: "Read the password from an encrypted credentials file (see autorobin credentials)"},
+			{Name: "credential-passphrase", Usage: "Passphrase of the credentials file, asked for if not set", Secret: true},
+			{Name: "keyring", Usage: "Read the password from the OS keyring", Default: "true"},
+			{Name: "token-cache", Usage: "Cache the session token in a file between runs, robinhood-USERNAME.json in the user config dir if not set"},
+		},
+		New: func(config broker.Config, logger *slog.Logger) (broker.Broker, error) {
+			store := credentials.Chain{}
+			if config["credential-file"] != "" {
+				message := fmt.Sprintf("Passphrase of %s", config["credential-file"])
+				store = append(store, credentials.NewFile(config["credential-file"], credentials.Passphrase(config["credential-passphrase"], message)))
+			}
+			keyring, err := config.Bool("keyring")
+			if err != nil {
+				return nil, err
+			}
+			if keyring {
+				store = append(store, credentials.NewKeyring())
+			}
+			tokenCache := config["token-cache"]
+			if tokenCache == "" {
+				tokenCache, err = DefaultTokenCache(config["username"])
+				if err != nil {
+					return nil, err
+				}
+			}
+			return NewConfigBroker(Config{
+				Username:      config["username"],
+				Password:      config["password"],
+				AccountNumber: config["account"],
+				Credentials:   store,
+				Prompt:        credentials.Prompt,
+				TokenCache:    tokenCache,
+				Logger:        logger,
+			})
+		},
+	})
+}
+
+// DefaultTokenCache Returns the token cache of a login in the config dir of the user
+func DefaultTokenCache(username string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("no token cache: %v", err)
+	}
+	return filepath.Join(dir, "autorobin", "robinhood-"+username+".json"), nil
 }
 
 // NewBroker NewBroker
 func NewBroker(username string, password string) (broker.Broker, error) {
-	var err error
-	broker := &robinhoodBroker{}
-	broker.client, err = robinhood.Dial(&robinhood.OAuth{
-		Username: username,
-		Password: password,
+	return NewAccountBroker(username, password, "")
+}
+
+// NewAccountBroker Creates a broker for one of the accounts of a login, the first account is used if accountNumber is empty
+func NewAccountBroker(username string, password string, accountNumber string) (broker.Broker, error) {
+	return NewConfigBroker(Config{
+		Username:      username,
+		Password:      password,
+		AccountNumber: accountNumber,
 	})
+}
+
+// NewConfigBroker Logs in and creates a broker for the account of the config
+func NewConfigBroker(config Config) (broker.Broker, error) {
+	client := config.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	transport := client.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	if config.BaseURL != "" {
+		base, err := url.Parse(config.BaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base URL: %v", err)
+		}
+		transport = rewrite{
+			base:      base,
+			transport: transport,
+		}
+	}
+	apiClient := &http.Client{
+		Transport: transport,
+		Timeout:   client.Timeout,
+	}
+
+	logger := logging.Or(config.Logger)
+	login := &login{
+		logger:      logger,
+		username:    config.Username,
+		password:    config.Password,
+		credentials: config.Credentials,
+		prompt:      config.Prompt,
+		cache:       config.TokenCache,
+		client:      apiClient,
+	}
+	if err := login.loadSession(); err != nil {
+		return nil, err
+	}
+	// log in right away, so that wrong credentials are reported by the constructor
+	token, err := login.Token()
 	if err != nil {
 		return nil, err
 	}
+	broker := &robinhoodBroker{
+		logger:        logger,
+		accountNumber: config.AccountNumber,
+		client: &robinhood.Client{
+			Client: &http.Client{
+				Transport: &oauth2.Transport{
+					Source: oauth2.ReuseTokenSource(token, login),
+					Base:   transport,
+				},
+				Timeout: client.Timeout,
+			},
+		},
+	}
+
+	// orders are placed for the account of the client
+	account, err := broker.getAccount()
+	if err != nil {
+		return nil, err
+	}
+	broker.client.Account = &account
 
 	return broker, nil
 }
@@ -38,7 +204,20 @@ func (broker *robinhoodBroker) getAccount() (robinhood.Account, error) {
 	if len(accounts) == 0 {
 		return robinhood.Account{}, errors.New("no account associated with login")
 	}
-	return accounts[0], nil
+	if broker.accountNumber == "" {
+		return accounts[0], nil
+	}
+	for _, account := range accounts {
+		if account.AccountNumber == broker.accountNumber {
+			return account, nil
+		}
+	}
+	return robinhood.Account{}, fmt.Errorf("account %s is not associated with login", broker.accountNumber)
+}
+
+// isOwnOrder Returns true if the order belongs to the account of the broker, the orders endpoint lists the orders of all accounts
+func (broker *robinhoodBroker) isOwnOrder(orderOutput robinhood.OrderOutput) bool {
+	return broker.client.Account == nil || orderOutput.Account == "" || orderOutput.Account == broker.client.Account.URL
 }
 
 func (broker *robinhoodBroker) getPortfolio() (robinhood.Portfolio, error) {
@@ -67,9 +246,10 @@ func (broker *robinhoodBroker) convertPosition(position robinhood.Position) (mod
 		return model.Position{}, err
 	}
 
+	// shares held for open orders are not folded in, open orders are reported by GetOpenOrders
 	return model.Position{
 		AvgBuyPrice: position.AverageBuyPrice,
-		Quantity:    position.Quantity + position.SharesHeldForBuys - position.SharesHeldForSells,
+		Quantity:    position.Quantity,
 		Asset: model.Asset{
 			Symbol: instrument.Symbol,
 		},
@@ -82,6 +262,9 @@ func (broker *robinhoodBroker) convertQuote(quote robinhood.Quote) (model.Quote,
 			Symbol: quote.Symbol,
 		},
 		Price: quote.PreviousClose,
+		Bid:   quote.BidPrice,
+		Ask:   quote.AskPrice,
+		Last:  quote.LastTradePrice,
 	}, nil
 }
 
@@ -106,8 +289,8 @@ func (broker *robinhoodBroker) GetQuotes(assets ...model.Asset) ([]model.Quote,
 	return retQuotes, nil
 }
 
-// GetPositions GetPositions
-func (broker *robinhoodBroker) GetPositions(assets ...model.Asset) ([]model.Position, error) {
+// GetAllPositions GetAllPositions
+func (broker *robinhoodBroker) GetAllPositions() ([]model.Position, error) {
 	account, err := broker.getAccount()
 	if err != nil {
 		return nil, err
@@ -116,7 +299,7 @@ func (broker *robinhoodBroker) GetPositions(assets ...model.Asset) ([]model.Posi
 	if err != nil {
 		return nil, err
 	}
-	openPositionsMap := map[model.Asset]model.Position{}
+	openPositions := []model.Position{}
 	for _, position := range positions {
 		// filter out positions that are closed (i.e. q = 0)
 		// as well as positions that were given to us for free (avgBuyPrice = 0)
@@ -125,12 +308,31 @@ func (broker *robinhoodBroker) GetPositions(assets ...model.Asset) ([]model.Posi
 			if err != nil {
 				return nil, err
 			}
-			openPositionsMap[convertedPosition.Asset] = convertedPosition
+			openPositions = append(openPositions, convertedPosition)
 		}
 	}
+	return openPositions, nil
+}
+
+// GetPositions GetPositions
+func (broker *robinhoodBroker) GetPositions(assets ...model.Asset) ([]model.Position, error) {
+	positions, err := broker.GetAllPositions()
+	if err != nil {
+		return nil, err
+	}
+	openPositionsMap := map[model.Asset]model.Position{}
+	for _, position := range positions {
+		openPositionsMap[position.Asset] = position
+	}
 	openPositions := make([]model.Position, len(assets))
 	for i, asset := range assets {
-		openPositions[i] = openPositionsMap[asset]
+		position, ok := openPositionsMap[asset]
+		if !ok {
+			position = model.Position{
+				Asset: asset,
+			}
+		}
+		openPositions[i] = position
 	}
 	return openPositions, nil
 }
@@ -186,45 +388,197 @@ func (broker *robinhoodBroker) GetPortfolio(assets ...model.Asset) (model.Portfo
 
 // Execute Execute
 func (broker *robinhoodBroker) Execute(orders ...model.Order) []error {
-	errors := []error{}
+	errs := []error{}
 	for _, order := range orders {
-		orderStr := fmt.Sprintf("order of %v x %s @ %v (%s)", order.Quantity, order.Asset.Symbol, order.Price, order.Description)
 		if order.Quantity < 1 {
-			fmt.Println("cannot execute", orderStr, ": robinhood does not support quantities less than 1, skipping order...")
+			broker.logger.Warn("skipping order, robinhood does not support quantities less than 1", logging.Order(order)...)
 			continue
 		}
-		fmt.Println("executing", orderStr, "...")
-		instr, err := broker.client.GetInstrumentForSymbol(order.Asset.Symbol)
+		orderOutput, err := broker.placeOrder(order)
 		if err != nil {
-			errors = append(errors, err)
+			errs = append(errs, err)
 			continue
 		}
-
-		var orderSide robinhood.OrderSide
-		if order.Type == model.OrderTypeBuy {
-			orderSide = robinhood.Buy
-		} else if order.Type == model.OrderTypeSell {
-			orderSide = robinhood.Sell
-		} else {
-			errors = append(errors, fmt.Errorf("invalid order type: %v", order.Type))
+		if orderOutput.State != "confirmed" && orderOutput.State != "unconfirmed" {
+			errs = append(errs, fmt.Errorf("some issue with order, state: %s, reject reason: %s", orderOutput.State, orderOutput.RejectReason))
 			continue
 		}
+		order.ID = orderOutput.ID
+		broker.logger.Info("order submitted", logging.Order(order)...)
+	}
+	return errs
+}
 
-		orderOpts := robinhood.OrderOpts{
-			Side:     orderSide,
-			Type:     robinhood.Limit,
-			Price:    math.Round(order.Price*100) / 100, // round to nearest
-			Quantity: uint64(order.Quantity),
+func (broker *robinhoodBroker) placeOrder(order model.Order) (*robinhood.OrderOutput, error) {
+	instr, err := broker.client.GetInstrumentForSymbol(order.Asset.Symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	var orderSide robinhood.OrderSide
+	if order.Type == model.OrderTypeBuy {
+		orderSide = robinhood.Buy
+	} else if order.Type == model.OrderTypeSell {
+		orderSide = robinhood.Sell
+	} else {
+		return nil, fmt.Errorf("invalid order type: %v", order.Type)
+	}
+
+	orderOpts := robinhood.OrderOpts{
+		Side:     orderSide,
+		Type:     robinhood.Limit,
+		Price:    math.Round(order.Price*100) / 100, // round to nearest
+		Quantity: uint64(order.Quantity),
+	}
+	return broker.client.Order(instr, orderOpts)
+}
+
+func (broker *robinhoodBroker) convertOrder(orderOutput robinhood.OrderOutput) (model.Order, error) {
+	instrument, err := broker.client.GetInstrument(orderOutput.Instrument)
+	if err != nil {
+		return model.Order{}, err
+	}
+	quantity, err := strconv.ParseFloat(orderOutput.Quantity, 64)
+	if err != nil {
+		return model.Order{}, err
+	}
+	var filledQuantity float64
+	if orderOutput.CumulativeQuantity != "" {
+		filledQuantity, err = strconv.ParseFloat(orderOutput.CumulativeQuantity, 64)
+		if err != nil {
+			return model.Order{}, err
 		}
-		orderOutput, err := broker.client.Order(instr, orderOpts)
+	}
+
+	var orderType model.OrderType
+	switch orderOutput.Side {
+	case "buy":
+		orderType = model.OrderTypeBuy
+	case "sell":
+		orderType = model.OrderTypeSell
+	default:
+		return model.Order{}, fmt.Errorf("invalid order side: %s", orderOutput.Side)
+	}
+
+	var status model.OrderStatus
+	switch orderOutput.State {
+	case "queued", "unconfirmed", "confirmed", "partially_filled":
+		status = model.OrderStatusOpen
+	case "filled":
+		status = model.OrderStatusFilled
+	case "cancelled":
+		status = model.OrderStatusCancelled
+	case "rejected", "failed":
+		status = model.OrderStatusRejected
+	default:
+		return model.Order{}, fmt.Errorf("unknown order state: %s", orderOutput.State)
+	}
+
+	filledAt := orderOutput.UpdatedAt
+	if orderOutput.LastTransactionAt != "" {
+		filledAt, err = time.Parse(time.RFC3339, orderOutput.LastTransactionAt)
 		if err != nil {
-			errors = append(errors, err)
-			continue
+			return model.Order{}, err
 		}
-		if orderOutput.State != "confirmed" && orderOutput.State != "unconfirmed" {
-			errors = append(errors, fmt.Errorf("some issue with order, state: %s, reject reason: %s", orderOutput.State, orderOutput.RejectReason))
-			continue
+	}
+
+	return model.Order{
+		ID:   orderOutput.ID,
+		Type: orderType,
+		Asset: model.Asset{
+			Symbol: instrument.Symbol,
+		},
+		Price:          orderOutput.Price,
+		Quantity:       quantity,
+		Status:         status,
+		FilledQuantity: filledQuantity,
+		FilledPrice:    orderOutput.AveragePrice,
+		FilledAt:       filledAt,
+	}, nil
+}
+
+// Submit Submit
+func (broker *robinhoodBroker) Submit(order model.Order) (model.Order, error) {
+	if order.Quantity < 1 {
+		return model.Order{}, fmt.Errorf("cannot submit order of %s: robinhood does not support quantities less than 1", order.Asset.Symbol)
+	}
+	orderOutput, err := broker.placeOrder(order)
+	if err != nil {
+		return model.Order{}, err
+	}
+	submitted, err := broker.convertOrder(*orderOutput)
+	if err != nil {
+		return model.Order{}, err
+	}
+	submitted.Description = order.Description
+	broker.logger.Info("order submitted", logging.Order(submitted)...)
+	return submitted, nil
+}
+
+// GetOrder GetOrder
+func (broker *robinhoodBroker) GetOrder(id string) (model.Order, error) {
+	var orderOutput robinhood.OrderOutput
+	err := broker.client.GetAndDecode(robinhood.EPOrders+id+"/", &orderOutput)
+	if err != nil {
+		return model.Order{}, err
+	}
+	return broker.convertOrder(orderOutput)
+}
+
+// GetOpenOrders GetOpenOrders
+func (broker *robinhoodBroker) GetOpenOrders() ([]model.Order, error) {
+	return broker.listOrders(robinhood.EPOrders, func(order model.Order) bool {
+		return !order.IsDone()
+	})
+}
+
+// GetOrderHistory GetOrderHistory
+func (broker *robinhoodBroker) GetOrderHistory(since time.Time) ([]model.Order, error) {
+	endpoint := robinhood.EPOrders + "?updated_at%5Bgte%5D=" + since.UTC().Format("2006-01-02")
+	return broker.listOrders(endpoint, func(order model.Order) bool {
+		return order.FilledQuantity > 0 && !order.FilledAt.Before(since)
+	})
+}
+
+// listOrders Follows the pages of an orders endpoint and returns the orders of the account that are kept by the filter
+func (broker *robinhoodBroker) listOrders(endpoint string, keep func(model.Order) bool) ([]model.Order, error) {
+	orders := []model.Order{}
+	for endpoint != "" {
+		var page struct {
+			Results []robinhood.OrderOutput
+			Next    string
 		}
+		err := broker.client.GetAndDecode(endpoint, &page)
+		if err != nil {
+			return nil, err
+		}
+		for _, orderOutput := range page.Results {
+			if !broker.isOwnOrder(orderOutput) {
+				continue
+			}
+			order, err := broker.convertOrder(orderOutput)
+			if err != nil {
+				return nil, err
+			}
+			if keep(order) {
+				orders = append(orders, order)
+			}
+		}
+		endpoint = page.Next
+	}
+	return orders, nil
+}
+
+// CancelOrder CancelOrder
+func (broker *robinhoodBroker) CancelOrder(id string) error {
+	req, err := http.NewRequest(http.MethodPost, robinhood.EPOrders+id+"/cancel/", nil)
+	if err != nil {
+		return err
+	}
+	var response struct{}
+	if err := broker.client.DoAndDecode(req, &response); err != nil {
+		return err
 	}
+	broker.logger.Info("order cancelled", logging.KeyOrderID, id)
 	return nil
 }
@@ -0,0 +1,383 @@
+package robinhood_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MitchK/autorobin/lib/broker"
+	"github.com/MitchK/autorobin/lib/broker/replay"
+	"github.com/MitchK/autorobin/lib/broker/robinhood"
+	"github.com/MitchK/autorobin/lib/execution"
+	"github.com/MitchK/autorobin/lib/model"
+	"github.com/onsi/gomega"
+)
+
+var (
+	aapl = model.Asset{
+		Symbol: "AAPL",
+	}
+	vti = model.Asset{
+		Symbol: "VTI",
+	}
+	bnd = model.Asset{
+		Symbol: "BND",
+	}
+	assets = []model.Asset{
+		aapl, vti, bnd,
+	}
+	openID      = "5f4c6a9e-1b2d-4e8f-9a3c-7d6e5f4a3b21"
+	filledID    = "7f5c2a66-6b0e-4c1e-9a3f-6d1b7d2f0c01"
+	olderOpenID = "a7b8c9d0-e1f2-4a3b-8c4d-5e6f7a8b9c02"
+	recordings  = filepath.Join("fixtures", "recordings.json")
+)
+
+func newBroker(t *testing.T) (broker.Broker, *replay.Server) {
+	server := replay.NewServer(t, recordings)
+	broker, err := robinhood.NewConfigBroker(robinhood.Config{
+		Username: "me@example.com",
+		Password: "secret",
+		BaseURL:  server.URL + "/",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return broker, server
+}
+
+func TestNewConfigBroker(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	// should log in with the password and authorize further requests with the token
+	_, server := newBroker(t)
+	requests := server.Requests()
+	g.Expect(requests).To(gomega.HaveLen(2))
+	g.Expect(requests[0].Method).To(gomega.Equal(http.MethodPost))
+	g.Expect(requests[0].Path).To(gomega.Equal("/oauth2/token/"))
+	g.Expect(requests[0].Query.Get("grant_type")).To(gomega.Equal("password"))
+	g.Expect(requests[0].Query.Get("expires_in")).To(gomega.Equal("86400"))
+	form, err := url.ParseQuery(string(requests[0].Body))
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(form.Get("username")).To(gomega.Equal("me@example.com"))
+	g.Expect(form.Get("password")).To(gomega.Equal("secret"))
+	g.Expect(requests[1].Path).To(gomega.Equal("/accounts/"))
+	g.Expect(requests[1].Header.Get("Authorization")).To(gomega.Equal("Bearer eyJ0eXAiOiJKV1QiLCJhbGciOiJIUzI1NiJ9.test"))
+
+	// should send the requests of an injected client to the API
+	server = replay.NewServer(t, recordings)
+	_, err = robinhood.NewConfigBroker(robinhood.Config{
+		Username: "me@example.com",
+		Password: "secret",
+		Client:   server.Client(),
+	})
+	g.Expect(err).To(gomega.BeNil())
+	for _, request := range server.Requests() {
+		g.Expect(request.Host).To(gomega.Equal("api.robinhood.com"))
+	}
+
+	// should fail for accounts that do not belong to the login
+	_, err = robinhood.NewConfigBroker(robinhood.Config{
+		Username:      "me@example.com",
+		Password:      "secret",
+		AccountNumber: "5RY00000",
+		BaseURL:       server.URL,
+	})
+	g.Expect(err).NotTo(gomega.BeNil())
+
+	// should require a password
+	_, err = robinhood.NewConfigBroker(robinhood.Config{
+		Username: "me@example.com",
+		BaseURL:  server.URL,
+	})
+	g.Expect(err).NotTo(gomega.BeNil())
+}
+
+func TestGetAvailableCash(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	broker, server := newBroker(t)
+
+	// should return the unallocated cash of the first account
+	cash, err := broker.GetAvailableCash()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(cash).To(gomega.Equal(1234.56))
+
+	// should return the unallocated cash of the selected account
+	broker, err = robinhood.NewConfigBroker(robinhood.Config{
+		Username:      "me@example.com",
+		Password:      "secret",
+		AccountNumber: "5RY67890",
+		BaseURL:       server.URL,
+	})
+	g.Expect(err).To(gomega.BeNil())
+	cash, err = broker.GetAvailableCash()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(cash).To(gomega.Equal(50.0))
+}
+
+func TestGetPositions(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	broker, _ := newBroker(t)
+
+	// should skip closed and free positions and not fold in the shares held for open orders
+	positions, err := broker.GetPositions(assets...)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(positions).To(gomega.Equal([]model.Position{
+		{Asset: aapl, Quantity: 10, AvgBuyPrice: 170.25},
+		{Asset: vti, Quantity: 3, AvgBuyPrice: 210},
+		{Asset: bnd},
+	}))
+
+	// should return the open positions only
+	positions, err = broker.GetAllPositions()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(positions).To(gomega.Equal([]model.Position{
+		{Asset: aapl, Quantity: 10, AvgBuyPrice: 170.25},
+		{Asset: vti, Quantity: 3, AvgBuyPrice: 210},
+	}))
+}
+
+func TestGetQuotes(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	broker, _ := newBroker(t)
+
+	// should use the previous close as price and report the live prices separately
+	quotes, err := broker.GetQuotes(aapl, vti)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(quotes).To(gomega.Equal([]model.Quote{
+		{Asset: aapl, Price: 179.95, Bid: 180.5, Ask: 180.6, Last: 180.52},
+		{Asset: vti, Price: 206.8, Bid: 207.1, Ask: 207.3, Last: 207.2},
+	}))
+	g.Expect(quotes[0].Live(model.OrderTypeBuy)).To(gomega.Equal(180.6))
+	g.Expect(quotes[0].Live(model.OrderTypeSell)).To(gomega.Equal(180.5))
+
+	// should compute the portfolio from positions and quotes
+	portfolio, err := broker.GetPortfolio(aapl, vti)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(portfolio.TotalValue).To(gomega.BeNumerically("~", 10*179.95+3*206.8, 1e-9))
+	g.Expect(portfolio.Quantities[vti]).To(gomega.Equal(3.0))
+}
+
+func TestExecute(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	broker, server := newBroker(t)
+
+	// should report rejected and failed orders, and skip fractional quantities
+	errs := broker.Execute(model.Order{
+		Type:     model.OrderTypeBuy,
+		Asset:    aapl,
+		Quantity: 4,
+		Price:    180.516,
+	}, model.Order{
+		Type:     model.OrderTypeSell,
+		Asset:    vti,
+		Quantity: 2,
+		Price:    207.2,
+	}, model.Order{
+		Type:     model.OrderTypeSell,
+		Asset:    vti,
+		Quantity: 0.5,
+		Price:    207.2,
+	}, model.Order{
+		Type:     model.OrderTypeSell,
+		Asset:    vti,
+		Quantity: 20,
+		Price:    207.2,
+	})
+	g.Expect(errs).To(gomega.HaveLen(2))
+	g.Expect(errs[0].Error()).To(gomega.ContainSubstring("market_closed"))
+	g.Expect(errs[1].Error()).To(gomega.ContainSubstring("Not enough shares to sell."))
+
+	orders := []replay.Request{}
+	for _, request := range server.Requests() {
+		if request.Method == http.MethodPost && request.Path == "/orders/" {
+			orders = append(orders, request)
+		}
+	}
+	g.Expect(orders).To(gomega.HaveLen(3))
+	g.Expect(string(orders[0].Body)).To(gomega.MatchJSON(`{
+		"account": "https://api.robinhood.com/accounts/5RY12345/",
+		"instrument": "https://api.robinhood.com/instruments/450dfc6d-5510-4d40-abfb-f633b7d9be3e/",
+		"symbol": "AAPL",
+		"type": "limit",
+		"time_in_force": "gtc",
+		"trigger": "immediate",
+		"price": 180.52,
+		"quantity": 4,
+		"side": "buy"
+	}`))
+
+	// should fail for unknown symbols
+	_, err := broker.Submit(model.Order{
+		Type:     model.OrderTypeBuy,
+		Asset:    model.Asset{Symbol: "XYZ"},
+		Quantity: 1,
+		Price:    1,
+	})
+	g.Expect(err).NotTo(gomega.BeNil())
+}
+
+func TestSubmit(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	broker, _ := newBroker(t)
+
+	// should return the placed order
+	order, err := broker.Submit(model.Order{
+		Description: "Purchase",
+		Type:        model.OrderTypeBuy,
+		Asset:       aapl,
+		Quantity:    4,
+		Price:       180.52,
+	})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(order).To(gomega.Equal(model.Order{
+		ID:          openID,
+		Description: "Purchase",
+		Type:        model.OrderTypeBuy,
+		Asset:       aapl,
+		Price:       180.52,
+		Quantity:    4,
+		Status:      model.OrderStatusOpen,
+		FilledAt:    time.Date(2021, 3, 8, 14, 31, 0, 123456000, time.UTC),
+	}))
+
+	// should not submit fractional quantities
+	_, err = broker.Submit(model.Order{
+		Type:     model.OrderTypeBuy,
+		Asset:    aapl,
+		Quantity: 0.5,
+		Price:    180.52,
+	})
+	g.Expect(err).NotTo(gomega.BeNil())
+}
+
+func TestGetOrder(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	broker, _ := newBroker(t)
+
+	// should convert the state and fill of the order
+	order, err := broker.GetOrder(filledID)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(order).To(gomega.Equal(model.Order{
+		ID:             filledID,
+		Type:           model.OrderTypeBuy,
+		Asset:          vti,
+		Price:          210.5,
+		Quantity:       3,
+		Status:         model.OrderStatusFilled,
+		FilledQuantity: 3,
+		FilledPrice:    210,
+		FilledAt:       time.Date(2021, 3, 1, 15, 0, 5, 0, time.UTC),
+	}))
+}
+
+func TestCancelOrder(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	broker, _ := newBroker(t)
+
+	// should cancel open orders
+	g.Expect(broker.CancelOrder(openID)).To(gomega.Succeed())
+
+	// should report the error of the API
+	err := broker.CancelOrder(filledID)
+	g.Expect(err).NotTo(gomega.BeNil())
+	g.Expect(err.Error()).To(gomega.ContainSubstring("Order cannot be cancelled."))
+}
+
+func TestGetOpenOrders(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	broker, _ := newBroker(t)
+
+	// should follow the pages and only return the open orders of the account
+	orders, err := broker.GetOpenOrders()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(orders).To(gomega.HaveLen(2))
+	g.Expect(orders[0].ID).To(gomega.Equal(openID))
+	g.Expect(orders[0].Asset).To(gomega.Equal(aapl))
+	g.Expect(orders[0].RemainingQuantity()).To(gomega.Equal(3.0))
+
+	// an open order of an older page must not be missed
+	g.Expect(orders[1].ID).To(gomega.Equal(olderOpenID))
+	g.Expect(orders[1].Asset).To(gomega.Equal(vti))
+	g.Expect(orders[1].Type).To(gomega.Equal(model.OrderTypeSell))
+	g.Expect(orders[1].RemainingQuantity()).To(gomega.Equal(2.0))
+}
+
+func TestGetOrderHistory(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	broker, _ := newBroker(t)
+
+	// should follow the pages and only return filled orders of the account
+	orders, err := broker.GetOrderHistory(time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC))
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(orders).To(gomega.HaveLen(2))
+	g.Expect(orders[0].ID).To(gomega.Equal(filledID))
+	g.Expect(orders[1].Type).To(gomega.Equal(model.OrderTypeSell))
+	g.Expect(orders[1].Status).To(gomega.Equal(model.OrderStatusCancelled))
+	g.Expect(orders[1].FilledQuantity).To(gomega.Equal(1.0))
+
+	// should skip orders filled before the given time
+	orders, err = broker.GetOrderHistory(time.Date(2021, 3, 1, 16, 0, 0, 0, time.UTC))
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(orders).To(gomega.HaveLen(1))
+}
+
+func TestReprice(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	server := replay.NewServer(t, filepath.Join("fixtures", "reprice.json"))
+	broker, err := robinhood.NewConfigBroker(robinhood.Config{
+		Username: "me@example.com",
+		Password: "secret",
+		BaseURL:  server.URL + "/",
+	})
+	g.Expect(err).To(gomega.BeNil())
+
+	now := time.Date(2021, 3, 8, 14, 31, 0, 0, time.UTC)
+	manager, err := execution.NewManager(broker, execution.Options{
+		RepriceAfter: time.Minute,
+		MaxSlippage:  0.01,
+		Deadline:     10 * time.Minute,
+		Now:          func() time.Time { return now },
+		Sleep:        func(d time.Duration) { now = now.Add(d) },
+	})
+	g.Expect(err).To(gomega.BeNil())
+
+	// should move the limit of an unfilled buy from the previous close to the ask
+	report := manager.Run(model.Order{
+		Type:     model.OrderTypeBuy,
+		Asset:    aapl,
+		Quantity: 4,
+		Price:    179.95,
+	})
+	g.Expect(report.Results).To(gomega.HaveLen(1))
+	result := report.Results[0]
+	g.Expect(result.Err).To(gomega.BeNil())
+	g.Expect(result.Attempts).To(gomega.Equal(2))
+	g.Expect(result.IsFilled()).To(gomega.BeTrue())
+	g.Expect(result.FilledPrice).To(gomega.Equal(180.6))
+
+	prices := []float64{}
+	for _, request := range server.Requests() {
+		if request.Method != http.MethodPost || request.Path != "/orders/" {
+			continue
+		}
+		body := struct {
+			Price float64 `json:"price"`
+		}{}
+		g.Expect(json.Unmarshal(request.Body, &body)).To(gomega.Succeed())
+		prices = append(prices, body.Price)
+	}
+	g.Expect(prices).To(gomega.Equal([]float64{179.95, 180.6}))
+}
@@ -0,0 +1,75 @@
+package credentials
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ErrNotFound The store has no secret of the user
+var ErrNotFound = errors.New("credentials not found")
+
+// Store Secrets by service and user, e.g. passwords of broker logins
+type Store interface {
+	// Get Returns the secret of a user, ErrNotFound if there is none
+	Get(service string, user string) (string, error)
+	Set(service string, user string, secret string) error
+}
+
+// Chain Store that returns the secret of the first store that has one and sets secrets in the first store
+type Chain []Store
+
+// Get Get
+func (chain Chain) Get(service string, user string) (string, error) {
+	for _, store := range chain {
+		secret, err := store.Get(service, user)
+		if err == ErrNotFound {
+			continue
+		}
+		return secret, err
+	}
+	return "", ErrNotFound
+}
+
+// Set Set
+func (chain Chain) Set(service string, user string, secret string) error {
+	if len(chain) == 0 {
+		return errors.New("no credentials store")
+	}
+	return chain[0].Set(service, user, secret)
+}
+
+// Prompt Asks for a secret on the terminal without showing the input. It fails if stdin is not a terminal,
+// e.g. in scheduled runs.
+func Prompt(message string) (string, error) {
+	info, err := os.Stdin.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return "", fmt.Errorf("cannot ask for %s: not a terminal", message)
+	}
+	fmt.Fprintf(os.Stderr, "%s: ", message)
+	if echo(false) == nil {
+		defer func() {
+			echo(true)
+			fmt.Fprintln(os.Stderr)
+		}()
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// echo Turns the echo of the terminal on or off
+func echo(on bool) error {
+	mode := "-echo"
+	if on {
+		mode = "echo"
+	}
+	cmd := exec.Command("stty", mode)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
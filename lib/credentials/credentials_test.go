@@ -0,0 +1,111 @@
+package credentials_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MitchK/autorobin/lib/credentials"
+	"github.com/onsi/gomega"
+)
+
+// passphrase Returns the passphrase and counts how often it was asked for
+func passphrase(secret string, asked *int) func() (string, error) {
+	return func() (string, error) {
+		*asked++
+		return secret, nil
+	}
+}
+
+func TestFile(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	path := filepath.Join(t.TempDir(), "credentials", "secrets.json")
+	var asked int
+	file := credentials.NewFile(path, passphrase("correct horse", &asked))
+
+	// should have no secrets before the file exists, without asking for the passphrase
+	_, err := file.Get("robinhood", "me@example.com")
+	g.Expect(err).To(gomega.Equal(credentials.ErrNotFound))
+	g.Expect(asked).To(gomega.Equal(0))
+
+	// should create the file only the user can read, and ask for the passphrase once
+	g.Expect(file.Set("robinhood", "me@example.com", "secret")).To(gomega.Succeed())
+	g.Expect(file.Set("alpaca", "PKTEST", "key")).To(gomega.Succeed())
+	g.Expect(asked).To(gomega.Equal(1))
+	info, err := os.Stat(path)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(info.Mode().Perm()).To(gomega.Equal(os.FileMode(0600)))
+	buf, err := ioutil.ReadFile(path)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(string(buf)).NotTo(gomega.ContainSubstring("secret"))
+
+	// should decrypt the secrets with the passphrase
+	file = credentials.NewFile(path, passphrase("correct horse", &asked))
+	secret, err := file.Get("robinhood", "me@example.com")
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(secret).To(gomega.Equal("secret"))
+	secret, err = file.Get("alpaca", "PKTEST")
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(secret).To(gomega.Equal("key"))
+	_, err = file.Get("robinhood", "other@example.com")
+	g.Expect(err).To(gomega.Equal(credentials.ErrNotFound))
+
+	// should fail with another passphrase
+	file = credentials.NewFile(path, passphrase("wrong", &asked))
+	_, err = file.Get("robinhood", "me@example.com")
+	g.Expect(err).NotTo(gomega.BeNil())
+	g.Expect(err).NotTo(gomega.Equal(credentials.ErrNotFound))
+	g.Expect(file.Set("robinhood", "me@example.com", "other")).NotTo(gomega.Succeed())
+
+	// should fail without passphrase
+	file = credentials.NewFile(path, credentials.Passphrase("", "Passphrase"))
+	_, err = file.Get("robinhood", "me@example.com")
+	g.Expect(err).NotTo(gomega.BeNil())
+}
+
+// store Store of a map that fails for the user "broken"
+type store map[string]string
+
+func (store store) Get(service string, user string) (string, error) {
+	if user == "broken" {
+		return "", errors.New("broken")
+	}
+	secret, exists := store[service+"/"+user]
+	if !exists {
+		return "", credentials.ErrNotFound
+	}
+	return secret, nil
+}
+
+func (store store) Set(service string, user string, secret string) error {
+	store[service+"/"+user] = secret
+	return nil
+}
+
+func TestChain(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	first := store{"robinhood/a": "first"}
+	second := store{"robinhood/a": "second", "robinhood/b": "second"}
+	chain := credentials.Chain{first, second}
+
+	// should return the secret of the first store that has one
+	secret, err := chain.Get("robinhood", "a")
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(secret).To(gomega.Equal("first"))
+	secret, err = chain.Get("robinhood", "b")
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(secret).To(gomega.Equal("second"))
+	_, err = chain.Get("robinhood", "c")
+	g.Expect(err).To(gomega.Equal(credentials.ErrNotFound))
+	_, err = chain.Get("robinhood", "broken")
+	g.Expect(err).To(gomega.MatchError("broken"))
+
+	// should set secrets in the first store
+	g.Expect(chain.Set("robinhood", "c", "new")).To(gomega.Succeed())
+	g.Expect(first["robinhood/c"]).To(gomega.Equal("new"))
+	g.Expect(credentials.Chain{}.Set("robinhood", "c", "new")).NotTo(gomega.Succeed())
+}
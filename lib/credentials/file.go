@@ -0,0 +1,198 @@
+package credentials
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// Iterations Iterations of PBKDF2 to derive the key of a file from its passphrase
+	Iterations = 600000
+
+	saltSize = 16
+	keySize  = 32
+)
+
+// encryptedFile Content of a credentials file, the data is the JSON of the secrets by service and user
+type encryptedFile struct {
+	Salt  []byte `json:"salt"`
+	Nonce []byte `json:"nonce"`
+	Data  []byte `json:"data"`
+}
+
+// File Store of a file that is encrypted with AES-256-GCM and a key derived from a passphrase
+type File struct {
+	path       string
+	passphrase func() (string, error)
+
+	// secret Passphrase once it was asked for
+	secret *string
+}
+
+// NewFile Creates the store of a file, it is created with the first secret. The passphrase is only asked for
+// when a secret is read or written, e.g. with Prompt.
+func NewFile(path string, passphrase func() (string, error)) *File {
+	return &File{
+		path:       path,
+		passphrase: passphrase,
+	}
+}
+
+func (file *File) getPassphrase() (string, error) {
+	if file.secret == nil {
+		passphrase, err := file.passphrase()
+		if err != nil {
+			return "", err
+		}
+		if passphrase == "" {
+			return "", fmt.Errorf("no passphrase of %s provided", file.path)
+		}
+		file.secret = &passphrase
+	}
+	return *file.secret, nil
+}
+
+func (file *File) key(salt []byte) ([]byte, error) {
+	passphrase, err := file.getPassphrase()
+	if err != nil {
+		return nil, err
+	}
+	return pbkdf2.Key(sha256.New, passphrase, salt, Iterations, keySize)
+}
+
+// load Decrypts the secrets of the file, no secrets if it does not exist
+func (file *File) load() (map[string]map[string]string, error) {
+	secrets := map[string]map[string]string{}
+	buf, err := ioutil.ReadFile(file.path)
+	if os.IsNotExist(err) {
+		return secrets, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	encrypted := encryptedFile{}
+	if err := json.Unmarshal(buf, &encrypted); err != nil {
+		return nil, fmt.Errorf("invalid credentials file %s: %v", file.path, err)
+	}
+	key, err := file.key(encrypted.Salt)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := gcm.Open(nil, encrypted.Nonce, encrypted.Data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt credentials file %s: wrong passphrase or corrupt file", file.path)
+	}
+	if err := json.Unmarshal(data, &secrets); err != nil {
+		return nil, fmt.Errorf("invalid credentials file %s: %v", file.path, err)
+	}
+	return secrets, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Get Get
+func (file *File) Get(service string, user string) (string, error) {
+	if _, err := os.Stat(file.path); os.IsNotExist(err) {
+		return "", ErrNotFound
+	}
+	secrets, err := file.load()
+	if err != nil {
+		return "", err
+	}
+	secret, exists := secrets[service][user]
+	if !exists {
+		return "", ErrNotFound
+	}
+	return secret, nil
+}
+
+// Set Encrypts the file again with a new salt and nonce
+func (file *File) Set(service string, user string, secret string) error {
+	secrets, err := file.load()
+	if err != nil {
+		return err
+	}
+	if secrets[service] == nil {
+		secrets[service] = map[string]string{}
+	}
+	secrets[service][user] = secret
+	data, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+
+	encrypted := encryptedFile{
+		Salt: make([]byte, saltSize),
+	}
+	if _, err := rand.Read(encrypted.Salt); err != nil {
+		return err
+	}
+	key, err := file.key(encrypted.Salt)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	encrypted.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(encrypted.Nonce); err != nil {
+		return err
+	}
+	encrypted.Data = gcm.Seal(nil, encrypted.Nonce, data, nil)
+	buf, err := json.Marshal(encrypted)
+	if err != nil {
+		return err
+	}
+	return WriteFile(file.path, buf)
+}
+
+// WriteFile Writes a file only the user can read, its directory is created if it does not exist. The file is replaced
+// at once, so a failed write does not corrupt it.
+func WriteFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Passphrase Returns the given passphrase, or asks for it with Prompt if it is empty
+func Passphrase(passphrase string, message string) func() (string, error) {
+	return func() (string, error) {
+		if passphrase != "" {
+			return passphrase, nil
+		}
+		return Prompt(message)
+	}
+}
@@ -0,0 +1,77 @@
+package credentials
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Keyring Store of the OS keyring: the login keychain on macOS (security) and the Secret Service on Linux (secret-tool,
+// e.g. GNOME Keyring or KWallet). Other systems and systems without the tool have no secrets.
+type Keyring struct{}
+
+// NewKeyring NewKeyring
+func NewKeyring() Keyring {
+	return Keyring{}
+}
+
+// run Runs a command with the given stdin and returns its stdout
+func run(stdin string, name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if stderr.Len() > 0 {
+			return "", fmt.Errorf("%s: %v: %s", name, err, strings.TrimSpace(stderr.String()))
+		}
+		return "", fmt.Errorf("%s: %v", name, err)
+	}
+	return stdout.String(), nil
+}
+
+// Get Get
+func (keyring Keyring) Get(service string, user string) (string, error) {
+	var secret string
+	var err error
+	switch runtime.GOOS {
+	case "darwin":
+		if _, lookErr := exec.LookPath("security"); lookErr != nil {
+			return "", ErrNotFound
+		}
+		secret, err = run("", "security", "find-generic-password", "-s", service, "-a", user, "-w")
+	case "linux":
+		if _, lookErr := exec.LookPath("secret-tool"); lookErr != nil {
+			return "", ErrNotFound
+		}
+		secret, err = run("", "secret-tool", "lookup", "service", service, "username", user)
+	default:
+		return "", ErrNotFound
+	}
+
+	// both tools fail if there is no such secret
+	if err != nil || secret == "" {
+		return "", ErrNotFound
+	}
+	return strings.TrimRight(secret, "\n"), nil
+}
+
+// Set Set
+func (keyring Keyring) Set(service string, user string, secret string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		// the secret is passed on stdin, arguments are visible to other processes
+		command := fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n", strconv.Quote(service), strconv.Quote(user), strconv.Quote(secret))
+		_, err := run(command, "security", "-i")
+		return err
+	case "linux":
+		_, err := run(secret, "secret-tool", "store", "--label", "autorobin "+service+" "+user, "service", service, "username", user)
+		return err
+	}
+	return errors.New("the keyring is not supported on " + runtime.GOOS)
+}
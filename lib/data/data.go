@@ -6,7 +6,9 @@ import (
 	"github.com/MitchK/autorobin/lib/model"
 )
 
+//go:generate mockgen -destination=../mocks/mock_adapter.go -package=mocks github.com/MitchK/autorobin/lib/data Adapter
+
 // Adapter Adapter
 type Adapter interface {
-	GetDailyDesc(from, to time.Time, assets ...model.Asset) ([]model.Quote, error)
+	GetDailyAsc(from, to time.Time, assets ...model.Asset) ([][]model.Quote, error)
 }
@@ -0,0 +1,289 @@
+package execution
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/MitchK/autorobin/lib/broker"
+	"github.com/MitchK/autorobin/lib/logging"
+	"github.com/MitchK/autorobin/lib/model"
+)
+
+// Options Options
+type Options struct {
+	// RepriceAfter Time an order may stay unfilled before it is cancelled and repriced
+	RepriceAfter time.Duration
+
+	// MaxSlippage Maximum relative distance from the original limit price a repriced order may have, e.g. 0.01 for 1%
+	MaxSlippage float64
+
+	// Deadline Time after which all remaining orders are cancelled
+	Deadline time.Duration
+
+	// PollInterval Time between two order status checks
+	PollInterval time.Duration
+
+	// Now and Sleep default to the system clock, tests may replace them
+	Now   func() time.Time
+	Sleep func(time.Duration)
+
+	// Logger Logs submitted, repriced and cancelled orders, silent if not set
+	Logger *slog.Logger
+}
+
+// Result Outcome of a single order
+type Result struct {
+	Order          model.Order
+	FilledQuantity float64
+	FilledPrice    float64
+	Attempts       int
+
+	// Err Reason the order failed or was not filled completely, e.g. a rejection or the last error while watching it
+	Err error
+}
+
+// IsFilled Returns true if the whole quantity of the order was filled
+func (result Result) IsFilled() bool {
+	return result.FilledQuantity >= result.Order.Quantity
+}
+
+// Report Report
+type Report struct {
+	Results []Result
+}
+
+// Filled Returns the results that were filled completely
+func (report Report) Filled() []Result {
+	filled := []Result{}
+	for _, result := range report.Results {
+		if result.IsFilled() {
+			filled = append(filled, result)
+		}
+	}
+	return filled
+}
+
+// Manager Submits orders and watches them until they are filled or the deadline is reached
+type Manager struct {
+	broker  broker.Broker
+	options Options
+}
+
+// NewManager NewManager
+func NewManager(broker broker.Broker, options Options) (*Manager, error) {
+	if options.RepriceAfter <= 0 {
+		return nil, errors.New("reprice interval must be greater than 0")
+	}
+	if options.Deadline <= 0 {
+		return nil, errors.New("deadline must be greater than 0")
+	}
+	if options.MaxSlippage < 0 {
+		return nil, errors.New("max slippage must not be negative")
+	}
+	if options.PollInterval <= 0 {
+		options.PollInterval = options.RepriceAfter
+	}
+	if options.Now == nil {
+		options.Now = time.Now
+	}
+	if options.Sleep == nil {
+		options.Sleep = time.Sleep
+	}
+	options.Logger = logging.Or(options.Logger)
+	return &Manager{
+		broker:  broker,
+		options: options,
+	}, nil
+}
+
+// tracked State of an order while it is watched
+type tracked struct {
+	result      Result
+	current     model.Order
+	submittedAt time.Time
+	filledValue float64
+	done        bool
+
+	// lastErr Last transient error, it is only reported if the order ends up unfilled
+	lastErr error
+}
+
+// Run Submits the orders and reprices unfilled ones until all are filled or the deadline is reached
+func (manager *Manager) Run(orders ...model.Order) Report {
+	deadline := manager.options.Now().Add(manager.options.Deadline)
+
+	trackedOrders := make([]*tracked, len(orders))
+	for i, order := range orders {
+		t := &tracked{
+			result: Result{
+				Order: order,
+			},
+		}
+		trackedOrders[i] = t
+		manager.submit(t, order.Price, order.Quantity)
+	}
+
+	for manager.isActive(trackedOrders) {
+		if !manager.options.Now().Before(deadline) {
+			for _, t := range trackedOrders {
+				if !t.done {
+					manager.options.Logger.Info("cancelling order at the deadline", logging.Order(t.current)...)
+					if err := manager.cancel(t); err != nil {
+						t.result.Err = err
+					}
+					t.done = true
+				}
+			}
+			break
+		}
+		manager.options.Sleep(manager.options.PollInterval)
+		for _, t := range trackedOrders {
+			if !t.done {
+				manager.update(t)
+			}
+		}
+	}
+
+	report := Report{
+		Results: make([]Result, len(trackedOrders)),
+	}
+	for i, t := range trackedOrders {
+		if t.result.FilledQuantity > 0 {
+			t.result.FilledPrice = t.filledValue / t.result.FilledQuantity
+		}
+		if !t.result.IsFilled() && t.result.Err == nil {
+			t.result.Err = t.lastErr
+		}
+		report.Results[i] = t.result
+	}
+	return report
+}
+
+func (manager *Manager) isActive(trackedOrders []*tracked) bool {
+	for _, t := range trackedOrders {
+		if !t.done {
+			return true
+		}
+	}
+	return false
+}
+
+func (manager *Manager) submit(t *tracked, price float64, quantity float64) {
+	order := t.result.Order
+	order.Price = price
+	order.Quantity = quantity
+	submitted, err := manager.broker.Submit(order)
+	t.result.Attempts++
+	if err != nil {
+		manager.options.Logger.Warn("could not submit order", append(logging.Order(order), "error", err)...)
+		t.result.Err = err
+		t.done = true
+		return
+	}
+	manager.options.Logger.Info("submitted order", append(logging.Order(submitted), "attempt", t.result.Attempts)...)
+	t.current = submitted
+	t.submittedAt = manager.options.Now()
+	if submitted.IsDone() {
+		manager.settle(t, submitted)
+	}
+}
+
+// settle Books the fills of an order that will not be filled any further
+func (manager *Manager) settle(t *tracked, order model.Order) {
+	t.result.FilledQuantity += order.FilledQuantity
+	t.filledValue += order.FilledQuantity * order.FilledPrice
+	t.current = order
+	if order.FilledQuantity > 0 {
+		manager.options.Logger.Info("order filled", append(logging.Order(order), "filled_quantity", order.FilledQuantity, "filled_price", order.FilledPrice)...)
+	}
+	if order.Status == model.OrderStatusFilled || t.result.IsFilled() {
+		t.done = true
+	} else if order.Status == model.OrderStatusRejected {
+		t.result.Err = fmt.Errorf("order %s of %s was rejected", order.ID, order.Asset.Symbol)
+		t.done = true
+	}
+}
+
+func (manager *Manager) update(t *tracked) {
+	order, err := manager.broker.GetOrder(t.current.ID)
+	if err != nil {
+		manager.retry(t, "could not get order status", err)
+		return
+	}
+	t.lastErr = nil
+	if order.IsDone() {
+		manager.settle(t, order)
+		if order.Status == model.OrderStatusCancelled && !t.done {
+			// cancelled outside of the manager, do not place it again
+			t.result.Err = fmt.Errorf("order %s of %s was cancelled", order.ID, order.Asset.Symbol)
+			t.done = true
+		}
+		return
+	}
+	if manager.options.Now().Sub(t.submittedAt) < manager.options.RepriceAfter {
+		return
+	}
+
+	price, err := manager.reprice(t.result.Order)
+	if err != nil {
+		manager.retry(t, "could not reprice order", err)
+		return
+	}
+	if price == t.current.Price {
+		// already at the limit of the slippage budget, keep waiting
+		return
+	}
+	manager.options.Logger.Info("repricing order", append(logging.Order(t.current), "new_price", price)...)
+	if err := manager.cancel(t); err != nil {
+		manager.retry(t, "could not cancel order for repricing", err)
+		return
+	}
+	remaining := t.result.Order.Quantity - t.result.FilledQuantity
+	if remaining < 1 {
+		t.done = true
+		return
+	}
+	manager.submit(t, price, remaining)
+}
+
+// cancel Cancels the current order of t and books its partial fills, it returns an error if the order could not be cancelled
+func (manager *Manager) cancel(t *tracked) error {
+	if t.current.ID == "" {
+		return fmt.Errorf("order of %s was not submitted", t.result.Order.Asset.Symbol)
+	}
+	err := manager.broker.CancelOrder(t.current.ID)
+	order, getErr := manager.broker.GetOrder(t.current.ID)
+	if getErr != nil {
+		return getErr
+	}
+	if err != nil && !order.IsDone() {
+		return err
+	}
+	manager.settle(t, order)
+	return nil
+}
+
+// retry Logs a transient error, the order is checked again at the next poll
+func (manager *Manager) retry(t *tracked, msg string, err error) {
+	manager.options.Logger.Warn(msg, append(logging.Order(t.current), "error", err)...)
+	t.lastErr = err
+}
+
+// reprice Returns the live market price, the ask for buys and the bid for sells, capped by the slippage budget around the original limit price
+func (manager *Manager) reprice(order model.Order) (float64, error) {
+	quotes, err := manager.broker.GetQuotes(order.Asset)
+	if err != nil {
+		return 0, err
+	}
+	if len(quotes) == 0 {
+		return 0, fmt.Errorf("no quote for %s", order.Asset.Symbol)
+	}
+	market := quotes[0].Live(order.Type)
+	if order.Type == model.OrderTypeBuy {
+		return math.Min(market, order.Price*(1+manager.options.MaxSlippage)), nil
+	}
+	return math.Max(market, order.Price*(1-manager.options.MaxSlippage)), nil
+}
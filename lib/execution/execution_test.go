@@ -0,0 +1,196 @@
+package execution_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MitchK/autorobin/lib/broker/fake"
+	"github.com/MitchK/autorobin/lib/execution"
+	"github.com/MitchK/autorobin/lib/model"
+	"github.com/onsi/gomega"
+)
+
+var (
+	a = model.Asset{Symbol: "A"}
+	b = model.Asset{Symbol: "B"}
+)
+
+// scriptedClock Advances a fake clock on every sleep and feeds the next prices of a scripted price path to the broker
+type scriptedClock struct {
+	broker *fake.Fake
+	now    time.Time
+	step   int
+	paths  map[model.Asset][]float64
+}
+
+func newScriptedClock(broker *fake.Fake, paths map[model.Asset][]float64) *scriptedClock {
+	clock := &scriptedClock{
+		broker: broker,
+		now:    time.Date(2018, 11, 16, 10, 0, 0, 0, time.UTC),
+		paths:  paths,
+	}
+	clock.setQuotes()
+	return clock
+}
+
+func (clock *scriptedClock) setQuotes() {
+	quotes := []model.Quote{}
+	for asset, path := range clock.paths {
+		i := clock.step
+		if i >= len(path) {
+			i = len(path) - 1
+		}
+		quotes = append(quotes, model.Quote{Asset: asset, Price: path[i], Date: clock.now})
+	}
+	clock.broker.SetQuotes(quotes...)
+}
+
+func (clock *scriptedClock) Now() time.Time {
+	return clock.now
+}
+
+func (clock *scriptedClock) Sleep(d time.Duration) {
+	clock.now = clock.now.Add(d)
+	clock.step++
+	clock.setQuotes()
+}
+
+// flakyBroker Fails to return the status of orders a number of times
+type flakyBroker struct {
+	*fake.Fake
+	failures int
+}
+
+func (broker *flakyBroker) GetOrder(id string) (model.Order, error) {
+	if broker.failures != 0 {
+		broker.failures--
+		return model.Order{}, errors.New("connection reset")
+	}
+	return broker.Fake.GetOrder(id)
+}
+
+func newManager(t *testing.T, broker *fake.Fake, clock *scriptedClock, maxSlippage float64) *execution.Manager {
+	manager, err := execution.NewManager(broker, execution.Options{
+		RepriceAfter: 10 * time.Second,
+		PollInterval: 10 * time.Second,
+		MaxSlippage:  maxSlippage,
+		Deadline:     time.Minute,
+		Now:          clock.Now,
+		Sleep:        clock.Sleep,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return manager
+}
+
+func TestFilledImmediately(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	broker := fake.NewBroker(1000)
+	clock := newScriptedClock(broker, map[model.Asset][]float64{a: {10}})
+	manager := newManager(t, broker, clock, 0.01)
+
+	report := manager.Run(model.Order{Asset: a, Type: model.OrderTypeBuy, Price: 10, Quantity: 5})
+	g.Expect(len(report.Results)).To(gomega.Equal(1))
+	g.Expect(report.Results[0].Err).To(gomega.BeNil())
+	g.Expect(report.Results[0].IsFilled()).To(gomega.BeTrue())
+	g.Expect(report.Results[0].Attempts).To(gomega.Equal(1))
+	g.Expect(report.Results[0].FilledPrice).To(gomega.BeNumerically("~", 10))
+}
+
+func TestRepriceTowardsMarket(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	broker := fake.NewBroker(1000)
+	// market moves away from the limit, then comes back within the slippage budget
+	clock := newScriptedClock(broker, map[model.Asset][]float64{a: {10.05, 10.05, 10.08, 10.08}})
+	manager := newManager(t, broker, clock, 0.01)
+
+	report := manager.Run(model.Order{Asset: a, Type: model.OrderTypeBuy, Price: 10, Quantity: 5})
+	result := report.Results[0]
+	g.Expect(result.Err).To(gomega.BeNil())
+	g.Expect(result.IsFilled()).To(gomega.BeTrue())
+	g.Expect(result.Attempts).To(gomega.BeNumerically(">", 1))
+	g.Expect(result.FilledPrice).To(gomega.BeNumerically(">", 10))
+	g.Expect(result.FilledPrice).To(gomega.BeNumerically("<=", 10.1))
+
+	cash, err := broker.GetAvailableCash()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(cash).To(gomega.BeNumerically("~", 1000-5*result.FilledPrice))
+}
+
+func TestSlippageBudgetAndDeadline(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	broker := fake.NewBroker(1000)
+	errs := broker.Execute(model.Order{Asset: b, Type: model.OrderTypeBuy, Price: 20, Quantity: 10})
+	g.Expect(errs).To(gomega.BeEmpty())
+
+	// market runs away beyond the slippage budget for the buy, the sell is filled after repricing
+	clock := newScriptedClock(broker, map[model.Asset][]float64{
+		a: {11, 12, 13},
+		b: {19.9, 19.9, 19.9},
+	})
+	manager := newManager(t, broker, clock, 0.01)
+
+	report := manager.Run(
+		model.Order{Asset: a, Type: model.OrderTypeBuy, Price: 10, Quantity: 5},
+		model.Order{Asset: b, Type: model.OrderTypeSell, Price: 20, Quantity: 10},
+	)
+	g.Expect(len(report.Results)).To(gomega.Equal(2))
+
+	buy := report.Results[0]
+	g.Expect(buy.IsFilled()).To(gomega.BeFalse())
+	g.Expect(buy.FilledQuantity).To(gomega.BeZero())
+
+	sell := report.Results[1]
+	g.Expect(sell.IsFilled()).To(gomega.BeTrue())
+	g.Expect(sell.FilledPrice).To(gomega.BeNumerically("~", 19.9))
+	g.Expect(len(report.Filled())).To(gomega.Equal(1))
+
+	// the unfilled buy must not hold any cash after the deadline
+	cash, err := broker.GetAvailableCash()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(cash).To(gomega.BeNumerically("~", 1000-200+10*19.9))
+	g.Expect(clock.Now().Sub(time.Date(2018, 11, 16, 10, 0, 0, 0, time.UTC))).To(gomega.BeNumerically("<=", time.Minute))
+}
+
+func TestTransientErrors(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	// should not report errors of an order that is filled in the end
+	broker := &flakyBroker{Fake: fake.NewBroker(1000), failures: 2}
+	clock := newScriptedClock(broker.Fake, map[model.Asset][]float64{a: {10.05, 10.05, 10.05, 10.05}})
+	manager, err := execution.NewManager(broker, execution.Options{
+		RepriceAfter: 10 * time.Second,
+		MaxSlippage:  0.01,
+		Deadline:     time.Minute,
+		Now:          clock.Now,
+		Sleep:        clock.Sleep,
+	})
+	g.Expect(err).To(gomega.BeNil())
+
+	report := manager.Run(model.Order{Asset: a, Type: model.OrderTypeBuy, Price: 10, Quantity: 5})
+	result := report.Results[0]
+	g.Expect(result.IsFilled()).To(gomega.BeTrue())
+	g.Expect(result.Err).To(gomega.BeNil())
+
+	// should report the last error of an order that stays unfilled
+	broker = &flakyBroker{Fake: fake.NewBroker(1000), failures: -1}
+	clock = newScriptedClock(broker.Fake, map[model.Asset][]float64{a: {10.05}})
+	manager, err = execution.NewManager(broker, execution.Options{
+		RepriceAfter: 10 * time.Second,
+		MaxSlippage:  0.01,
+		Deadline:     time.Minute,
+		Now:          clock.Now,
+		Sleep:        clock.Sleep,
+	})
+	g.Expect(err).To(gomega.BeNil())
+
+	report = manager.Run(model.Order{Asset: a, Type: model.OrderTypeBuy, Price: 10, Quantity: 5})
+	result = report.Results[0]
+	g.Expect(result.IsFilled()).To(gomega.BeFalse())
+	g.Expect(result.Err).To(gomega.MatchError("connection reset"))
+}
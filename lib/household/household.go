@@ -0,0 +1,231 @@
+package household
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/MitchK/autorobin/lib/autopilot"
+	"github.com/MitchK/autorobin/lib/broker"
+	"github.com/MitchK/autorobin/lib/model"
+)
+
+const (
+	// AccountTypeTaxable Gains are taxed when they are realized
+	AccountTypeTaxable AccountType = iota + 1
+
+	// AccountTypeTaxDeferred Withdrawals are taxed, e.g. a traditional IRA or 401(k)
+	AccountTypeTaxDeferred
+
+	// AccountTypeTaxFree Neither gains nor withdrawals are taxed, e.g. a Roth IRA
+	AccountTypeTaxFree
+)
+
+// AccountType AccountType
+type AccountType int
+
+// Account Account of a household at a broker
+type Account struct {
+	Name   string
+	Type   AccountType
+	Broker broker.Broker
+
+	// Options Options of the rebalance of the account, e.g. ModeCashFlow for taxable accounts
+	Options autopilot.Options
+}
+
+// Location Account types an asset should preferably be held in, in order of preference
+type Location struct {
+	Asset        model.Asset
+	AccountTypes []AccountType
+}
+
+// AccountPlan Plan of a single account
+type AccountPlan struct {
+	Account Account
+
+	// Weights Target weights of the account that result from the asset location
+	Weights model.Weights
+	Plan    model.Plan
+}
+
+// Plan Plans of all accounts of a household
+type Plan struct {
+	Accounts []AccountPlan
+}
+
+// Household Accounts that share one target allocation
+type Household struct {
+	accounts  []Account
+	pilots    []*autopilot.Autopilot
+	locations []Location
+}
+
+// NewHousehold NewHousehold
+func NewHousehold(accounts ...Account) (*Household, error) {
+	if len(accounts) == 0 {
+		return nil, errors.New("household needs at least one account")
+	}
+	names := map[string]bool{}
+	pilots := make([]*autopilot.Autopilot, len(accounts))
+	for i, account := range accounts {
+		if account.Broker == nil {
+			return nil, fmt.Errorf("account %s has no broker", account.Name)
+		}
+		if account.Type < AccountTypeTaxable || account.Type > AccountTypeTaxFree {
+			return nil, fmt.Errorf("account %s has an invalid type: %v", account.Name, account.Type)
+		}
+		if names[account.Name] {
+			return nil, fmt.Errorf("account %s is defined twice", account.Name)
+		}
+		names[account.Name] = true
+
+		pilot, err := autopilot.NewAutopilot(account.Broker)
+		if err != nil {
+			return nil, err
+		}
+		if err := pilot.SetOptions(account.Options); err != nil {
+			return nil, fmt.Errorf("account %s: %v", account.Name, err)
+		}
+		pilots[i] = pilot
+	}
+	return &Household{
+		accounts: accounts,
+		pilots:   pilots,
+	}, nil
+}
+
+// GetAccounts GetAccounts
+func (household *Household) GetAccounts() []Account {
+	return household.accounts
+}
+
+// GetAutopilot Returns the autopilot of an account, e.g. to set its open orders
+func (household *Household) GetAutopilot(name string) (*autopilot.Autopilot, error) {
+	for i, account := range household.accounts {
+		if account.Name == name {
+			return household.pilots[i], nil
+		}
+	}
+	return nil, fmt.Errorf("account %s does not exist", name)
+}
+
+// SetLocations Sets the preferred account types of assets. Located assets are placed first, in the given order.
+func (household *Household) SetLocations(locations ...Location) {
+	household.locations = locations
+}
+
+// Locate Distributes the desired weights of the household over its accounts and returns the target weights of every account.
+// The value of an asset goes to the accounts of its preferred types first as far as they have room, assets without location
+// fill the remaining room of all accounts proportionally. The room of an account is its value including available cash.
+func (household *Household) Locate(desiredWeights model.Weights, assets ...model.Asset) ([]model.Weights, error) {
+	room := make([]float64, len(household.accounts))
+	values := make([]float64, len(household.accounts))
+	var total float64
+	for i, account := range household.accounts {
+		cash, err := account.Broker.GetAvailableCash()
+		if err != nil {
+			return nil, fmt.Errorf("account %s: %v", account.Name, err)
+		}
+		portfolio, err := account.Broker.GetPortfolio(assets...)
+		if err != nil {
+			return nil, fmt.Errorf("account %s: %v", account.Name, err)
+		}
+		values[i] = portfolio.TotalValue + cash
+		room[i] = values[i]
+		total += values[i]
+	}
+
+	amounts := make([]map[model.Asset]float64, len(household.accounts))
+	for i := range amounts {
+		amounts[i] = map[model.Asset]float64{}
+	}
+	put := func(i int, asset model.Asset, amount float64) {
+		amounts[i][asset] += amount
+		room[i] -= amount
+	}
+
+	// located assets go to the accounts of their preferred types first
+	located := map[model.Asset]bool{}
+	for _, location := range household.locations {
+		asset := location.Asset
+		if _, ok := desiredWeights[asset]; !ok || located[asset] {
+			continue
+		}
+		located[asset] = true
+		remaining := desiredWeights[asset] * total
+		for _, accountType := range location.AccountTypes {
+			for i, account := range household.accounts {
+				if account.Type != accountType || room[i] <= 0 || remaining <= 0 {
+					continue
+				}
+				amount := math.Min(room[i], remaining)
+				put(i, asset, amount)
+				remaining -= amount
+			}
+		}
+		// without room in the preferred accounts, the rest goes wherever there is room
+		for i := range household.accounts {
+			if room[i] <= 0 || remaining <= 0 {
+				continue
+			}
+			amount := math.Min(room[i], remaining)
+			put(i, asset, amount)
+			remaining -= amount
+		}
+	}
+
+	// other assets fill the remaining room proportionally
+	var totalRoom float64
+	for i := range room {
+		totalRoom += math.Max(0, room[i])
+	}
+	shares := make([]float64, len(room))
+	for i := range room {
+		if totalRoom > 0 {
+			shares[i] = math.Max(0, room[i]) / totalRoom
+		}
+	}
+	for _, asset := range assets {
+		if located[asset] {
+			continue
+		}
+		for i := range household.accounts {
+			put(i, asset, desiredWeights[asset]*total*shares[i])
+		}
+	}
+
+	weights := make([]model.Weights, len(household.accounts))
+	for i := range household.accounts {
+		weights[i] = model.Weights{}
+		for _, asset := range assets {
+			if values[i] > 0 {
+				weights[i][asset] = amounts[i][asset] / values[i]
+			} else {
+				weights[i][asset] = 0
+			}
+		}
+	}
+	return weights, nil
+}
+
+// Plan Locates the assets and plans the rebalance of every account with its target weights
+func (household *Household) Plan(desiredWeights model.Weights, partials bool, assets ...model.Asset) (Plan, error) {
+	weights, err := household.Locate(desiredWeights, assets...)
+	if err != nil {
+		return Plan{}, err
+	}
+	plan := Plan{}
+	for i, account := range household.accounts {
+		accountPlan, err := household.pilots[i].Plan(weights[i], partials, assets...)
+		if err != nil {
+			return Plan{}, fmt.Errorf("account %s: %v", account.Name, err)
+		}
+		plan.Accounts = append(plan.Accounts, AccountPlan{
+			Account: account,
+			Weights: weights[i],
+			Plan:    accountPlan,
+		})
+	}
+	return plan, nil
+}
@@ -0,0 +1,82 @@
+package household_test
+
+import (
+	"testing"
+
+	"github.com/MitchK/autorobin/lib/autopilot"
+	"github.com/MitchK/autorobin/lib/broker/fake"
+	"github.com/MitchK/autorobin/lib/household"
+	"github.com/MitchK/autorobin/lib/model"
+	"github.com/onsi/gomega"
+)
+
+var (
+	stock = model.Asset{Symbol: "STOCK"}
+	bond  = model.Asset{Symbol: "BOND"}
+)
+
+func newBroker(cash float64) *fake.Fake {
+	broker := fake.NewBroker(cash)
+	broker.SetQuotes(
+		model.Quote{Asset: stock, Price: 100},
+		model.Quote{Asset: bond, Price: 50},
+	)
+	return broker
+}
+
+func TestPlan(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	house, err := household.NewHousehold(
+		household.Account{Name: "taxable", Type: household.AccountTypeTaxable, Broker: newBroker(1000)},
+		household.Account{Name: "ira", Type: household.AccountTypeTaxDeferred, Broker: newBroker(1000)},
+	)
+	g.Expect(err).To(gomega.BeNil())
+	house.SetLocations(household.Location{
+		Asset:        bond,
+		AccountTypes: []household.AccountType{household.AccountTypeTaxDeferred},
+	})
+
+	// bonds go to the tax-deferred account
+	plan, err := house.Plan(model.Weights{stock: 0.5, bond: 0.5}, false, stock, bond)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(plan.Accounts).To(gomega.HaveLen(2))
+	taxable := plan.Accounts[0]
+	g.Expect(taxable.Weights[stock]).To(gomega.BeNumerically("~", 1))
+	g.Expect(taxable.Plan.Orders).To(gomega.HaveLen(1))
+	g.Expect(taxable.Plan.Orders[0].Asset).To(gomega.Equal(stock))
+	g.Expect(taxable.Plan.Orders[0].Quantity).To(gomega.BeNumerically("~", 10))
+	ira := plan.Accounts[1]
+	g.Expect(ira.Weights[bond]).To(gomega.BeNumerically("~", 1))
+	g.Expect(ira.Plan.Orders).To(gomega.HaveLen(1))
+	g.Expect(ira.Plan.Orders[0].Asset).To(gomega.Equal(bond))
+	g.Expect(ira.Plan.Orders[0].Quantity).To(gomega.BeNumerically("~", 20))
+
+	// bonds that do not fit into the tax-deferred account go to the taxable account
+	weights, err := house.Locate(model.Weights{stock: 0.25, bond: 0.75}, stock, bond)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(weights[0][bond]).To(gomega.BeNumerically("~", 0.5))
+	g.Expect(weights[0][stock]).To(gomega.BeNumerically("~", 0.5))
+	g.Expect(weights[1][bond]).To(gomega.BeNumerically("~", 1))
+}
+
+func TestNewHousehold(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	_, err := household.NewHousehold()
+	g.Expect(err).ToNot(gomega.BeNil())
+	_, err = household.NewHousehold(household.Account{Name: "a", Type: household.AccountTypeTaxable})
+	g.Expect(err).ToNot(gomega.BeNil())
+	_, err = household.NewHousehold(
+		household.Account{Name: "a", Type: household.AccountTypeTaxable, Broker: newBroker(0)},
+		household.Account{Name: "a", Type: household.AccountTypeTaxFree, Broker: newBroker(0)},
+	)
+	g.Expect(err).ToNot(gomega.BeNil())
+	_, err = household.NewHousehold(household.Account{
+		Name:    "a",
+		Type:    household.AccountTypeTaxable,
+		Broker:  newBroker(0),
+		Options: autopilot.Options{Withdrawal: -1},
+	})
+	g.Expect(err).ToNot(gomega.BeNil())
+}
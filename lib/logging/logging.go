@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/MitchK/autorobin/lib/model"
+)
+
+const (
+	// FormatText Records as key=value pairs
+	FormatText = "text"
+
+	// FormatJSON One JSON object per record
+	FormatJSON = "json"
+
+	// LevelOff Level that drops all records
+	LevelOff = "off"
+)
+
+const (
+	// KeyRun ID of a run of the command
+	KeyRun = "run"
+
+	// KeyAccount Name of an account of a household
+	KeyAccount = "account"
+
+	// KeySymbol Symbol of an asset
+	KeySymbol = "symbol"
+
+	// KeyOrderID ID of an order at the broker
+	KeyOrderID = "order_id"
+)
+
+// Discard Returns a logger that drops all records, library code uses it unless a logger is injected
+func Discard() *slog.Logger {
+	return slog.New(slog.DiscardHandler)
+}
+
+// Or Returns the logger, a logger that drops all records if it is nil
+func Or(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return Discard()
+	}
+	return logger
+}
+
+// New Returns a logger that writes the records of at least the level, or none for LevelOff, as text or JSON
+func New(w io.Writer, level string, format string) (*slog.Logger, error) {
+	if level == LevelOff {
+		return Discard(), nil
+	}
+	var minLevel slog.Level
+	if err := minLevel.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level: %s", level)
+	}
+	options := &slog.HandlerOptions{
+		Level: minLevel,
+	}
+	switch format {
+	case FormatText:
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	}
+	return nil, fmt.Errorf("invalid log format: %s", format)
+}
+
+// Order Returns the fields of an order, the ID only if it was submitted
+func Order(order model.Order) []interface{} {
+	side := "buy"
+	if order.Type == model.OrderTypeSell {
+		side = "sell"
+	}
+	fields := []interface{}{
+		KeySymbol, order.Asset.Symbol,
+		"side", side,
+		"quantity", order.Quantity,
+		"price", order.Price,
+	}
+	if order.ID != "" {
+		fields = append(fields, KeyOrderID, order.ID)
+	}
+	return fields
+}
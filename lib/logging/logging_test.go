@@ -0,0 +1,65 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/MitchK/autorobin/lib/logging"
+	"github.com/MitchK/autorobin/lib/model"
+	"github.com/onsi/gomega"
+)
+
+func TestNew(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	order := model.Order{
+		ID:       "42",
+		Type:     model.OrderTypeSell,
+		Asset:    model.Asset{Symbol: "VTI"},
+		Quantity: 2,
+		Price:    207.5,
+	}
+
+	// should write records of at least the level as JSON with the fields of the order
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, "info", logging.FormatJSON)
+	g.Expect(err).To(gomega.BeNil())
+	logger = logger.With(logging.KeyRun, "run-1")
+	logger.Debug("planned order", logging.Order(order)...)
+	logger.Info("submitted order", logging.Order(order)...)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	g.Expect(lines).To(gomega.HaveLen(1))
+	g.Expect(lines[0]).To(gomega.ContainSubstring(`"msg":"submitted order","run":"run-1","symbol":"VTI","side":"sell","quantity":2,"price":207.5,"order_id":"42"`))
+
+	// should write text
+	buf.Reset()
+	logger, err = logging.New(&buf, "debug", logging.FormatText)
+	g.Expect(err).To(gomega.BeNil())
+	logger.Debug("planned order", logging.Order(model.Order{Type: model.OrderTypeBuy, Asset: model.Asset{Symbol: "BND"}, Quantity: 1, Price: 70})...)
+	g.Expect(buf.String()).To(gomega.ContainSubstring(`level=DEBUG msg="planned order" symbol=BND side=buy quantity=1 price=70`))
+	g.Expect(buf.String()).NotTo(gomega.ContainSubstring("order_id"))
+
+	// should drop all records when off
+	buf.Reset()
+	logger, err = logging.New(&buf, logging.LevelOff, logging.FormatText)
+	g.Expect(err).To(gomega.BeNil())
+	logger.Error("command failed")
+	g.Expect(buf.String()).To(gomega.BeEmpty())
+
+	_, err = logging.New(&buf, "loud", logging.FormatText)
+	g.Expect(err).NotTo(gomega.BeNil())
+	_, err = logging.New(&buf, "info", "xml")
+	g.Expect(err).NotTo(gomega.BeNil())
+}
+
+func TestOr(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	// should be silent without a logger
+	g.Expect(logging.Or(nil).Enabled(context.Background(), slog.LevelError)).To(gomega.BeFalse())
+	logger := logging.Discard()
+	g.Expect(logging.Or(logger)).To(gomega.BeIdenticalTo(logger))
+}
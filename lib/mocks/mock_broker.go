@@ -8,6 +8,7 @@ import (
 	model "github.com/MitchK/autorobin/lib/model"
 	gomock "github.com/golang/mock/gomock"
 	reflect "reflect"
+	time "time"
 )
 
 // MockBroker is a mock of Broker interface
@@ -33,6 +34,18 @@ func (m *MockBroker) EXPECT() *MockBrokerMockRecorder {
 	return m.recorder
 }
 
+// CancelOrder mocks base method
+func (m *MockBroker) CancelOrder(arg0 string) error {
+	ret := m.ctrl.Call(m, "CancelOrder", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CancelOrder indicates an expected call of CancelOrder
+func (mr *MockBrokerMockRecorder) CancelOrder(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelOrder", reflect.TypeOf((*MockBroker)(nil).CancelOrder), arg0)
+}
+
 // Execute mocks base method
 func (m *MockBroker) Execute(arg0 ...model.Order) []error {
 	varargs := []interface{}{}
@@ -49,6 +62,19 @@ func (mr *MockBrokerMockRecorder) Execute(arg0 ...interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Execute", reflect.TypeOf((*MockBroker)(nil).Execute), arg0...)
 }
 
+// GetAllPositions mocks base method
+func (m *MockBroker) GetAllPositions() ([]model.Position, error) {
+	ret := m.ctrl.Call(m, "GetAllPositions")
+	ret0, _ := ret[0].([]model.Position)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAllPositions indicates an expected call of GetAllPositions
+func (mr *MockBrokerMockRecorder) GetAllPositions() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllPositions", reflect.TypeOf((*MockBroker)(nil).GetAllPositions))
+}
+
 // GetAvailableCash mocks base method
 func (m *MockBroker) GetAvailableCash() (float64, error) {
 	ret := m.ctrl.Call(m, "GetAvailableCash")
@@ -62,6 +88,45 @@ func (mr *MockBrokerMockRecorder) GetAvailableCash() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAvailableCash", reflect.TypeOf((*MockBroker)(nil).GetAvailableCash))
 }
 
+// GetOpenOrders mocks base method
+func (m *MockBroker) GetOpenOrders() ([]model.Order, error) {
+	ret := m.ctrl.Call(m, "GetOpenOrders")
+	ret0, _ := ret[0].([]model.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOpenOrders indicates an expected call of GetOpenOrders
+func (mr *MockBrokerMockRecorder) GetOpenOrders() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOpenOrders", reflect.TypeOf((*MockBroker)(nil).GetOpenOrders))
+}
+
+// GetOrder mocks base method
+func (m *MockBroker) GetOrder(arg0 string) (model.Order, error) {
+	ret := m.ctrl.Call(m, "GetOrder", arg0)
+	ret0, _ := ret[0].(model.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrder indicates an expected call of GetOrder
+func (mr *MockBrokerMockRecorder) GetOrder(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrder", reflect.TypeOf((*MockBroker)(nil).GetOrder), arg0)
+}
+
+// GetOrderHistory mocks base method
+func (m *MockBroker) GetOrderHistory(arg0 time.Time) ([]model.Order, error) {
+	ret := m.ctrl.Call(m, "GetOrderHistory", arg0)
+	ret0, _ := ret[0].([]model.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrderHistory indicates an expected call of GetOrderHistory
+func (mr *MockBrokerMockRecorder) GetOrderHistory(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrderHistory", reflect.TypeOf((*MockBroker)(nil).GetOrderHistory), arg0)
+}
+
 // GetPortfolio mocks base method
 func (m *MockBroker) GetPortfolio(arg0 ...model.Asset) (model.Portfolio, error) {
 	varargs := []interface{}{}
@@ -112,3 +177,16 @@ func (m *MockBroker) GetQuotes(arg0 ...model.Asset) ([]model.Quote, error) {
 func (mr *MockBrokerMockRecorder) GetQuotes(arg0 ...interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetQuotes", reflect.TypeOf((*MockBroker)(nil).GetQuotes), arg0...)
 }
+
+// Submit mocks base method
+func (m *MockBroker) Submit(arg0 model.Order) (model.Order, error) {
+	ret := m.ctrl.Call(m, "Submit", arg0)
+	ret0, _ := ret[0].(model.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Submit indicates an expected call of Submit
+func (mr *MockBrokerMockRecorder) Submit(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Submit", reflect.TypeOf((*MockBroker)(nil).Submit), arg0)
+}
@@ -0,0 +1,217 @@
+package model
+
+import (
+	"fmt"
+	"math"
+)
+
+// Allocation Node of a hierarchical target allocation, e.g. 60% equities (70% US, 30% international) and 40% bonds.
+// A node either divides its weight among its classes or is a sleeve that is filled by any of its interchangeable assets.
+type Allocation struct {
+	// Name Name of the asset class
+	Name string
+
+	// Weight Share of the value of the parent, the root has a weight of 1
+	Weight float64
+
+	// Band Tolerated absolute drift of the share of the parent, e.g. 0.05. The classes of a parent keep their current
+	// shares as long as every one of them is within its band. Classes without a band are always rebalanced.
+	Band float64
+
+	// Classes Sub-classes of the class
+	Classes []Allocation
+
+	// Assets Interchangeable assets of a sleeve, purchases go to the first one
+	Assets []Asset
+}
+
+// Class Asset class of an allocation with its weight of the total value
+type Class struct {
+	// Path Names of the classes from the top level down, separated by "/"
+	Path   string
+	Weight float64
+	Assets []Asset
+}
+
+// Validate Returns an error if the weights of the classes of a node do not add up to 1, a node is neither a sleeve nor
+// divided into classes or an asset is part of more than one sleeve
+func (allocation Allocation) Validate() error {
+	return allocation.validate(allocation.Name, map[Asset]bool{})
+}
+
+func (allocation Allocation) validate(path string, seen map[Asset]bool) error {
+	if allocation.Band < 0 || allocation.Band >= 1 {
+		return fmt.Errorf("band of %s must be between 0 and 1", path)
+	}
+	if len(allocation.Classes) > 0 && len(allocation.Assets) > 0 {
+		return fmt.Errorf("%s cannot have both classes and assets", path)
+	}
+	if len(allocation.Assets) > 0 {
+		for _, asset := range allocation.Assets {
+			if seen[asset] {
+				return fmt.Errorf("%s is part of more than one sleeve", asset.Symbol)
+			}
+			seen[asset] = true
+		}
+		return nil
+	}
+	if len(allocation.Classes) == 0 {
+		return fmt.Errorf("%s has neither classes nor assets", path)
+	}
+	var sum float64
+	for _, class := range allocation.Classes {
+		if class.Name == "" {
+			return fmt.Errorf("class of %s has no name", path)
+		}
+		if class.Weight < 0 {
+			return fmt.Errorf("weight of %s/%s must not be negative", path, class.Name)
+		}
+		sum += class.Weight
+		if err := class.validate(join(path, class.Name), seen); err != nil {
+			return err
+		}
+	}
+	if math.Abs(sum-1) > 1e-6 {
+		return fmt.Errorf("weights of the classes of %s add up to %v instead of 1", path, sum)
+	}
+	return nil
+}
+
+func join(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "/" + name
+}
+
+// Members Returns the assets of all sleeves in the order of the tree
+func (allocation Allocation) Members() []Asset {
+	assets := append([]Asset{}, allocation.Assets...)
+	for _, class := range allocation.Classes {
+		assets = append(assets, class.Members()...)
+	}
+	return assets
+}
+
+// ClassOf Returns the path of the sleeve that holds the asset, empty if the asset is not part of the allocation
+func (allocation Allocation) ClassOf(asset Asset) string {
+	path, _ := allocation.classOf("", asset)
+	return path
+}
+
+func (allocation Allocation) classOf(path string, asset Asset) (string, bool) {
+	for _, member := range allocation.Assets {
+		if member == asset {
+			return path, true
+		}
+	}
+	for _, class := range allocation.Classes {
+		if classPath, ok := class.classOf(join(path, class.Name), asset); ok {
+			return classPath, true
+		}
+	}
+	return "", false
+}
+
+// Weights Returns the target weights of the assets, the weight of a sleeve goes to its first asset
+func (allocation Allocation) Weights() Weights {
+	weights := Weights{}
+	allocation.weights(1, weights)
+	return weights
+}
+
+func (allocation Allocation) weights(weight float64, weights Weights) {
+	for i, asset := range allocation.Assets {
+		weights[asset] = 0
+		if i == 0 {
+			weights[asset] = weight
+		}
+	}
+	for _, class := range allocation.Classes {
+		class.weights(weight*class.Weight, weights)
+	}
+}
+
+// Flatten Returns every class of the tree below the root with its weight of the total value, parents before their children
+func (allocation Allocation) Flatten() []Class {
+	classes := []Class{}
+	allocation.flatten("", 1, &classes)
+	return classes
+}
+
+func (allocation Allocation) flatten(path string, weight float64, classes *[]Class) {
+	for _, class := range allocation.Classes {
+		classPath := join(path, class.Name)
+		*classes = append(*classes, Class{
+			Path:   classPath,
+			Weight: weight * class.Weight,
+			Assets: class.Members(),
+		})
+		class.flatten(classPath, weight*class.Weight, classes)
+	}
+}
+
+// Resolve Returns the target weights of the assets for the current portfolio. Classes within their bands keep their
+// current shares. Assets of a sleeve other than the first one are kept as long as the sleeve is not overweight, an
+// overweight sleeve is reduced proportionally.
+func (allocation Allocation) Resolve(portfolio Portfolio) (Weights, error) {
+	if err := allocation.Validate(); err != nil {
+		return nil, err
+	}
+	values := map[Asset]float64{}
+	for _, asset := range allocation.Members() {
+		values[asset] = portfolio.Quantities[asset] * portfolio.Prices[asset]
+	}
+	total := allocation.value(values)
+	if total <= 0 {
+		return allocation.Weights(), nil
+	}
+	weights := Weights{}
+	allocation.resolve(values, total, total, weights)
+	return weights, nil
+}
+
+func (allocation Allocation) value(values map[Asset]float64) float64 {
+	var value float64
+	for _, asset := range allocation.Members() {
+		value += values[asset]
+	}
+	return value
+}
+
+func (allocation Allocation) resolve(values map[Asset]float64, target float64, total float64, weights Weights) {
+	if len(allocation.Assets) > 0 {
+		held := allocation.value(values)
+		if held > target {
+			for _, asset := range allocation.Assets {
+				weights[asset] = target * values[asset] / held / total
+			}
+			return
+		}
+		rest := target
+		for _, asset := range allocation.Assets[1:] {
+			weights[asset] = values[asset] / total
+			rest -= values[asset]
+		}
+		weights[allocation.Assets[0]] = rest / total
+		return
+	}
+
+	actual := allocation.value(values)
+	shares := make([]float64, len(allocation.Classes))
+	withinBands := actual > 0
+	for i, class := range allocation.Classes {
+		shares[i] = class.Weight
+		if actual > 0 && (class.Band == 0 || math.Abs(class.value(values)/actual-class.Weight) > class.Band) {
+			withinBands = false
+		}
+	}
+	if withinBands {
+		for i, class := range allocation.Classes {
+			shares[i] = class.value(values) / actual
+		}
+	}
+	for i, class := range allocation.Classes {
+		class.resolve(values, target*shares[i], total, weights)
+	}
+}
@@ -1,6 +1,7 @@
 package model
 
-// Asset Asset
+// Asset Asset. Its asset classes are kept by an Allocation, so assets of a target portfolio stay equal to the ones
+// returned by the brokers.
 type Asset struct {
 	Symbol string
 }
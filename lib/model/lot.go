@@ -0,0 +1,53 @@
+package model
+
+import "time"
+
+const (
+	// LotMethodFIFO Sells the lots that were acquired first
+	LotMethodFIFO LotMethod = iota + 1
+
+	// LotMethodLIFO Sells the lots that were acquired last
+	LotMethodLIFO
+
+	// LotMethodHighestCost Sells the lots with the highest cost per share
+	LotMethodHighestCost
+
+	// LotMethodSpecific Sells the lots given by the order
+	LotMethodSpecific
+
+	// LotMethodMinimumGain Sells the lots that realize the lowest gain, losses first
+	LotMethodMinimumGain
+)
+
+// LotMethod Method to select the lots of a sale
+type LotMethod int
+
+// Lot Shares of an asset that were acquired together
+type Lot struct {
+	ID       string
+	Acquired time.Time
+	Quantity float64
+
+	// Cost Cost per share
+	Cost float64
+}
+
+// RealizedGain Gain or loss realized by selling shares of a lot
+type RealizedGain struct {
+	Asset Asset
+
+	// Lot The sold part of the lot
+	Lot   Lot
+	Price float64
+	Sold  time.Time
+}
+
+// Gain Gain of the sale, negative for a loss
+func (gain RealizedGain) Gain() float64 {
+	return (gain.Price - gain.Lot.Cost) * gain.Lot.Quantity
+}
+
+// IsLongTerm Returns true if the shares were held for more than one year
+func (gain RealizedGain) IsLongTerm() bool {
+	return gain.Sold.After(gain.Lot.Acquired.AddDate(1, 0, 0))
+}
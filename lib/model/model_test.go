@@ -2,6 +2,7 @@ package model_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/MitchK/autorobin/lib/model"
 	"github.com/onsi/gomega"
@@ -39,3 +40,156 @@ func TestDiff(t *testing.T) {
 	g.Expect(diff[model.Asset{Symbol: "F"}]).To(gomega.BeNumerically("~", -0.20))
 
 }
+
+func TestDrift(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	a := model.Asset{Symbol: "A"}
+	b := model.Asset{Symbol: "B"}
+	c := model.Asset{Symbol: "C"}
+	desired := model.Weights{a: 0.5, b: 0.5}
+	actual := model.Weights{a: 0.4, b: 0.5, c: 0.1}
+	g.Expect(desired.Drift(actual)).To(gomega.BeNumerically("~", 0.1))
+	g.Expect(desired.Drift(desired)).To(gomega.BeNumerically("~", 0))
+}
+
+func TestApply(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	a := model.Asset{Symbol: "A"}
+	b := model.Asset{Symbol: "B"}
+	portfolio := model.Portfolio{
+		Weights:    model.Weights{a: 0, b: 1},
+		Quantities: model.Quantities{a: 0, b: 10},
+		Prices:     model.Prices{a: 2, b: 1},
+		TotalValue: 10,
+	}
+
+	applied := portfolio.Apply(
+		model.Order{Asset: a, Type: model.OrderTypeBuy, Quantity: 10, FilledQuantity: 5},
+		model.Order{Asset: b, Type: model.OrderTypeSell, Quantity: 5},
+		model.Order{Asset: model.Asset{Symbol: "C"}, Type: model.OrderTypeBuy, Quantity: 5},
+	)
+	g.Expect(applied.Quantities[a]).To(gomega.BeNumerically("~", 5))
+	g.Expect(applied.Quantities[b]).To(gomega.BeNumerically("~", 5))
+	g.Expect(applied.TotalValue).To(gomega.BeNumerically("~", 15))
+	g.Expect(applied.Weights[a]).To(gomega.BeNumerically("~", 10.0/15))
+	g.Expect(len(applied.Quantities)).To(gomega.Equal(2))
+
+	// original portfolio is untouched
+	g.Expect(portfolio.Quantities[a]).To(gomega.BeNumerically("~", 0))
+	g.Expect(portfolio.TotalValue).To(gomega.BeNumerically("~", 10))
+}
+
+func TestAllocation(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	us := model.Asset{Symbol: "VTI"}
+	usAlt := model.Asset{Symbol: "ITOT"}
+	intl := model.Asset{Symbol: "VXUS"}
+	bonds := model.Asset{Symbol: "BND"}
+	allocation := model.Allocation{
+		Classes: []model.Allocation{
+			{Name: "equities", Weight: 0.6, Band: 0.05, Classes: []model.Allocation{
+				{Name: "us", Weight: 0.7, Band: 0.1, Assets: []model.Asset{us, usAlt}},
+				{Name: "intl", Weight: 0.3, Band: 0.1, Assets: []model.Asset{intl}},
+			}},
+			{Name: "bonds", Weight: 0.4, Band: 0.05, Assets: []model.Asset{bonds}},
+		},
+	}
+	g.Expect(allocation.Validate()).To(gomega.Succeed())
+	g.Expect(allocation.Members()).To(gomega.Equal([]model.Asset{us, usAlt, intl, bonds}))
+
+	// every member is classified by the path of its sleeve
+	g.Expect(allocation.ClassOf(usAlt)).To(gomega.Equal("equities/us"))
+	g.Expect(allocation.ClassOf(bonds)).To(gomega.Equal("bonds"))
+	g.Expect(allocation.ClassOf(model.Asset{Symbol: "X"})).To(gomega.BeEmpty())
+
+	// the weight of a sleeve goes to its first asset
+	weights := allocation.Weights()
+	g.Expect(weights[us]).To(gomega.BeNumerically("~", 0.42))
+	g.Expect(weights[usAlt]).To(gomega.Equal(0.0))
+	g.Expect(weights[intl]).To(gomega.BeNumerically("~", 0.18))
+	g.Expect(weights[bonds]).To(gomega.BeNumerically("~", 0.4))
+
+	classes := allocation.Flatten()
+	g.Expect(classes).To(gomega.HaveLen(4))
+	g.Expect(classes[1].Path).To(gomega.Equal("equities/us"))
+	g.Expect(classes[1].Weight).To(gomega.BeNumerically("~", 0.42))
+	g.Expect(classes[1].Assets).To(gomega.Equal([]model.Asset{us, usAlt}))
+
+	// classes within their bands keep their shares, the held alternative of a sleeve is kept
+	portfolio := model.Portfolio{
+		Quantities: model.Quantities{us: 30, usAlt: 10, intl: 22, bonds: 38},
+		Prices:     model.Prices{us: 1, usAlt: 1, intl: 1, bonds: 1},
+	}
+	weights, err := allocation.Resolve(portfolio)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(weights[us]).To(gomega.BeNumerically("~", 0.30))
+	g.Expect(weights[usAlt]).To(gomega.BeNumerically("~", 0.10))
+	g.Expect(weights[intl]).To(gomega.BeNumerically("~", 0.22))
+	g.Expect(weights[bonds]).To(gomega.BeNumerically("~", 0.38))
+
+	// classes outside their bands are rebalanced, an overweight sleeve is reduced proportionally
+	portfolio.Quantities = model.Quantities{us: 45, usAlt: 15, intl: 10, bonds: 30}
+	weights, err = allocation.Resolve(portfolio)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(weights[us]).To(gomega.BeNumerically("~", 0.42*0.75))
+	g.Expect(weights[usAlt]).To(gomega.BeNumerically("~", 0.42*0.25))
+	g.Expect(weights[intl]).To(gomega.BeNumerically("~", 0.18))
+	g.Expect(weights[bonds]).To(gomega.BeNumerically("~", 0.4))
+
+	// weights of the classes of a node have to add up to 1
+	allocation.Classes[1].Weight = 0.5
+	g.Expect(allocation.Validate()).NotTo(gomega.Succeed())
+}
+
+func TestGlidePath(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	stocks := model.Asset{Symbol: "VTI"}
+	bonds := model.Asset{Symbol: "BND"}
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC)
+	path := model.GlidePath{
+		{Date: start, Weights: model.Weights{stocks: 0.9, bonds: 0.1}},
+		{Date: end, Weights: model.Weights{stocks: 0.4, bonds: 0.6}},
+	}
+	g.Expect(path.Validate()).To(gomega.Succeed())
+	g.Expect(path.Assets()).To(gomega.Equal([]model.Asset{bonds, stocks}))
+
+	// should interpolate linearly between the waypoints and keep the outer weights before and after them
+	middle := start.Add(end.Sub(start) / 2)
+	g.Expect(path.Weights(middle)[stocks]).To(gomega.BeNumerically("~", 0.65))
+	g.Expect(path.Weights(middle)[bonds]).To(gomega.BeNumerically("~", 0.35))
+	g.Expect(path.Weights(start.AddDate(-1, 0, 0))[stocks]).To(gomega.BeNumerically("~", 0.9))
+	g.Expect(path.Weights(end.AddDate(1, 0, 0))[bonds]).To(gomega.BeNumerically("~", 0.6))
+
+	path[1].Date = start
+	g.Expect(path.Validate()).NotTo(gomega.Succeed())
+}
+
+func TestAgeRule(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	us := model.Asset{Symbol: "VTI"}
+	intl := model.Asset{Symbol: "VXUS"}
+	bonds := model.Asset{Symbol: "BND"}
+	rule := model.AgeRule{
+		Birth:  time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC),
+		Offset: 20,
+		Stocks: model.Weights{us: 0.7, intl: 0.3},
+		Bonds:  model.Weights{bonds: 1},
+	}
+	g.Expect(rule.Validate()).To(gomega.Succeed())
+
+	// should hold the age minus 20 percent in bonds
+	weights := rule.Weights(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	g.Expect(weights[bonds]).To(gomega.BeNumerically("~", 0.2, 1e-3))
+	g.Expect(weights[us]).To(gomega.BeNumerically("~", 0.56, 1e-3))
+	g.Expect(weights[intl]).To(gomega.BeNumerically("~", 0.24, 1e-3))
+	g.Expect(rule.BondShare(time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC))).To(gomega.Equal(0.0))
+
+	rule.Bonds = model.Weights{us: 1}
+	g.Expect(rule.Validate()).NotTo(gomega.Succeed())
+}
@@ -1,5 +1,7 @@
 package model
 
+import "time"
+
 const (
 	// OrderTypeBuy OrderTypeBuy
 	OrderTypeBuy OrderType = iota + 1
@@ -8,14 +10,63 @@ const (
 	OrderTypeSell
 )
 
+const (
+	// OrderStatusOpen Order was accepted by the broker and waits to be filled
+	OrderStatusOpen OrderStatus = iota + 1
+
+	// OrderStatusFilled Order was filled completely
+	OrderStatusFilled
+
+	// OrderStatusCancelled Order was cancelled, it may have been filled partially
+	OrderStatusCancelled
+
+	// OrderStatusRejected Order was rejected by the broker
+	OrderStatusRejected
+)
+
 // OrderType OrderType
 type OrderType int
 
+// OrderStatus OrderStatus
+type OrderStatus int
+
 // Order Order
 type Order struct {
+	ID          string
 	Description string
 	Type        OrderType
 	Asset       Asset
 	Price       float64
 	Quantity    float64
+
+	// LotMethod Selects the lots of a sell order, brokers that do not track lots ignore it. The broker's default is used if not set.
+	LotMethod LotMethod
+
+	// LotIDs Lots to sell with LotMethodSpecific
+	LotIDs []string
+
+	// Only set for orders that were submitted to a broker
+	Status         OrderStatus
+	FilledQuantity float64
+	FilledPrice    float64
+
+	// FilledAt Time of the last fill
+	FilledAt time.Time
+}
+
+// IsDone Returns true if the order will not be filled any further
+func (order Order) IsDone() bool {
+	return order.Status == OrderStatusFilled ||
+		order.Status == OrderStatusCancelled ||
+		order.Status == OrderStatusRejected
+}
+
+// RemainingQuantity Quantity that still waits to be filled
+func (order Order) RemainingQuantity() float64 {
+	return order.Quantity - order.FilledQuantity
+}
+
+// Value Value of the order at its limit price
+func (order Order) Value() float64 {
+	return order.Quantity * order.Price
 }
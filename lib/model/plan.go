@@ -0,0 +1,47 @@
+package model
+
+// Plan Orders created by a rebalance, including the orders that were dropped, and the cash and value of the portfolio
+// they were created for
+type Plan struct {
+	Orders  []Order
+	Dropped []DroppedOrder
+
+	// Cash Cash of the account that was not allocated yet
+	Cash float64
+
+	// PortfolioValue Value of the positions of the assets at the broker
+	PortfolioValue float64
+
+	// UntargetedValue Value of the positions of assets that are not part of the desired portfolio, included in the portfolio value
+	UntargetedValue float64
+
+	// OpenOrders Number of open orders that are treated as if they were filled
+	OpenOrders int
+
+	// NettedValue Value of the positions including the open orders
+	NettedValue float64
+
+	// Reserve Cash that is kept out of the market
+	Reserve float64
+
+	// Withdrawal Cash that is raised for a withdrawal
+	Withdrawal float64
+
+	// Investable Cash that is available for purchases
+	Investable float64
+}
+
+// DroppedOrder Order that was dropped from a plan and the reason why
+type DroppedOrder struct {
+	Order  Order
+	Reason string
+}
+
+// DroppedValue Returns the total value of all dropped orders
+func (plan Plan) DroppedValue() float64 {
+	var value float64
+	for _, dropped := range plan.Dropped {
+		value += dropped.Order.Value()
+	}
+	return value
+}
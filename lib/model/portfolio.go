@@ -11,3 +11,42 @@ type Portfolio struct {
 	Prices     Prices
 	TotalValue float64
 }
+
+// Apply Returns a copy of the portfolio as if the remaining quantities of the given orders were filled.
+// Orders of assets that are not part of the portfolio are ignored.
+func (portfolio Portfolio) Apply(orders ...Order) Portfolio {
+	quantities := Quantities{}
+	for asset, quantity := range portfolio.Quantities {
+		quantities[asset] = quantity
+	}
+	for _, order := range orders {
+		if _, ok := portfolio.Prices[order.Asset]; !ok {
+			continue
+		}
+		if order.Type == OrderTypeBuy {
+			quantities[order.Asset] += order.RemainingQuantity()
+		} else if order.Type == OrderTypeSell {
+			quantities[order.Asset] -= order.RemainingQuantity()
+		}
+	}
+
+	var total float64
+	for asset, quantity := range quantities {
+		total += quantity * portfolio.Prices[asset]
+	}
+	weights := Weights{}
+	for asset, quantity := range quantities {
+		if total == 0 {
+			weights[asset] = 0
+		} else {
+			weights[asset] = quantity * portfolio.Prices[asset] / total
+		}
+	}
+
+	return Portfolio{
+		Weights:    weights,
+		Quantities: quantities,
+		Prices:     portfolio.Prices,
+		TotalValue: total,
+	}
+}
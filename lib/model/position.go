@@ -5,4 +5,7 @@ type Position struct {
 	Asset       Asset
 	Quantity    float64
 	AvgBuyPrice float64
+
+	// Lots Tax lots of the position, only set by brokers that track them
+	Lots []Lot
 }
@@ -7,4 +7,24 @@ type Quote struct {
 	Asset Asset
 	Price float64
 	Date  time.Time
+
+	// Bid Ask Last Live prices of the asset, 0 if the broker does not report them, e.g. because Price already is the last trade price
+	Bid  float64
+	Ask  float64
+	Last float64
+}
+
+// Live Returns the price an order of the given type would trade at right now: the ask for buys and the bid for sells.
+// It falls back to the last trade price and then to Price if the broker does not report them.
+func (quote Quote) Live(orderType OrderType) float64 {
+	if orderType == OrderTypeBuy && quote.Ask > 0 {
+		return quote.Ask
+	}
+	if orderType == OrderTypeSell && quote.Bid > 0 {
+		return quote.Bid
+	}
+	if quote.Last > 0 {
+		return quote.Last
+	}
+	return quote.Price
 }
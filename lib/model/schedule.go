@@ -0,0 +1,156 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Schedule Target weights that change over time, e.g. a glide path that de-risks a retirement account
+type Schedule interface {
+	// Validate Returns an error if the schedule does not define valid weights
+	Validate() error
+
+	// Weights Returns the target weights on the date
+	Weights(date time.Time) Weights
+
+	// Assets Returns every asset that has a weight on any date
+	Assets() []Asset
+}
+
+// Waypoint Target weights from a date on
+type Waypoint struct {
+	Date    time.Time
+	Weights Weights
+}
+
+// GlidePath Waypoints of target weights, the weights between two waypoints are interpolated linearly.
+// The weights of the first waypoint apply before it, the ones of the last waypoint after it.
+type GlidePath []Waypoint
+
+// Validate Returns an error if there are no waypoints, they are not in order or their weights do not add up to 1
+func (path GlidePath) Validate() error {
+	if len(path) == 0 {
+		return errors.New("glide path has no waypoints")
+	}
+	for i, waypoint := range path {
+		if i > 0 && !waypoint.Date.After(path[i-1].Date) {
+			return fmt.Errorf("waypoint of %s is not after the previous one", waypoint.Date.Format("2006-01-02"))
+		}
+		if err := validateWeights(waypoint.Weights); err != nil {
+			return fmt.Errorf("waypoint of %s: %v", waypoint.Date.Format("2006-01-02"), err)
+		}
+	}
+	return nil
+}
+
+// Weights Weights
+func (path GlidePath) Weights(date time.Time) Weights {
+	if len(path) == 0 {
+		return Weights{}
+	}
+	i := sort.Search(len(path), func(i int) bool {
+		return path[i].Date.After(date)
+	})
+	if i == 0 {
+		return path[0].Weights.copy()
+	}
+	if i == len(path) {
+		return path[i-1].Weights.copy()
+	}
+	from, to := path[i-1], path[i]
+	progress := float64(date.Sub(from.Date)) / float64(to.Date.Sub(from.Date))
+	weights := Weights{}
+	for _, asset := range path.Assets() {
+		weights[asset] = from.Weights[asset] + (to.Weights[asset]-from.Weights[asset])*progress
+	}
+	return weights
+}
+
+// Assets Returns the assets of all waypoints, sorted by symbol
+func (path GlidePath) Assets() []Asset {
+	weights := Weights{}
+	for _, waypoint := range path {
+		for asset := range waypoint.Weights {
+			weights[asset] = 0
+		}
+	}
+	return weights.Assets()
+}
+
+// AgeRule Splits the portfolio into bonds and stocks by age, e.g. a bond percentage of the age minus 20
+type AgeRule struct {
+	Birth time.Time
+
+	// Offset Years that are subtracted from the age to get the bond percentage
+	Offset float64
+
+	// Stocks Weights of the stock part, they add up to 1
+	Stocks Weights
+
+	// Bonds Weights of the bond part, they add up to 1
+	Bonds Weights
+}
+
+// Validate Returns an error if the weights of stocks or bonds do not add up to 1 or an asset is part of both
+func (rule AgeRule) Validate() error {
+	if err := validateWeights(rule.Stocks); err != nil {
+		return fmt.Errorf("stocks: %v", err)
+	}
+	if err := validateWeights(rule.Bonds); err != nil {
+		return fmt.Errorf("bonds: %v", err)
+	}
+	for asset := range rule.Stocks {
+		if _, ok := rule.Bonds[asset]; ok {
+			return fmt.Errorf("%s cannot be both a stock and a bond", asset.Symbol)
+		}
+	}
+	return nil
+}
+
+// BondShare Returns the share of bonds on the date, between 0 and 1
+func (rule AgeRule) BondShare(date time.Time) float64 {
+	age := date.Sub(rule.Birth).Hours() / 24 / 365.25
+	return math.Max(0, math.Min(1, (age-rule.Offset)/100))
+}
+
+// Weights Weights
+func (rule AgeRule) Weights(date time.Time) Weights {
+	bonds := rule.BondShare(date)
+	weights := Weights{}
+	for asset, weight := range rule.Stocks {
+		weights[asset] = weight * (1 - bonds)
+	}
+	for asset, weight := range rule.Bonds {
+		weights[asset] = weight * bonds
+	}
+	return weights
+}
+
+// Assets Returns the stocks and bonds, sorted by symbol
+func (rule AgeRule) Assets() []Asset {
+	weights := Weights{}
+	for asset := range rule.Stocks {
+		weights[asset] = 0
+	}
+	for asset := range rule.Bonds {
+		weights[asset] = 0
+	}
+	return weights.Assets()
+}
+
+func validateWeights(weights Weights) error {
+	var sum float64
+	for asset, weight := range weights {
+		if weight < 0 {
+			return fmt.Errorf("weight of %s must not be negative", asset.Symbol)
+		}
+		sum += weight
+	}
+	if math.Abs(sum-1) > 1e-6 {
+		return fmt.Errorf("weights add up to %v instead of 1", sum)
+	}
+	return nil
+}
@@ -1,5 +1,10 @@
 package model
 
+import (
+	"math"
+	"sort"
+)
+
 // Weights Weights
 type Weights map[Asset]float64
 
@@ -18,3 +23,32 @@ func (weights Weights) Diff(otherWeights Weights) WeightsDiff {
 	}
 	return diff
 }
+
+// Drift Share of the value that would have to be moved to turn the other weights into these weights, i.e. half the sum of the absolute differences
+func (weights Weights) Drift(otherWeights Weights) float64 {
+	var drift float64
+	for _, diff := range weights.Diff(otherWeights) {
+		drift += math.Abs(diff)
+	}
+	return drift / 2
+}
+
+// Assets Returns the assets of the weights, sorted by symbol
+func (weights Weights) Assets() []Asset {
+	assets := []Asset{}
+	for asset := range weights {
+		assets = append(assets, asset)
+	}
+	sort.Slice(assets, func(i, j int) bool {
+		return assets[i].Symbol < assets[j].Symbol
+	})
+	return assets
+}
+
+func (weights Weights) copy() Weights {
+	copied := Weights{}
+	for asset, weight := range weights {
+		copied[asset] = weight
+	}
+	return copied
+}
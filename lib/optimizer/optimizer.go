@@ -0,0 +1,318 @@
+package optimizer
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/MitchK/autorobin/lib/model"
+	"github.com/MitchK/autorobin/lib/weighting"
+	"gonum.org/v1/gonum/mat"
+)
+
+// TradingDays Number of trading days per year the daily estimates are annualized with
+const TradingDays = 252
+
+// Estimates Annualized expected returns and covariance matrix of the returns of assets
+type Estimates struct {
+	Assets     []model.Asset
+	Returns    *mat.VecDense
+	Covariance *mat.SymDense
+}
+
+// Estimate Returns the annualized mean and covariance of the daily returns of the assets
+func Estimate(assets []model.Asset, history [][]model.Quote) (Estimates, error) {
+	returns, err := weighting.Returns(assets, history)
+	if err != nil {
+		return Estimates{}, err
+	}
+	n, periods := len(assets), len(returns[0])
+	means := mat.NewVecDense(n, nil)
+	centered := mat.NewDense(n, periods, nil)
+	for i, r := range returns {
+		var mean float64
+		for _, value := range r {
+			mean += value / float64(periods)
+		}
+		means.SetVec(i, mean*TradingDays)
+		for t, value := range r {
+			centered.Set(i, t, value-mean)
+		}
+	}
+	covariance := &mat.SymDense{}
+	covariance.SymOuterK(TradingDays/float64(periods-1), centered)
+	return Estimates{
+		Assets:     assets,
+		Returns:    means,
+		Covariance: covariance,
+	}, nil
+}
+
+// Options Constraints of the optimized portfolios, short positions are never allowed
+type Options struct {
+	// MinWeight Lower bound of the weight of every asset
+	MinWeight float64
+
+	// MaxWeight Upper bound of the weight of every asset, 1 if not set
+	MaxWeight float64
+
+	// RiskFree Annual risk-free rate of the Sharpe ratio, e.g. 0.02
+	RiskFree float64
+
+	// Points Number of portfolios of the efficient frontier including the minimum variance and maximum return portfolios,
+	// 50 if not set
+	Points int
+}
+
+func (options Options) withDefaults() Options {
+	if options.MaxWeight == 0 {
+		options.MaxWeight = 1
+	}
+	if options.Points == 0 {
+		options.Points = 50
+	}
+	return options
+}
+
+func (options Options) validate(n int) error {
+	if options.MinWeight < 0 {
+		return errors.New("minimum weight must not be negative, short positions are not allowed")
+	}
+	if options.MaxWeight > 1 || options.MaxWeight < options.MinWeight {
+		return errors.New("maximum weight must be between the minimum weight and 1")
+	}
+	if float64(n)*options.MinWeight > 1+1e-9 || float64(n)*options.MaxWeight < 1-1e-9 {
+		return fmt.Errorf("the weights of %d assets cannot add up to 1 between %v and %v", n, options.MinWeight, options.MaxWeight)
+	}
+	if options.Points < 3 {
+		return errors.New("the frontier needs at least 3 points")
+	}
+	return nil
+}
+
+// Portfolio Portfolio of the efficient frontier with its annualized expected return and volatility
+type Portfolio struct {
+	Weights    model.Weights
+	Return     float64
+	Volatility float64
+	Sharpe     float64
+}
+
+// Frontier Efficient frontier of a set of assets
+type Frontier struct {
+	// Portfolios Portfolios of the frontier from the lowest to the highest volatility
+	Portfolios []Portfolio
+
+	// MinVariance Portfolio with the lowest volatility
+	MinVariance Portfolio
+
+	// MaxSharpe Portfolio with the highest Sharpe ratio
+	MaxSharpe Portfolio
+}
+
+// maxIterations Upper bound for the iterations of the solver
+const maxIterations = 100000
+
+// tolerance Largest change of a weight between two iterations at which the solver has converged
+const tolerance = 1e-12
+
+// solver Maximizes the expected return minus the variance weighted with a risk aversion within the bounds of the weights
+type solver struct {
+	estimates Estimates
+	options   Options
+
+	// largest eigenvalue of the covariance matrix, the gradient is Lipschitz continuous with it
+	eigenvalue float64
+}
+
+// Optimize Returns the efficient frontier of the assets within the bounds of the options. The portfolios maximize the
+// expected return minus the variance weighted with a range of risk aversions, the maximum Sharpe ratio is refined
+// between the two portfolios next to the best one.
+func Optimize(estimates Estimates, options Options) (Frontier, error) {
+	options = options.withDefaults()
+	n := len(estimates.Assets)
+	if n == 0 {
+		return Frontier{}, errors.New("no assets to optimize")
+	}
+	if err := options.validate(n); err != nil {
+		return Frontier{}, err
+	}
+	var eigen mat.EigenSym
+	if !eigen.Factorize(estimates.Covariance, false) {
+		return Frontier{}, errors.New("could not factorize the covariance matrix")
+	}
+	solver := &solver{
+		estimates: estimates,
+		options:   options,
+	}
+	for _, value := range eigen.Values(nil) {
+		solver.eigenvalue = math.Max(solver.eigenvalue, value)
+	}
+
+	frontier := Frontier{
+		MinVariance: solver.portfolio(solver.solve(1, 0)),
+	}
+
+	// risk aversions from the one that balances the spread of the returns with the largest variance downwards,
+	// the last portfolio maximizes the return
+	spread := mat.Max(estimates.Returns) - mat.Min(estimates.Returns)
+	scale := math.Max(spread, 1e-6) / math.Max(solver.eigenvalue, 1e-12)
+	aversions := make([]float64, options.Points-2)
+	for i := range aversions {
+		aversions[i] = scale * math.Pow(10, 3-5*float64(i)/math.Max(float64(len(aversions)-1), 1))
+	}
+	frontier.Portfolios = append(frontier.Portfolios, frontier.MinVariance)
+	for _, aversion := range aversions {
+		frontier.Portfolios = append(frontier.Portfolios, solver.portfolio(solver.solve(aversion, 1)))
+	}
+	frontier.Portfolios = append(frontier.Portfolios, solver.portfolio(solver.solve(0, 1)))
+
+	best := 0
+	for i, portfolio := range frontier.Portfolios {
+		if portfolio.Sharpe > frontier.Portfolios[best].Sharpe {
+			best = i
+		}
+	}
+	frontier.MaxSharpe = frontier.Portfolios[best]
+	if best > 1 && best < len(frontier.Portfolios)-2 {
+		if refined := solver.maxSharpe(aversions[best-2], aversions[best]); refined.Sharpe > frontier.MaxSharpe.Sharpe {
+			frontier.MaxSharpe = refined
+		}
+	}
+	return frontier, nil
+}
+
+// maxSharpe Returns the portfolio with the highest Sharpe ratio between two risk aversions by golden-section search
+func (solver *solver) maxSharpe(high float64, low float64) Portfolio {
+	ratio := (math.Sqrt(5) - 1) / 2
+	a, b := math.Log(low), math.Log(high)
+	sharpe := func(x float64) Portfolio {
+		return solver.portfolio(solver.solve(math.Exp(x), 1))
+	}
+	c, d := b-ratio*(b-a), a+ratio*(b-a)
+	pc, pd := sharpe(c), sharpe(d)
+	for i := 0; i < 40; i++ {
+		if pc.Sharpe > pd.Sharpe {
+			b, d, pd = d, c, pc
+			c = b - ratio*(b-a)
+			pc = sharpe(c)
+		} else {
+			a, c, pc = c, d, pd
+			d = a + ratio*(b-a)
+			pd = sharpe(d)
+		}
+	}
+	if pc.Sharpe > pd.Sharpe {
+		return pc
+	}
+	return pd
+}
+
+// solve Returns the weights that minimize the variance weighted with the risk aversion minus the weighted expected
+// return by accelerated projected gradient descent
+func (solver *solver) solve(aversion float64, returnWeight float64) *mat.VecDense {
+	n := len(solver.estimates.Assets)
+	if aversion == 0 {
+		return solver.maxReturn()
+	}
+	step := 1 / math.Max(aversion*solver.eigenvalue, 1e-12)
+	uniform := make([]float64, n)
+	for i := range uniform {
+		uniform[i] = 1 / float64(n)
+	}
+	x := mat.NewVecDense(n, solver.project(uniform))
+	y := mat.VecDenseCopyOf(x)
+	gradient := mat.NewVecDense(n, nil)
+	t := 1.0
+	for iteration := 0; iteration < maxIterations; iteration++ {
+		gradient.MulVec(solver.estimates.Covariance, y)
+		gradient.ScaleVec(aversion, gradient)
+		gradient.AddScaledVec(gradient, -returnWeight, solver.estimates.Returns)
+		values := make([]float64, n)
+		for i := range values {
+			values[i] = y.AtVec(i) - step*gradient.AtVec(i)
+		}
+		next := mat.NewVecDense(n, solver.project(values))
+		nextT := (1 + math.Sqrt(1+4*t*t)) / 2
+		change := 0.0
+		for i := 0; i < n; i++ {
+			change = math.Max(change, math.Abs(next.AtVec(i)-x.AtVec(i)))
+			y.SetVec(i, next.AtVec(i)+(t-1)/nextT*(next.AtVec(i)-x.AtVec(i)))
+		}
+		x, t = next, nextT
+		if change < tolerance {
+			break
+		}
+	}
+	return x
+}
+
+// maxReturn Returns the weights with the highest expected return, the assets with the highest returns get the maximum weight
+func (solver *solver) maxReturn() *mat.VecDense {
+	n := len(solver.estimates.Assets)
+	weights := mat.NewVecDense(n, nil)
+	order := make([]int, n)
+	rest := 1.0
+	for i := range order {
+		order[i] = i
+		weights.SetVec(i, solver.options.MinWeight)
+		rest -= solver.options.MinWeight
+	}
+	for i := 1; i < n; i++ {
+		for j := i; j > 0 && solver.estimates.Returns.AtVec(order[j]) > solver.estimates.Returns.AtVec(order[j-1]); j-- {
+			order[j], order[j-1] = order[j-1], order[j]
+		}
+	}
+	for _, i := range order {
+		add := math.Min(rest, solver.options.MaxWeight-solver.options.MinWeight)
+		weights.SetVec(i, weights.AtVec(i)+add)
+		rest -= add
+	}
+	return weights
+}
+
+// project Returns the closest weights to the values that add up to 1 within the bounds, the shift of the values is
+// found by bisection
+func (solver *solver) project(values []float64) []float64 {
+	low, high := solver.options.MinWeight, solver.options.MaxWeight
+	clip := func(shift float64) ([]float64, float64) {
+		weights := make([]float64, len(values))
+		var sum float64
+		for i, value := range values {
+			weights[i] = math.Max(low, math.Min(high, value-shift))
+			sum += weights[i]
+		}
+		return weights, sum
+	}
+	lower, upper := math.Inf(1), math.Inf(-1)
+	for _, value := range values {
+		lower = math.Min(lower, value-high)
+		upper = math.Max(upper, value-low)
+	}
+	for i := 0; i < 200; i++ {
+		shift := (lower + upper) / 2
+		if _, sum := clip(shift); sum > 1 {
+			lower = shift
+		} else {
+			upper = shift
+		}
+	}
+	weights, _ := clip((lower + upper) / 2)
+	return weights
+}
+
+// portfolio Returns the weights with their expected return, volatility and Sharpe ratio
+func (solver *solver) portfolio(weights *mat.VecDense) Portfolio {
+	portfolio := Portfolio{
+		Weights:    model.Weights{},
+		Return:     mat.Dot(weights, solver.estimates.Returns),
+		Volatility: math.Sqrt(math.Max(0, mat.Inner(weights, solver.estimates.Covariance, weights))),
+	}
+	for i, asset := range solver.estimates.Assets {
+		portfolio.Weights[asset] = weights.AtVec(i)
+	}
+	if portfolio.Volatility > 0 {
+		portfolio.Sharpe = (portfolio.Return - solver.options.RiskFree) / portfolio.Volatility
+	}
+	return portfolio
+}
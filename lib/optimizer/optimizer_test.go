@@ -0,0 +1,74 @@
+package optimizer_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MitchK/autorobin/lib/model"
+	"github.com/MitchK/autorobin/lib/optimizer"
+	"github.com/onsi/gomega"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestEstimate(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	a := model.Asset{Symbol: "A"}
+	date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	quotes := []model.Quote{}
+	for i, price := range []float64{100, 101, 100, 101, 100} {
+		quotes = append(quotes, model.Quote{Asset: a, Date: date.AddDate(0, 0, i), Price: price})
+	}
+
+	// should annualize the mean and variance of the daily returns
+	estimates, err := optimizer.Estimate([]model.Asset{a}, [][]model.Quote{quotes})
+	g.Expect(err).To(gomega.BeNil())
+	up, down := 0.01, 100.0/101-1
+	mean := (up + down) / 2
+	variance := 2 * ((up-mean)*(up-mean) + (down-mean)*(down-mean)) / 3
+	g.Expect(estimates.Returns.AtVec(0)).To(gomega.BeNumerically("~", mean*optimizer.TradingDays, 1e-9))
+	g.Expect(estimates.Covariance.At(0, 0)).To(gomega.BeNumerically("~", variance*optimizer.TradingDays, 1e-9))
+}
+
+func TestOptimize(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	// uncorrelated assets, b has twice the return and twice the volatility of a
+	a := model.Asset{Symbol: "A"}
+	b := model.Asset{Symbol: "B"}
+	estimates := optimizer.Estimates{
+		Assets:     []model.Asset{a, b},
+		Returns:    mat.NewVecDense(2, []float64{0.05, 0.1}),
+		Covariance: mat.NewSymDense(2, []float64{0.01, 0, 0, 0.04}),
+	}
+
+	// should weight the minimum variance portfolio by the inverse variance and the tangency portfolio by the
+	// inverse covariance times the returns
+	frontier, err := optimizer.Optimize(estimates, optimizer.Options{})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(frontier.Portfolios).To(gomega.HaveLen(50))
+	g.Expect(frontier.MinVariance.Weights[a]).To(gomega.BeNumerically("~", 0.8, 1e-6))
+	g.Expect(frontier.MinVariance.Weights[b]).To(gomega.BeNumerically("~", 0.2, 1e-6))
+	g.Expect(frontier.MaxSharpe.Weights[a]).To(gomega.BeNumerically("~", 2.0/3, 1e-4))
+	g.Expect(frontier.MaxSharpe.Weights[b]).To(gomega.BeNumerically("~", 1.0/3, 1e-4))
+	g.Expect(frontier.Portfolios[0]).To(gomega.Equal(frontier.MinVariance))
+	last := frontier.Portfolios[len(frontier.Portfolios)-1]
+	g.Expect(last.Weights[b]).To(gomega.BeNumerically("~", 1))
+	g.Expect(last.Return).To(gomega.BeNumerically("~", 0.1))
+	for i := 1; i < len(frontier.Portfolios); i++ {
+		g.Expect(frontier.Portfolios[i].Volatility).To(gomega.BeNumerically(">=", frontier.Portfolios[i-1].Volatility-1e-9))
+	}
+
+	// should keep the weights within the bounds
+	frontier, err = optimizer.Optimize(estimates, optimizer.Options{MinWeight: 0.1, MaxWeight: 0.7})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(frontier.MinVariance.Weights[a]).To(gomega.BeNumerically("~", 0.7, 1e-6))
+	last = frontier.Portfolios[len(frontier.Portfolios)-1]
+	g.Expect(last.Weights[b]).To(gomega.BeNumerically("~", 0.7, 1e-6))
+
+	// should reject bounds that cannot be met
+	_, err = optimizer.Optimize(estimates, optimizer.Options{MaxWeight: 0.4})
+	g.Expect(err).NotTo(gomega.BeNil())
+	_, err = optimizer.Optimize(estimates, optimizer.Options{MinWeight: -0.1})
+	g.Expect(err).NotTo(gomega.BeNil())
+}
@@ -0,0 +1,115 @@
+package glidepath
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/MitchK/autorobin/lib/model"
+	"github.com/MitchK/autorobin/lib/portfolioparser"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const dateLayout = "2006-01-02"
+
+type weights map[string]portfolioparser.Share
+
+func (w weights) weights() model.Weights {
+	weights := model.Weights{}
+	for symbol, share := range w {
+		weights[model.Asset{Symbol: strings.TrimSpace(symbol)}] = float64(share)
+	}
+	return weights
+}
+
+type waypoint struct {
+	Date    string  `yaml:"date"`
+	Weights weights `yaml:"weights"`
+}
+
+type age struct {
+	Birth  string  `yaml:"birth"`
+	Offset float64 `yaml:"offset"`
+	Stocks weights `yaml:"stocks"`
+	Bonds  weights `yaml:"bonds"`
+}
+
+// file Either waypoints or an age rule
+type file struct {
+	Waypoints []waypoint `yaml:"waypoints"`
+	Age       *age       `yaml:"age"`
+}
+
+func (f file) schedule() (model.Schedule, error) {
+	if len(f.Waypoints) > 0 && f.Age != nil {
+		return nil, errors.New("waypoints cannot be combined with an age rule")
+	}
+	if f.Age != nil {
+		birth, err := time.Parse(dateLayout, f.Age.Birth)
+		if err != nil {
+			return nil, fmt.Errorf("invalid birth date %q", f.Age.Birth)
+		}
+		return model.AgeRule{
+			Birth:  birth,
+			Offset: f.Age.Offset,
+			Stocks: f.Age.Stocks.weights(),
+			Bonds:  f.Age.Bonds.weights(),
+		}, nil
+	}
+	path := model.GlidePath{}
+	for _, w := range f.Waypoints {
+		date, err := time.Parse(dateLayout, w.Date)
+		if err != nil {
+			return nil, fmt.Errorf("invalid waypoint date %q", w.Date)
+		}
+		path = append(path, model.Waypoint{
+			Date:    date,
+			Weights: w.Weights.weights(),
+		})
+	}
+	return path, nil
+}
+
+type parser struct {
+	now func() time.Time
+}
+
+// NewParser Returns a parser of YAML files with a glide path of waypoints or an age rule, see README.
+// Parse returns the weights of the current day.
+func NewParser() portfolioparser.ScheduleParser {
+	return &parser{
+		now: time.Now,
+	}
+}
+
+// ParseSchedule ParseSchedule
+func (parser *parser) ParseSchedule(reader io.Reader) (model.Schedule, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	var f file
+	if err := yaml.UnmarshalStrict(data, &f); err != nil {
+		return nil, fmt.Errorf("yaml parser: %v", err)
+	}
+	schedule, err := f.schedule()
+	if err != nil {
+		return nil, fmt.Errorf("yaml parser: %v", err)
+	}
+	if err := schedule.Validate(); err != nil {
+		return nil, fmt.Errorf("yaml parser: %v", err)
+	}
+	return schedule, nil
+}
+
+// Parse Returns the target weights of the current day
+func (parser *parser) Parse(reader io.Reader) (model.Weights, []model.Asset, error) {
+	schedule, err := parser.ParseSchedule(reader)
+	if err != nil {
+		return model.Weights{}, nil, err
+	}
+	return schedule.Weights(parser.now()), schedule.Assets(), nil
+}
@@ -0,0 +1,60 @@
+package glidepath_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MitchK/autorobin/lib/model"
+	"github.com/MitchK/autorobin/lib/portfolioparser/glidepath"
+	"github.com/onsi/gomega"
+)
+
+func TestParse(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	vti := model.Asset{Symbol: "VTI"}
+	bnd := model.Asset{Symbol: "BND"}
+
+	// should parse waypoints with percentages and fractions
+	file, err := os.Open(filepath.Join("fixtures", "test.yaml"))
+	g.Expect(err).To(gomega.BeNil())
+	defer file.Close()
+	schedule, err := glidepath.NewParser().ParseSchedule(file)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(schedule).To(gomega.BeAssignableToTypeOf(model.GlidePath{}))
+	path := schedule.(model.GlidePath)
+	g.Expect(path).To(gomega.HaveLen(2))
+	g.Expect(path[0].Date).To(gomega.Equal(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)))
+	g.Expect(path[0].Weights[vti]).To(gomega.BeNumerically("~", 0.9))
+	g.Expect(path[1].Weights[bnd]).To(gomega.BeNumerically("~", 0.6))
+	g.Expect(schedule.Assets()).To(gomega.Equal([]model.Asset{bnd, vti}))
+
+	// should parse an age rule
+	schedule, err = glidepath.NewParser().ParseSchedule(strings.NewReader("age: {birth: 1980-01-01, offset: 20, stocks: {VTI: 100%}, bonds: {BND: 100%}}"))
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(schedule).To(gomega.Equal(model.AgeRule{
+		Birth:  time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC),
+		Offset: 20,
+		Stocks: model.Weights{vti: 1},
+		Bonds:  model.Weights{bnd: 1},
+	}))
+
+	// should return the weights of the current day
+	weights, assets, err := glidepath.NewParser().Parse(strings.NewReader("waypoints: [{date: 2020-01-01, weights: {VTI: 100%}}]"))
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(assets).To(gomega.Equal([]model.Asset{vti}))
+	g.Expect(weights[vti]).To(gomega.BeNumerically("~", 1))
+
+	// should reject invalid schedules
+	_, err = glidepath.NewParser().ParseSchedule(strings.NewReader("waypoints: [{date: 2020-01-01, weights: {VTI: 90%}}]"))
+	g.Expect(err).NotTo(gomega.BeNil())
+	_, err = glidepath.NewParser().ParseSchedule(strings.NewReader("waypoints: [{date: 01/01/2020, weights: {VTI: 100%}}]"))
+	g.Expect(err).NotTo(gomega.BeNil())
+	_, err = glidepath.NewParser().ParseSchedule(strings.NewReader("age: {birth: 1980-01-01, stocks: {VTI: 100%}, bonds: {VTI: 100%}}"))
+	g.Expect(err).NotTo(gomega.BeNil())
+	_, err = glidepath.NewParser().ParseSchedule(strings.NewReader("waypoints: []"))
+	g.Expect(err).NotTo(gomega.BeNil())
+}
@@ -1,7 +1,11 @@
 package portfolioparser
 
 import (
+	"fmt"
 	"io"
+	"math"
+	"strconv"
+	"strings"
 
 	"github.com/MitchK/autorobin/lib/model"
 )
@@ -10,3 +14,42 @@ import (
 type Parser interface {
 	Parse(reader io.Reader) (model.Weights, []model.Asset, error)
 }
+
+// AllocationParser Parser of portfolio files that describe a hierarchical allocation of asset classes
+type AllocationParser interface {
+	Parser
+	ParseAllocation(reader io.Reader) (model.Allocation, error)
+}
+
+// ScheduleParser Parser of portfolio files that describe target weights that change over time
+type ScheduleParser interface {
+	Parser
+	ParseSchedule(reader io.Reader) (model.Schedule, error)
+}
+
+// Share Weight or band of a YAML file, either a fraction (0.6) or a percentage ("60%")
+type Share float64
+
+// UnmarshalYAML UnmarshalYAML
+func (s *Share) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var str string
+	if err := unmarshal(&str); err != nil {
+		return err
+	}
+	str = strings.TrimSpace(str)
+	percentage := strings.HasSuffix(str, "%")
+	value, err := strconv.ParseFloat(strings.TrimSuffix(str, "%"), 64)
+	if err != nil {
+		return fmt.Errorf("invalid weight %q", str)
+	}
+	if percentage {
+		value /= 100
+	}
+	*s = Share(value)
+	return nil
+}
+
+// MarshalYAML Writes the share as a percentage
+func (s Share) MarshalYAML() (interface{}, error) {
+	return strconv.FormatFloat(math.Round(float64(s)*1e8)/1e6, 'f', -1, 64) + "%", nil
+}
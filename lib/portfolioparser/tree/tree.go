@@ -0,0 +1,93 @@
+package tree
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/MitchK/autorobin/lib/model"
+	"github.com/MitchK/autorobin/lib/portfolioparser"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// class Asset class of the file
+type class struct {
+	Name    string                `yaml:"name,omitempty"`
+	Weight  portfolioparser.Share `yaml:"weight,omitempty"`
+	Band    portfolioparser.Share `yaml:"band,omitempty"`
+	Classes []class               `yaml:"classes,omitempty"`
+	Assets  []string              `yaml:"assets,omitempty"`
+}
+
+func (c class) allocation() model.Allocation {
+	allocation := model.Allocation{
+		Name:   c.Name,
+		Weight: float64(c.Weight),
+		Band:   float64(c.Band),
+	}
+	for _, child := range c.Classes {
+		allocation.Classes = append(allocation.Classes, child.allocation())
+	}
+	for _, symbol := range c.Assets {
+		allocation.Assets = append(allocation.Assets, model.Asset{
+			Symbol: strings.TrimSpace(symbol),
+		})
+	}
+	return allocation
+}
+
+func newClass(allocation model.Allocation) class {
+	c := class{
+		Name:   allocation.Name,
+		Weight: portfolioparser.Share(allocation.Weight),
+		Band:   portfolioparser.Share(allocation.Band),
+	}
+	for _, child := range allocation.Classes {
+		c.Classes = append(c.Classes, newClass(child))
+	}
+	for _, asset := range allocation.Assets {
+		c.Assets = append(c.Assets, asset.Symbol)
+	}
+	return c
+}
+
+// Marshal Returns the allocation as a YAML file that the parser reads, weights and bands are written as percentages
+func Marshal(allocation model.Allocation) ([]byte, error) {
+	root := newClass(allocation)
+	root.Weight = 0
+	return yaml.Marshal(root)
+}
+
+type parser struct{}
+
+// NewParser Returns a parser of YAML files with a tree of asset classes, see README
+func NewParser() portfolioparser.AllocationParser {
+	return &parser{}
+}
+
+// ParseAllocation ParseAllocation
+func (parser *parser) ParseAllocation(reader io.Reader) (model.Allocation, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return model.Allocation{}, err
+	}
+	var root class
+	if err := yaml.UnmarshalStrict(data, &root); err != nil {
+		return model.Allocation{}, fmt.Errorf("yaml parser: %v", err)
+	}
+	allocation := root.allocation()
+	if err := allocation.Validate(); err != nil {
+		return model.Allocation{}, fmt.Errorf("yaml parser: %v", err)
+	}
+	return allocation, nil
+}
+
+// Parse Returns the target weights of the assets, the weight of a sleeve goes to its first asset
+func (parser *parser) Parse(reader io.Reader) (model.Weights, []model.Asset, error) {
+	allocation, err := parser.ParseAllocation(reader)
+	if err != nil {
+		return model.Weights{}, nil, err
+	}
+	return allocation.Weights(), allocation.Members(), nil
+}
@@ -0,0 +1,61 @@
+package tree_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MitchK/autorobin/lib/model"
+	"github.com/MitchK/autorobin/lib/portfolioparser/tree"
+	"github.com/onsi/gomega"
+)
+
+func TestParse(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	file, err := os.Open(filepath.Join("fixtures", "test.yaml"))
+	g.Expect(err).To(gomega.BeNil())
+	defer file.Close()
+	allocation, err := tree.NewParser().ParseAllocation(file)
+	g.Expect(err).To(gomega.BeNil())
+
+	// should accept percentages and fractions
+	g.Expect(allocation.Classes).To(gomega.HaveLen(2))
+	g.Expect(allocation.Classes[0].Weight).To(gomega.BeNumerically("~", 0.6))
+	g.Expect(allocation.Classes[0].Band).To(gomega.BeNumerically("~", 0.05))
+	g.Expect(allocation.Classes[1].Weight).To(gomega.BeNumerically("~", 0.4))
+	g.Expect(allocation.Classes[0].Classes[0].Assets).To(gomega.Equal([]model.Asset{{Symbol: "VTI"}, {Symbol: "ITOT"}}))
+
+	// should flatten the tree into weights
+	weights, assets, err := tree.NewParser().Parse(strings.NewReader("classes: [{name: stocks, weight: 100%, assets: [VTI]}]"))
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(assets).To(gomega.Equal([]model.Asset{{Symbol: "VTI"}}))
+	g.Expect(weights[model.Asset{Symbol: "VTI"}]).To(gomega.BeNumerically("~", 1))
+
+	// should reject invalid trees
+	_, _, err = tree.NewParser().Parse(strings.NewReader("classes: [{name: stocks, weight: 90%, assets: [VTI]}]"))
+	g.Expect(err).NotTo(gomega.BeNil())
+	_, _, err = tree.NewParser().Parse(strings.NewReader("classes: [{name: stocks, weight: lots, assets: [VTI]}]"))
+	g.Expect(err).NotTo(gomega.BeNil())
+}
+
+func TestMarshal(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	allocation := model.Allocation{
+		Weight: 1,
+		Classes: []model.Allocation{
+			{Name: "VTI", Weight: 0.6, Band: 0.05, Assets: []model.Asset{{Symbol: "VTI"}}},
+			{Name: "BND", Weight: 0.4, Assets: []model.Asset{{Symbol: "BND"}}},
+		},
+	}
+
+	// should write percentages that are parsed into the same allocation
+	data, err := tree.Marshal(allocation)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(string(data)).To(gomega.ContainSubstring("weight: 60%"))
+	parsed, err := tree.NewParser().ParseAllocation(strings.NewReader(string(data)))
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(parsed.Classes).To(gomega.Equal(allocation.Classes))
+}
@@ -0,0 +1,240 @@
+package tax
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/MitchK/autorobin/lib/model"
+)
+
+// Select Selects the lots to sell the given quantity at the given price and date.
+// It returns the sold parts of the lots and the lots that remain, lots of the specific method are sold in the given order.
+func Select(lots []model.Lot, quantity float64, price float64, date time.Time, method model.LotMethod, ids ...string) ([]model.Lot, []model.Lot, error) {
+	sorted, err := order(lots, price, date, method, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sold := []model.Lot{}
+	soldQuantities := map[string]float64{}
+	remaining := quantity
+	for _, lot := range sorted {
+		if remaining <= 0 {
+			break
+		}
+		part := lot
+		part.Quantity = math.Min(lot.Quantity, remaining)
+		remaining -= part.Quantity
+		soldQuantities[lot.ID] += part.Quantity
+		sold = append(sold, part)
+	}
+	if remaining > 1e-9 {
+		return nil, nil, fmt.Errorf("cannot sell %v shares: lots only contain %v", quantity, quantity-remaining)
+	}
+
+	// keep the remaining lots in their original order
+	kept := []model.Lot{}
+	for _, lot := range lots {
+		lot.Quantity -= soldQuantities[lot.ID]
+		if lot.Quantity > 1e-9 {
+			kept = append(kept, lot)
+		}
+	}
+	return sold, kept, nil
+}
+
+// order Returns the lots in the order they are sold by the method
+func order(lots []model.Lot, price float64, date time.Time, method model.LotMethod, ids []string) ([]model.Lot, error) {
+	sorted := make([]model.Lot, len(lots))
+	copy(sorted, lots)
+	switch method {
+	case model.LotMethodFIFO:
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].Acquired.Before(sorted[j].Acquired)
+		})
+	case model.LotMethodLIFO:
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].Acquired.After(sorted[j].Acquired)
+		})
+	case model.LotMethodHighestCost:
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].Cost > sorted[j].Cost
+		})
+	case model.LotMethodMinimumGain:
+		sort.SliceStable(sorted, func(i, j int) bool {
+			rankI := rank(sorted[i], price, date)
+			rankJ := rank(sorted[j], price, date)
+			if rankI != rankJ {
+				return rankI < rankJ
+			}
+			// the highest cost realizes the lowest gain per share
+			return sorted[i].Cost > sorted[j].Cost
+		})
+	case model.LotMethodSpecific:
+		byID := map[string]model.Lot{}
+		for _, lot := range lots {
+			byID[lot.ID] = lot
+		}
+		sorted = []model.Lot{}
+		for _, id := range ids {
+			lot, ok := byID[id]
+			if !ok {
+				return nil, fmt.Errorf("lot %s does not exist", id)
+			}
+			sorted = append(sorted, lot)
+		}
+	default:
+		return nil, fmt.Errorf("invalid lot method: %v", method)
+	}
+	return sorted, nil
+}
+
+// rank Ranks a lot for LotMethodMinimumGain: short-term losses offset the highest taxed gains and are sold first,
+// then long-term losses, long-term gains and short-term gains last
+func rank(lot model.Lot, price float64, date time.Time) int {
+	longTerm := model.RealizedGain{Lot: lot, Sold: date}.IsLongTerm()
+	switch {
+	case lot.Cost > price && !longTerm:
+		return 0
+	case lot.Cost > price:
+		return 1
+	case longTerm:
+		return 2
+	}
+	return 3
+}
+
+// Summary Realized gains by term
+type Summary struct {
+	ShortTerm float64
+	LongTerm  float64
+
+	// UnknownTerm Gains whose holding period is unknown because the broker does not track lots
+	UnknownTerm float64
+
+	// Losses Sum of all realized losses as a positive amount, they are included in the gains by term
+	Losses float64
+}
+
+// Total Total
+func (summary Summary) Total() float64 {
+	return summary.ShortTerm + summary.LongTerm + summary.UnknownTerm
+}
+
+// Add Returns the sum of both summaries
+func (summary Summary) Add(other Summary) Summary {
+	return Summary{
+		ShortTerm:   summary.ShortTerm + other.ShortTerm,
+		LongTerm:    summary.LongTerm + other.LongTerm,
+		UnknownTerm: summary.UnknownTerm + other.UnknownTerm,
+		Losses:      summary.Losses + other.Losses,
+	}
+}
+
+// Rates Tax rates on realized gains, e.g. 0.15 for 15%
+type Rates struct {
+	ShortTerm float64
+	LongTerm  float64
+
+	// State State rate that applies to all gains
+	State float64
+}
+
+// Tax Returns the estimated tax on the gains. Short-term and long-term gains are netted separately before losses of one term
+// offset gains of the other, gains of unknown term are taxed at the short-term rate.
+func (rates Rates) Tax(summary Summary) float64 {
+	shortTerm := summary.ShortTerm + summary.UnknownTerm
+	longTerm := summary.LongTerm
+	if shortTerm < 0 && longTerm > 0 {
+		longTerm = math.Max(0, longTerm+shortTerm)
+	} else if longTerm < 0 && shortTerm > 0 {
+		shortTerm = math.Max(0, shortTerm+longTerm)
+	}
+	return math.Max(0, shortTerm)*(rates.ShortTerm+rates.State) + math.Max(0, longTerm)*(rates.LongTerm+rates.State)
+}
+
+// EstimateSales Estimates the gains of the sell orders at their limit prices, the summaries of other orders are empty.
+// Lots that are sold by an order are not available to the following ones, orders without lot method sell with the given method.
+// Without lots, the gain is based on the average buy price and its term is unknown.
+func EstimateSales(positions []model.Position, orders []model.Order, method model.LotMethod, date time.Time) ([]Summary, error) {
+	byAsset := map[model.Asset]model.Position{}
+	for _, position := range positions {
+		byAsset[position.Asset] = position
+	}
+	summaries := make([]Summary, len(orders))
+	for i, order := range orders {
+		if order.Type != model.OrderTypeSell {
+			continue
+		}
+		position, ok := byAsset[order.Asset]
+		if !ok {
+			return nil, fmt.Errorf("cannot estimate sale of %s: no position", order.Asset.Symbol)
+		}
+		if len(position.Lots) == 0 {
+			gain := (order.Price - position.AvgBuyPrice) * order.Quantity
+			summaries[i] = Summary{UnknownTerm: gain, Losses: math.Max(0, -gain)}
+			continue
+		}
+		orderMethod := order.LotMethod
+		if orderMethod == 0 {
+			orderMethod = method
+		}
+		sold, remaining, err := Select(position.Lots, order.Quantity, order.Price, date, orderMethod, order.LotIDs...)
+		if err != nil {
+			return nil, fmt.Errorf("cannot estimate sale of %s: %v", order.Asset.Symbol, err)
+		}
+		summaries[i] = Summarize(Realize(order.Asset, sold, order.Price, date)...)
+		position.Lots = remaining
+		byAsset[order.Asset] = position
+	}
+	return summaries, nil
+}
+
+// Summarize Sums up realized gains by term
+func Summarize(gains ...model.RealizedGain) Summary {
+	summary := Summary{}
+	for _, gain := range gains {
+		if gain.IsLongTerm() {
+			summary.LongTerm += gain.Gain()
+		} else {
+			summary.ShortTerm += gain.Gain()
+		}
+		if gain.Gain() < 0 {
+			summary.Losses -= gain.Gain()
+		}
+	}
+	return summary
+}
+
+// SummarizeByYear Sums up realized gains by the year of the sale
+func SummarizeByYear(gains ...model.RealizedGain) map[int]Summary {
+	byYear := map[int][]model.RealizedGain{}
+	for _, gain := range gains {
+		year := gain.Sold.Year()
+		byYear[year] = append(byYear[year], gain)
+	}
+	summaries := map[int]Summary{}
+	for year, gains := range byYear {
+		summaries[year] = Summarize(gains...)
+	}
+	return summaries
+}
+
+// Realize Returns the gains of selling the given lots at a price
+func Realize(asset model.Asset, sold []model.Lot, price float64, date time.Time) []model.RealizedGain {
+	gains := make([]model.RealizedGain, len(sold))
+	for i, lot := range sold {
+		gains[i] = model.RealizedGain{
+			Asset: asset,
+			Lot:   lot,
+			Price: price,
+			Sold:  date,
+		}
+	}
+	return gains
+}
+
+// WashSaleWindow Losses are disallowed if the same or a substantially identical security is bought within this window before or after the sale
+const WashSaleWindow = 30 * 24 * time.Hour
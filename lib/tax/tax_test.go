@@ -0,0 +1,132 @@
+package tax_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MitchK/autorobin/lib/model"
+	"github.com/MitchK/autorobin/lib/tax"
+	"github.com/onsi/gomega"
+)
+
+func TestSelect(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	day := time.Date(2018, 1, 2, 0, 0, 0, 0, time.UTC)
+	lots := []model.Lot{
+		{ID: "1", Acquired: day, Quantity: 10, Cost: 50},
+		{ID: "2", Acquired: day.AddDate(0, 6, 0), Quantity: 10, Cost: 120},
+		{ID: "3", Acquired: day.AddDate(1, 0, 0), Quantity: 10, Cost: 90},
+		{ID: "4", Acquired: day.AddDate(1, 3, 0), Quantity: 10, Cost: 80},
+	}
+	sale := day.AddDate(1, 6, 1)
+	ids := func(lots []model.Lot) []string {
+		ids := []string{}
+		for _, lot := range lots {
+			ids = append(ids, lot.ID)
+		}
+		return ids
+	}
+
+	sold, remaining, err := tax.Select(lots, 15, 100, sale, model.LotMethodFIFO)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(ids(sold)).To(gomega.Equal([]string{"1", "2"}))
+	g.Expect(sold[1].Quantity).To(gomega.BeNumerically("~", 5))
+	g.Expect(ids(remaining)).To(gomega.Equal([]string{"2", "3", "4"}))
+	g.Expect(remaining[0].Quantity).To(gomega.BeNumerically("~", 5))
+
+	sold, _, err = tax.Select(lots, 10, 100, sale, model.LotMethodLIFO)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(ids(sold)).To(gomega.Equal([]string{"4"}))
+
+	sold, _, err = tax.Select(lots, 20, 100, sale, model.LotMethodHighestCost)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(ids(sold)).To(gomega.Equal([]string{"2", "3"}))
+
+	// the loss is sold first, then the long-term gain and the short-term gains last, the smaller one first
+	sold, _, err = tax.Select(lots, 40, 100, sale, model.LotMethodMinimumGain)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(ids(sold)).To(gomega.Equal([]string{"2", "1", "3", "4"}))
+
+	sold, _, err = tax.Select(lots, 12, 100, sale, model.LotMethodSpecific, "3", "1")
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(ids(sold)).To(gomega.Equal([]string{"3", "1"}))
+	g.Expect(sold[1].Quantity).To(gomega.BeNumerically("~", 2))
+
+	_, _, err = tax.Select(lots, 1, 100, sale, model.LotMethodSpecific, "5")
+	g.Expect(err).ToNot(gomega.BeNil())
+	_, _, err = tax.Select(lots, 41, 100, sale, model.LotMethodFIFO)
+	g.Expect(err).ToNot(gomega.BeNil())
+}
+
+func TestSummarize(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	day := time.Date(2018, 1, 2, 0, 0, 0, 0, time.UTC)
+	asset := model.Asset{Symbol: "A"}
+	gains := tax.Realize(asset, []model.Lot{
+		{Acquired: day, Quantity: 10, Cost: 50},
+		{Acquired: day.AddDate(0, 6, 0), Quantity: 10, Cost: 120},
+	}, 100, day.AddDate(1, 1, 0))
+	summary := tax.Summarize(gains...)
+	g.Expect(summary.LongTerm).To(gomega.BeNumerically("~", 500))
+	g.Expect(summary.ShortTerm).To(gomega.BeNumerically("~", -200))
+	g.Expect(summary.Total()).To(gomega.BeNumerically("~", 300))
+	g.Expect(summary.Losses).To(gomega.BeNumerically("~", 200))
+
+	byYear := tax.SummarizeByYear(append(gains, tax.Realize(asset, []model.Lot{
+		{Acquired: day, Quantity: 1, Cost: 150},
+	}, 100, day.AddDate(2, 0, 0))...)...)
+	g.Expect(byYear).To(gomega.HaveLen(2))
+	g.Expect(byYear[2019].Losses).To(gomega.BeNumerically("~", 200))
+	g.Expect(byYear[2020].Losses).To(gomega.BeNumerically("~", 50))
+}
+
+func TestEstimateSales(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	day := time.Date(2018, 1, 2, 0, 0, 0, 0, time.UTC)
+	a := model.Asset{Symbol: "A"}
+	b := model.Asset{Symbol: "B"}
+	positions := []model.Position{
+		{Asset: a, Quantity: 20, Lots: []model.Lot{
+			{ID: "1", Acquired: day, Quantity: 10, Cost: 50},
+			{ID: "2", Acquired: day.AddDate(1, 0, 0), Quantity: 10, Cost: 120},
+		}},
+		{Asset: b, Quantity: 10, AvgBuyPrice: 90},
+	}
+	orders := []model.Order{
+		{Asset: a, Type: model.OrderTypeSell, Quantity: 5, Price: 100},
+		{Asset: b, Type: model.OrderTypeBuy, Quantity: 5, Price: 100},
+		{Asset: a, Type: model.OrderTypeSell, Quantity: 10, Price: 100},
+		{Asset: b, Type: model.OrderTypeSell, Quantity: 10, Price: 100},
+	}
+	summaries, err := tax.EstimateSales(positions, orders, model.LotMethodFIFO, day.AddDate(1, 1, 0))
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(summaries[0].LongTerm).To(gomega.BeNumerically("~", 250))
+	g.Expect(summaries[1]).To(gomega.Equal(tax.Summary{}))
+
+	// the second sale continues with the remaining lots
+	g.Expect(summaries[2].LongTerm).To(gomega.BeNumerically("~", 250))
+	g.Expect(summaries[2].ShortTerm).To(gomega.BeNumerically("~", -100))
+	g.Expect(summaries[3].UnknownTerm).To(gomega.BeNumerically("~", 100))
+
+	// orders without lot method sell with the given one
+	summaries, err = tax.EstimateSales(positions, orders[:1], model.LotMethodHighestCost, day.AddDate(1, 1, 0))
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(summaries[0].ShortTerm).To(gomega.BeNumerically("~", -100))
+
+	_, err = tax.EstimateSales(positions[:1], orders, model.LotMethodFIFO, day)
+	g.Expect(err).ToNot(gomega.BeNil())
+}
+
+func TestTax(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	rates := tax.Rates{ShortTerm: 0.3, LongTerm: 0.15, State: 0.05}
+	g.Expect(rates.Tax(tax.Summary{ShortTerm: 100, LongTerm: 200})).To(gomega.BeNumerically("~", 35+40))
+
+	// a short-term loss offsets long-term gains
+	g.Expect(rates.Tax(tax.Summary{ShortTerm: -100, LongTerm: 200})).To(gomega.BeNumerically("~", 20))
+	g.Expect(rates.Tax(tax.Summary{UnknownTerm: 100, LongTerm: -300})).To(gomega.BeNumerically("~", 0))
+}
@@ -0,0 +1,272 @@
+package weighting
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/MitchK/autorobin/lib/model"
+)
+
+// Strategy Computes target weights from the trailing daily quotes of the assets
+type Strategy interface {
+	// Weights Returns the target weights, the history contains the quotes of every asset in ascending order
+	Weights(assets []model.Asset, history [][]model.Quote) (model.Weights, error)
+}
+
+// EqualWeight Gives every asset the same weight, the history is not used
+type EqualWeight struct{}
+
+// NewEqualWeight NewEqualWeight
+func NewEqualWeight() Strategy {
+	return &EqualWeight{}
+}
+
+// Weights Weights
+func (strategy *EqualWeight) Weights(assets []model.Asset, history [][]model.Quote) (model.Weights, error) {
+	if len(assets) == 0 {
+		return nil, errors.New("no assets to weight")
+	}
+	weights := model.Weights{}
+	for _, asset := range assets {
+		weights[asset] = 1 / float64(len(assets))
+	}
+	return weights, nil
+}
+
+// InverseVolatility Weights every asset by the inverse of the standard deviation of its daily returns
+type InverseVolatility struct{}
+
+// NewInverseVolatility NewInverseVolatility
+func NewInverseVolatility() Strategy {
+	return &InverseVolatility{}
+}
+
+// Weights Weights
+func (strategy *InverseVolatility) Weights(assets []model.Asset, history [][]model.Quote) (model.Weights, error) {
+	returns, err := Returns(assets, history)
+	if err != nil {
+		return nil, err
+	}
+	covariance := Covariance(returns)
+	inverse := make([]float64, len(assets))
+	for i := range assets {
+		if covariance[i][i] <= 0 {
+			return nil, fmt.Errorf("%s has no volatility", assets[i].Symbol)
+		}
+		inverse[i] = 1 / math.Sqrt(covariance[i][i])
+	}
+	return normalize(assets, inverse), nil
+}
+
+// RiskParity Weights the assets so that each of them contributes the same share of the portfolio variance
+// (equal risk contribution), correlations between the assets are taken into account
+type RiskParity struct{}
+
+// NewRiskParity NewRiskParity
+func NewRiskParity() Strategy {
+	return &RiskParity{}
+}
+
+// maxIterations Upper bound for the iterations of the numerical strategies
+const maxIterations = 10000
+
+// tolerance Largest change of a weight between two iterations at which a numerical strategy has converged
+const tolerance = 1e-10
+
+// Weights Weights
+func (strategy *RiskParity) Weights(assets []model.Asset, history [][]model.Quote) (model.Weights, error) {
+	returns, err := Returns(assets, history)
+	if err != nil {
+		return nil, err
+	}
+	covariance := Covariance(returns)
+	n := len(assets)
+	budget := 1 / float64(n)
+
+	// cyclical coordinate descent, every step solves the risk contribution of one asset for its unnormalized weight
+	weights := make([]float64, n)
+	for i := range weights {
+		if covariance[i][i] <= 0 {
+			return nil, fmt.Errorf("%s has no volatility", assets[i].Symbol)
+		}
+		weights[i] = 1 / math.Sqrt(covariance[i][i])
+	}
+	for iteration := 0; iteration < maxIterations; iteration++ {
+		change := 0.0
+		for i := range weights {
+			var b float64
+			for j := range weights {
+				if j != i {
+					b += covariance[i][j] * weights[j]
+				}
+			}
+			weight := (-b + math.Sqrt(b*b+4*covariance[i][i]*budget)) / (2 * covariance[i][i])
+			change = math.Max(change, math.Abs(weight-weights[i]))
+			weights[i] = weight
+		}
+		if change < tolerance {
+			break
+		}
+	}
+	return normalize(assets, weights), nil
+}
+
+// MinimumVariance Weights the assets so that the variance of the portfolio is minimal, without short positions
+type MinimumVariance struct{}
+
+// NewMinimumVariance NewMinimumVariance
+func NewMinimumVariance() Strategy {
+	return &MinimumVariance{}
+}
+
+// Weights Weights
+func (strategy *MinimumVariance) Weights(assets []model.Asset, history [][]model.Quote) (model.Weights, error) {
+	returns, err := Returns(assets, history)
+	if err != nil {
+		return nil, err
+	}
+	covariance := Covariance(returns)
+	n := len(assets)
+
+	// projected gradient descent on the simplex, the step size is the inverse of an upper bound of the largest eigenvalue
+	var bound float64
+	for i := range covariance {
+		for j := range covariance[i] {
+			bound += covariance[i][j] * covariance[i][j]
+		}
+	}
+	weights := make([]float64, n)
+	for i := range weights {
+		weights[i] = 1 / float64(n)
+	}
+	if bound == 0 {
+		return normalize(assets, weights), nil
+	}
+	step := 1 / (2 * math.Sqrt(bound))
+	for iteration := 0; iteration < maxIterations; iteration++ {
+		next := make([]float64, n)
+		for i := range weights {
+			var gradient float64
+			for j := range weights {
+				gradient += 2 * covariance[i][j] * weights[j]
+			}
+			next[i] = weights[i] - step*gradient
+		}
+		next = ProjectSimplex(next)
+		change := 0.0
+		for i := range weights {
+			change = math.Max(change, math.Abs(next[i]-weights[i]))
+		}
+		weights = next
+		if change < tolerance {
+			break
+		}
+	}
+	return normalize(assets, weights), nil
+}
+
+// Returns Returns the daily returns of the assets on the dates that all of them have quotes for
+func Returns(assets []model.Asset, history [][]model.Quote) ([][]float64, error) {
+	if len(assets) == 0 {
+		return nil, errors.New("no assets to weight")
+	}
+	if len(history) != len(assets) {
+		return nil, fmt.Errorf("history of %d assets for %d assets", len(history), len(assets))
+	}
+	prices := make([]map[time.Time]float64, len(assets))
+	counts := map[time.Time]int{}
+	for i, quotes := range history {
+		prices[i] = map[time.Time]float64{}
+		for _, quote := range quotes {
+			if quote.Price <= 0 {
+				continue
+			}
+			if _, ok := prices[i][quote.Date]; !ok {
+				counts[quote.Date]++
+			}
+			prices[i][quote.Date] = quote.Price
+		}
+	}
+	dates := []time.Time{}
+	for date, count := range counts {
+		if count == len(assets) {
+			dates = append(dates, date)
+		}
+	}
+	if len(dates) < 3 {
+		return nil, errors.New("not enough history, at least 3 common days of quotes are required")
+	}
+	sort.Slice(dates, func(i, j int) bool {
+		return dates[i].Before(dates[j])
+	})
+	returns := make([][]float64, len(assets))
+	for i := range assets {
+		returns[i] = make([]float64, len(dates)-1)
+		for d := 1; d < len(dates); d++ {
+			returns[i][d-1] = prices[i][dates[d]]/prices[i][dates[d-1]] - 1
+		}
+	}
+	return returns, nil
+}
+
+// Covariance Returns the sample covariance matrix of the returns of the assets
+func Covariance(returns [][]float64) [][]float64 {
+	means := make([]float64, len(returns))
+	for i, r := range returns {
+		for _, value := range r {
+			means[i] += value / float64(len(r))
+		}
+	}
+	covariance := make([][]float64, len(returns))
+	for i := range returns {
+		covariance[i] = make([]float64, len(returns))
+	}
+	for i := range returns {
+		for j := i; j < len(returns); j++ {
+			var sum float64
+			for t := range returns[i] {
+				sum += (returns[i][t] - means[i]) * (returns[j][t] - means[j])
+			}
+			if len(returns[i]) > 1 {
+				sum /= float64(len(returns[i]) - 1)
+			}
+			covariance[i][j] = sum
+			covariance[j][i] = sum
+		}
+	}
+	return covariance
+}
+
+// ProjectSimplex Returns the closest point to the values whose elements are not negative and add up to 1
+func ProjectSimplex(values []float64) []float64 {
+	sorted := append([]float64{}, values...)
+	sort.Sort(sort.Reverse(sort.Float64Slice(sorted)))
+	var sum, theta float64
+	for i, value := range sorted {
+		sum += value
+		if t := (sum - 1) / float64(i+1); value-t > 0 {
+			theta = t
+		}
+	}
+	projected := make([]float64, len(values))
+	for i, value := range values {
+		projected[i] = math.Max(value-theta, 0)
+	}
+	return projected
+}
+
+// normalize Returns the weights of the assets scaled to add up to 1
+func normalize(assets []model.Asset, values []float64) model.Weights {
+	var sum float64
+	for _, value := range values {
+		sum += value
+	}
+	weights := model.Weights{}
+	for i, asset := range assets {
+		weights[asset] = values[i] / sum
+	}
+	return weights
+}
@@ -0,0 +1,79 @@
+package weighting_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MitchK/autorobin/lib/model"
+	"github.com/MitchK/autorobin/lib/weighting"
+	"github.com/onsi/gomega"
+)
+
+// quotes Returns the quotes of an asset with the given daily returns, starting at a price of 100
+func quotes(asset model.Asset, returns ...float64) []model.Quote {
+	date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	price := 100.0
+	quotes := []model.Quote{{Asset: asset, Date: date, Price: price}}
+	for _, r := range returns {
+		date = date.AddDate(0, 0, 1)
+		price *= 1 + r
+		quotes = append(quotes, model.Quote{Asset: asset, Date: date, Price: price})
+	}
+	return quotes
+}
+
+func TestStrategies(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	// uncorrelated returns, b is twice as volatile as a
+	a := model.Asset{Symbol: "A"}
+	b := model.Asset{Symbol: "B"}
+	assets := []model.Asset{a, b}
+	history := [][]model.Quote{
+		quotes(a, 0.01, -0.01, 0.01, -0.01, 0.01, -0.01, 0.01, -0.01),
+		quotes(b, 0.02, 0.02, -0.02, -0.02, 0.02, 0.02, -0.02, -0.02),
+	}
+
+	weights, err := weighting.NewEqualWeight().Weights(assets, history)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(weights).To(gomega.Equal(model.Weights{a: 0.5, b: 0.5}))
+
+	// should weight by the inverse volatility
+	weights, err = weighting.NewInverseVolatility().Weights(assets, history)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(weights[a]).To(gomega.BeNumerically("~", 2.0/3, 1e-6))
+	g.Expect(weights[b]).To(gomega.BeNumerically("~", 1.0/3, 1e-6))
+
+	// should equal the inverse volatility without correlation
+	weights, err = weighting.NewRiskParity().Weights(assets, history)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(weights[a]).To(gomega.BeNumerically("~", 2.0/3, 1e-6))
+	g.Expect(weights[b]).To(gomega.BeNumerically("~", 1.0/3, 1e-6))
+
+	// should weight by the inverse variance without correlation
+	weights, err = weighting.NewMinimumVariance().Weights(assets, history)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(weights[a]).To(gomega.BeNumerically("~", 0.8, 1e-6))
+	g.Expect(weights[b]).To(gomega.BeNumerically("~", 0.2, 1e-6))
+
+	// should not short the more volatile of two perfectly correlated assets
+	history[1] = quotes(b, 0.02, -0.02, 0.02, -0.02, 0.02, -0.02, 0.02, -0.02)
+	weights, err = weighting.NewMinimumVariance().Weights(assets, history)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(weights[a]).To(gomega.BeNumerically("~", 1, 1e-6))
+	g.Expect(weights[b]).To(gomega.BeNumerically("~", 0, 1e-6))
+
+	// should reject too little history and assets without volatility
+	_, err = weighting.NewInverseVolatility().Weights(assets, [][]model.Quote{quotes(a, 0.01), quotes(b, 0.01)})
+	g.Expect(err).NotTo(gomega.BeNil())
+	_, err = weighting.NewRiskParity().Weights(assets, [][]model.Quote{quotes(a, 0.01, 0.01, -0.01), quotes(b, 0, 0, 0)})
+	g.Expect(err).NotTo(gomega.BeNil())
+}
+
+func TestProjectSimplex(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	g.Expect(weighting.ProjectSimplex([]float64{0.5, 0.5})).To(gomega.Equal([]float64{0.5, 0.5}))
+	g.Expect(weighting.ProjectSimplex([]float64{2, 0})).To(gomega.Equal([]float64{1, 0}))
+	g.Expect(weighting.ProjectSimplex([]float64{1, 1, -1})).To(gomega.Equal([]float64{0.5, 0.5, 0}))
+}